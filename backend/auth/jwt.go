@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// SigningKey is one entry of a KeySet, identified by its kid.
+type SigningKey struct {
+	ID     string
+	Alg    string
+	secret []byte             // HS256
+	priv   ed25519.PrivateKey // EdDSA
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	if k.Alg == AlgEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodHS256
+}
+
+func (k *SigningKey) signKey() interface{} {
+	if k.Alg == AlgEdDSA {
+		return k.priv
+	}
+	return k.secret
+}
+
+func (k *SigningKey) verifyKey() interface{} {
+	if k.Alg == AlgEdDSA {
+		return k.priv.Public()
+	}
+	return k.secret
+}
+
+// KeySet signs access tokens with its active key and verifies tokens signed
+// by any key it holds, so keys can be rotated by adding a new key, making it
+// active, and removing the old one once its tokens have expired.
+type KeySet struct {
+	active string
+	keys   map[string]*SigningKey
+}
+
+// ParseKeySet builds a KeySet from a comma separated list of
+// "kid:alg:base64key" entries. For HS256 the key is the shared secret; for
+// EdDSA it is the 32 byte Ed25519 seed. active names the kid used to sign;
+// if empty, the first key is used.
+func ParseKeySet(spec, active string) (*KeySet, error) {
+	ks := &KeySet{keys: map[string]*SigningKey{}}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid key entry %q, expected kid:alg:base64key", entry)
+		}
+		kid, alg := parts[0], parts[1]
+		raw, err := base64.StdEncoding.DecodeString(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("key %q: invalid base64: %w", kid, err)
+		}
+		if _, dup := ks.keys[kid]; dup {
+			return nil, fmt.Errorf("duplicate key id %q", kid)
+		}
+
+		key := &SigningKey{ID: kid, Alg: alg}
+		switch alg {
+		case AlgHS256:
+			if len(raw) < 32 {
+				return nil, fmt.Errorf("key %q: HS256 secrets must be at least 32 bytes", kid)
+			}
+			key.secret = raw
+		case AlgEdDSA:
+			if len(raw) != ed25519.SeedSize {
+				return nil, fmt.Errorf("key %q: EdDSA keys must be a %d byte seed", kid, ed25519.SeedSize)
+			}
+			key.priv = ed25519.NewKeyFromSeed(raw)
+		default:
+			return nil, fmt.Errorf("key %q: unsupported algorithm %q", kid, alg)
+		}
+		ks.keys[kid] = key
+		if active == "" {
+			active = kid
+		}
+	}
+
+	if len(ks.keys) == 0 {
+		return nil, errors.New("no signing keys configured")
+	}
+	if _, ok := ks.keys[active]; !ok {
+		return nil, fmt.Errorf("active key %q is not in the key set", active)
+	}
+	ks.active = active
+	return ks, nil
+}
+
+// AccessClaims are the claims carried by an access token.
+type AccessClaims struct {
+	UserID    uint   `json:"-"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	SessionID uint   `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// ErrInvalidToken is returned for any token that fails verification.
+var ErrInvalidToken = errors.New("invalid access token")
+
+// Sign issues an access token for claims, valid for ttl, using the active key.
+func (ks *KeySet) Sign(claims AccessClaims, issuer string, ttl time.Duration) (string, time.Time, error) {
+	key := ks.keys[ks.active]
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+
+	jti, err := NewToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	claims.ID = jti
+	claims.Subject = strconv.FormatUint(uint64(claims.UserID), 10)
+	claims.Issuer = issuer
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(expiresAt)
+
+	token := jwt.NewWithClaims(key.method(), claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.signKey())
+	return signed, expiresAt, err
+}
+
+// Verify checks the signature, algorithm, issuer and expiry of an access
+// token and returns its claims.
+func (ks *KeySet) Verify(tokenString, issuer string) (*AccessClaims, error) {
+	var claims AccessClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := ks.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		// The header's alg must match the key's; never trust it on its own
+		if t.Method.Alg() != key.method().Alg() {
+			return nil, fmt.Errorf("unexpected signing method %q", t.Method.Alg())
+		}
+		return key.verifyKey(), nil
+	}, jwt.WithIssuer(issuer), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	id, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	claims.UserID = uint(id)
+	return &claims, nil
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func b64(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+var (
+	hsSecret = strings.Repeat("s", 32)
+	edSeed   = strings.Repeat("e", ed25519.SeedSize)
+)
+
+func mustKeySet(t *testing.T, spec, active string) *KeySet {
+	t.Helper()
+	ks, err := ParseKeySet(spec, active)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
+
+func TestParseKeySet(t *testing.T) {
+	tests := []struct {
+		name   string
+		spec   string
+		active string
+		ok     bool
+	}{
+		{"hs256", "k1:HS256:" + b64(hsSecret), "", true},
+		{"eddsa", "k1:EdDSA:" + b64(edSeed), "", true},
+		{"two keys", "k1:HS256:" + b64(hsSecret) + ", k2:EdDSA:" + b64(edSeed), "k2", true},
+		{"empty", "", "", false},
+		{"missing part", "k1:" + b64(hsSecret), "", false},
+		{"bad base64", "k1:HS256:***", "", false},
+		{"short secret", "k1:HS256:" + b64("short"), "", false},
+		{"short seed", "k1:EdDSA:" + b64("short"), "", false},
+		{"unsupported alg", "k1:RS256:" + b64(hsSecret), "", false},
+		{"duplicate kid", "k1:HS256:" + b64(hsSecret) + ",k1:EdDSA:" + b64(edSeed), "", false},
+		{"unknown active", "k1:HS256:" + b64(hsSecret), "k2", false},
+	}
+	for _, tt := range tests {
+		_, err := ParseKeySet(tt.spec, tt.active)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: err = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	for _, alg := range []string{AlgHS256, AlgEdDSA} {
+		key := hsSecret
+		if alg == AlgEdDSA {
+			key = edSeed
+		}
+		ks := mustKeySet(t, "k1:"+alg+":"+b64(key), "")
+		token, _, err := ks.Sign(AccessClaims{UserID: 7, Username: "shopper", Role: "customer", SessionID: 3}, "shop", time.Minute)
+		if err != nil {
+			t.Fatalf("%s: Sign: %v", alg, err)
+		}
+		claims, err := ks.Verify(token, "shop")
+		if err != nil {
+			t.Fatalf("%s: Verify: %v", alg, err)
+		}
+		if claims.UserID != 7 || claims.Username != "shopper" || claims.Role != "customer" || claims.SessionID != 3 {
+			t.Errorf("%s: claims %+v", alg, claims)
+		}
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	ks := mustKeySet(t, "hs:HS256:"+b64(hsSecret)+",ed:EdDSA:"+b64(edSeed), "hs")
+	claims := AccessClaims{UserID: 7, Role: "customer"}
+	valid, _, err := ks.Sign(claims, "shop", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// forge signs claims with method and key under the given kid
+	forge := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		c := claims
+		c.Subject = "7"
+		c.Issuer = "shop"
+		c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Minute))
+		token := jwt.NewWithClaims(method, c)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	edPublic := ed25519.NewKeyFromSeed([]byte(edSeed)).Public().(ed25519.PublicKey)
+	expired, _, _ := ks.Sign(claims, "shop", -time.Minute)
+	parts := strings.Split(valid, ".")
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"unknown kid", forge(jwt.SigningMethodHS256, "gone", []byte(hsSecret))},
+		{"no kid", forge(jwt.SigningMethodHS256, "", []byte(hsSecret))},
+		// The EdDSA key's public half used as an HMAC secret
+		{"alg swapped to HS256", forge(jwt.SigningMethodHS256, "ed", []byte(edPublic))},
+		// The right secret, but not the algorithm configured for the key
+		{"alg swapped to HS512", forge(jwt.SigningMethodHS512, "hs", []byte(hsSecret))},
+		{"alg none", forge(jwt.SigningMethodNone, "hs", jwt.UnsafeAllowNoneSignatureType)},
+		{"wrong secret", forge(jwt.SigningMethodHS256, "hs", []byte(strings.Repeat("x", 32)))},
+		{"expired", expired},
+		{"tampered payload", parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"1","iss":"shop","role":"admin","exp":9999999999}`)) + "." + parts[2]},
+		{"garbage", "not.a.token"},
+	}
+	for _, tt := range tests {
+		if _, err := ks.Verify(tt.token, "shop"); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: got %v, want ErrInvalidToken", tt.name, err)
+		}
+	}
+	if _, err := ks.Verify(valid, "elsewhere"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("wrong issuer: got %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := mustKeySet(t, "k1:HS256:"+b64(hsSecret), "")
+	token, _, err := old.Sign(AccessClaims{UserID: 7}, "shop", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// k2 signs from now on, k1's tokens still verify until it is removed
+	rotated := mustKeySet(t, "k1:HS256:"+b64(hsSecret)+",k2:EdDSA:"+b64(edSeed), "k2")
+	if _, err := rotated.Verify(token, "shop"); err != nil {
+		t.Errorf("old key's token after rotation: %v", err)
+	}
+	fresh, _, _ := rotated.Sign(AccessClaims{UserID: 7}, "shop", time.Minute)
+	if _, err := old.Verify(fresh, "shop"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("new key's token on the old set: got %v, want ErrInvalidToken", err)
+	}
+	retired := mustKeySet(t, "k2:EdDSA:"+b64(edSeed), "")
+	if _, err := retired.Verify(token, "shop"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("retired key's token: got %v, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestTokenHasher(t *testing.T) {
+	h := NewTokenHasher([]byte("secret"))
+	// HMAC-SHA256 of "token" under "secret", as openssl dgst -hmac gives it
+	want := "e941110e3d2bfe82621f0e3e1434730d7305d106c5f68c87165d0b27a4611a4a"
+	if got := h.Hash("token"); got != want {
+		t.Errorf("Hash = %s, want %s", got, want)
+	}
+	if h.Hash("token2") == want {
+		t.Error("different tokens hash alike")
+	}
+	if NewTokenHasher([]byte("other")).Hash("token") == want {
+		t.Error("the hash doesn't depend on the secret")
+	}
+}
+
+func TestNewToken(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		token, err := NewToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil || len(b) != 32 {
+			t.Fatalf("token %q: %d bytes, %v", token, len(b), err)
+		}
+		if seen[token] {
+			t.Fatalf("token %q issued twice", token)
+		}
+		seen[token] = true
+	}
+}
@@ -0,0 +1,41 @@
+// Package blob stores binary objects, such as item images, by key in a
+// local directory or an S3-compatible bucket and hands out time-limited
+// signed URLs for them.
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when no object exists under the key.
+	ErrNotFound = errors.New("blob not found")
+	// ErrInvalidKey is returned for keys that are empty, absolute or
+	// escape their namespace with "..".
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Store persists objects by key. Keys are slash-separated relative paths
+// such as "items/3f2c.png".
+type Store interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get returns the object's content; the caller closes it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL that serves the object until ttl elapses.
+	SignedURL(key string, ttl time.Duration) (string, error)
+}
+
+// checkKey rejects keys that could address anything outside the store.
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, `\`) || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return ErrInvalidKey
+	}
+	return nil
+}
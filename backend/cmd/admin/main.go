@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"shopping-cart/config"
+	"shopping-cart/currency"
+	"shopping-cart/models"
+	"shopping-cart/store"
+)
+
+const usage = `usage: admin <command>
+
+commands:
+  promote <username>     give the user the admin role
+  demote <username>      make the user a regular customer
+  import-rates <file>    load exchange rates from a .csv or .json file
+
+Use this to bootstrap the first admin; afterwards admins can manage roles
+through PUT /users/:id/role. Rates are quoted against BASE_CURRENCY and
+merged into the existing table. The database is selected with the same
+DB_* variables as the server.`
+
+func main() {
+	if len(os.Args) != 3 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var role string
+	switch os.Args[1] {
+	case "promote":
+		role = models.RoleAdmin
+	case "demote":
+		role = models.RoleCustomer
+	case "import-rates":
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	db, _, err := config.OpenFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	stores := store.NewGormStores(db)
+
+	if role == "" {
+		importRates(stores.Rates, os.Args[2])
+		return
+	}
+
+	user, err := stores.Users.GetByUsername(os.Args[2])
+	if err != nil {
+		log.Fatalf("user %q not found", os.Args[2])
+	}
+	if err := stores.Users.SetRole(user.ID, role); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("%s is now %s", user.Username, role)
+}
+
+func importRates(rates store.RateStore, path string) {
+	base := config.LoadCatalogConfig().BaseCurrency
+	parsed, err := currency.ParseFile(path, base)
+	if err != nil {
+		log.Fatalf("%s: %v", path, err)
+	}
+	if err := rates.Upsert(parsed); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("imported %d exchange rates against %s", len(parsed), base)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"shopping-cart/config"
+	"shopping-cart/database"
+)
+
+const usage = `usage: migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [N]    revert the last N applied migrations (default 1)
+  status      list migrations and whether they are applied
+
+The database is selected with the same DB_* variables as the server.`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	db, _, err := config.OpenFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}()
+
+	runner := database.NewRunner(db)
+
+	switch os.Args[1] {
+	case "up":
+		ran, err := runner.Up()
+		for _, m := range ran {
+			log.Printf("applied %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(ran) == 0 {
+			log.Println("database is up to date")
+		}
+	case "down":
+		steps := 1
+		if len(os.Args) > 2 {
+			if steps, err = strconv.Atoi(os.Args[2]); err != nil || steps < 1 {
+				log.Fatalf("invalid step count %q", os.Args[2])
+			}
+		}
+		reverted, err := runner.Down(steps)
+		for _, m := range reverted {
+			log.Printf("reverted %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(reverted) == 0 {
+			log.Println("nothing to revert")
+		}
+	case "status":
+		statuses, err := runner.Status()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, st := range statuses {
+			state := "pending"
+			if st.Applied {
+				state = "applied " + st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-40s %s\n", st.Version, st.Name, state)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
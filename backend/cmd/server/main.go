@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"shopping-cart/blob"
+	"shopping-cart/config"
+	"shopping-cart/database"
+	"shopping-cart/payment"
+	"shopping-cart/routes"
+	"shopping-cart/search"
+	"shopping-cart/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func main() {
+	cfg := config.LoadServerConfig()
+
+	config.ConnectDatabase()
+	migrateOnStart(cfg.MigrateOnStart)
+
+	r := gin.Default()
+	blobs := newBlobStore(r, config.LoadBlobConfig())
+	gateway := newPaymentGateway(config.LoadPaymentConfig())
+
+	stores := store.NewGormStores(config.DB)
+	// The in-process index lives only as long as this process (and only
+	// sees writes made through it), so it is rebuilt from the catalog on
+	// every start
+	idx := search.NewMemoryIndex()
+	n, err := search.Reindex(idx, stores.Items)
+	if err != nil {
+		log.Fatal("Failed to build search index:", err)
+	}
+	log.Printf("Indexed %d items for search", n)
+
+	routes.SetupRoutes(r, stores, config.LoadSessionConfig(), config.LoadCatalogConfig(), config.LoadImageConfig(), blobs, gateway, idx, config.LoadIdempotencyConfig())
+
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           r,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		var err error
+		if cfg.TLSEnabled() {
+			log.Println("Listening with TLS on", cfg.Addr)
+			err = srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			log.Println("Listening on", cfg.Addr)
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+		close(serveErr)
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			log.Println("Server error:", err)
+		}
+	case sig := <-quit:
+		log.Println("Received", sig, "- shutting down")
+	}
+
+	// Stop accepting new connections and let in-flight requests drain
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Println("Graceful shutdown did not complete:", err)
+	}
+
+	if err := config.CloseDatabase(); err != nil {
+		log.Println("Failed to close database:", err)
+	}
+
+	log.Println("Server stopped")
+}
+
+// newBlobStore opens the configured blob store. The local store serves its
+// own signed URLs, so its handler is mounted on r.
+func newBlobStore(r *gin.Engine, cfg config.BlobConfig) blob.Store {
+	if cfg.Driver == config.BlobDriverS3 {
+		s3, err := blob.NewS3(blob.S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PathStyle: cfg.S3PathStyle,
+		})
+		if err != nil {
+			log.Fatal("Invalid S3 configuration: ", err)
+		}
+		return s3
+	}
+	local := blob.NewLocal(cfg.LocalDir, cfg.LocalURLPrefix, cfg.URLSecret)
+	r.GET(cfg.LocalURLPrefix+"/*key", gin.WrapH(local.Handler()))
+	return local
+}
+
+// newPaymentGateway returns the configured payment gateway.
+func newPaymentGateway(cfg config.PaymentConfig) payment.Gateway {
+	switch cfg.Gateway {
+	case config.PaymentGatewayFake:
+		log.Println("WARNING: using the fake payment gateway; orders are marked paid without taking any money")
+		return payment.NewFake()
+	}
+	log.Fatalf("Unsupported payment gateway %q", cfg.Gateway)
+	return nil
+}
+
+// migrateOnStart applies pending migrations when enabled, otherwise it only
+// warns about them. Concurrent replicas serialize on the migration lock.
+func migrateOnStart(enabled bool) {
+	runner := database.NewRunner(config.DB)
+	if enabled {
+		ran, err := runner.Up()
+		if err != nil {
+			log.Fatal("Failed to migrate database: ", err)
+		}
+		for _, m := range ran {
+			log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+		}
+		return
+	}
+
+	pending, err := runner.Pending()
+	if err != nil {
+		log.Println("Could not check migration status:", err)
+		return
+	}
+	if len(pending) > 0 {
+		log.Printf("WARNING: %d pending migration(s); run `go run ./cmd/migrate up` or set MIGRATE_ON_START=true", len(pending))
+	}
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"crypto/rand"
+	"log"
+	"os"
+	"strings"
+)
+
+// Blob storage drivers selected by BLOB_DRIVER
+const (
+	BlobDriverLocal = "local"
+	BlobDriverS3    = "s3"
+)
+
+// BlobConfig selects where uploaded files such as item images are kept.
+type BlobConfig struct {
+	Driver string
+
+	// LocalDir and LocalURLPrefix configure the local driver, which serves
+	// files itself under LocalURLPrefix. URLSecret signs those URLs.
+	LocalDir       string
+	LocalURLPrefix string
+	URLSecret      []byte
+
+	// The S3 settings configure the s3 driver.
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PathStyle bool
+}
+
+// LoadBlobConfig reads BLOB_DRIVER (local by default) and the settings for
+// the selected driver.
+func LoadBlobConfig() BlobConfig {
+	cfg := BlobConfig{
+		Driver: strings.ToLower(getenv("BLOB_DRIVER", BlobDriverLocal)),
+	}
+	switch cfg.Driver {
+	case BlobDriverLocal:
+		cfg.LocalDir = getenv("BLOB_LOCAL_DIR", getenv("IMAGE_DIR", "static/images"))
+		cfg.LocalURLPrefix = getenv("BLOB_LOCAL_URL_PREFIX", "/static/images")
+		if secret := os.Getenv("BLOB_URL_SECRET"); secret != "" {
+			cfg.URLSecret = []byte(secret)
+		} else {
+			// URLs signed by one replica won't verify on another like this
+			log.Println("WARNING: BLOB_URL_SECRET is not set; using a random secret for this process")
+			cfg.URLSecret = make([]byte, 32)
+			if _, err := rand.Read(cfg.URLSecret); err != nil {
+				log.Fatal("Failed to generate blob URL secret:", err)
+			}
+		}
+	case BlobDriverS3:
+		cfg.S3Endpoint = getenv("S3_ENDPOINT", "https://s3.amazonaws.com")
+		cfg.S3Region = getenv("S3_REGION", "us-east-1")
+		cfg.S3Bucket = os.Getenv("S3_BUCKET")
+		cfg.S3AccessKey = os.Getenv("S3_ACCESS_KEY_ID")
+		cfg.S3SecretKey = os.Getenv("S3_SECRET_ACCESS_KEY")
+		cfg.S3PathStyle = getbool("S3_PATH_STYLE", false)
+	default:
+		log.Fatalf("Unknown BLOB_DRIVER %q (want %s or %s)", cfg.Driver, BlobDriverLocal, BlobDriverS3)
+	}
+	return cfg
+}
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"log"
+	"strings"
+
+	"shopping-cart/money"
+)
+
+// CatalogConfig holds settings for the item catalog.
+type CatalogConfig struct {
+	// BaseCurrency is the currency every item is priced in and the one the
+	// exchange-rate table converts from. Changing it invalidates the stored
+	// rates and existing prices, so pick it once.
+	BaseCurrency string
+}
+
+// LoadCatalogConfig reads BASE_CURRENCY. It falls back to DEFAULT_CURRENCY,
+// the currency migration 0007 assumed for legacy prices, and then to USD.
+func LoadCatalogConfig() CatalogConfig {
+	base := strings.ToUpper(getenv("BASE_CURRENCY", getenv("DEFAULT_CURRENCY", money.DefaultCurrency)))
+	if !money.ValidCurrency(base) {
+		log.Fatalf("BASE_CURRENCY %q is not an ISO 4217 currency code", base)
+	}
+	return CatalogConfig{BaseCurrency: base}
+}
@@ -6,9 +6,6 @@ import (
 	"os"
 	"strings"
 
-	"shopping-cart/models"
-
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
 
@@ -21,56 +18,99 @@ func getenv(key, fallback string) string {
 	return fallback
 }
 
+// ConnectDatabase opens the database selected by DB_DRIVER (mysql, postgres
+// or sqlite; mysql by default) and assigns it to DB. The schema is managed
+// by the versioned migrations in package database, not here.
 func ConnectDatabase() {
-	// Allow full DSN override via MYSQL_DSN env var
-	dsn := os.Getenv("MYSQL_DSN")
-	if dsn == "" {
-		user := getenv("DB_USER", "root")
-		pass := os.Getenv("DB_PASS") // do NOT provide a default here - require it for safety
-		host := getenv("DB_HOST", "127.0.0.1")
-		port := getenv("DB_PORT", "3306")
-		name := getenv("DB_NAME", "shopping_cart")
-
-		if strings.TrimSpace(pass) == "" {
-			log.Fatal("No database credentials found. Set MYSQL_DSN or set DB_PASS in environment (see .env.example). Aborting for safety.")
-		}
-
-		dsn = fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", user, pass, host, port, name)
-		// Mask password when logging
-		masked := strings.Replace(dsn, ":"+pass+"@", ":****@", 1)
-		log.Println("Using DB DSN:", masked)
-	} else {
-		// For full DSN provided, do not print the password; mask any @... preceding DB name if possible
-		masked := dsn
-		// attempt to hide credentials between start and @
-		if at := strings.Index(dsn, "@"); at != -1 && strings.Contains(dsn, ":") {
-			// keep scheme after first '@' and mask credentials portion
-			masked = "****@" + dsn[at+1:]
-		}
-		log.Println("Using DB DSN (provided via MYSQL_DSN):", masked)
+	var err error
+	var driver string
+	DB, driver, err = OpenFromEnv()
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	var err error
+	log.Printf("%s database connected successfully", driver)
+}
+
+// OpenFromEnv opens a new connection using the DB_* environment variables
+// without assigning the package-level DB. It also returns the driver name.
+func OpenFromEnv() (*gorm.DB, string, error) {
+	driver := strings.ToLower(getenv("DB_DRIVER", DriverMySQL))
 
-	// Connect to MySQL
-	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	dsn, masked, err := buildDSN(driver)
 	if err != nil {
-		log.Fatal("Failed to connect to MySQL database:", err)
+		return nil, driver, err
 	}
+	log.Printf("Using %s DSN: %s", driver, masked)
 
-	// Run AutoMigrate on all models
-	err = DB.AutoMigrate(
-		&models.User{},
-		&models.Item{},
-		&models.Cart{},
-		&models.CartItem{},
-		&models.Order{},
-		&models.OrderItem{},
-		&models.Session{},
-	)
+	// Connect using the dialector for the selected driver
+	db, err := Open(driver, dsn)
 	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
+		return nil, driver, fmt.Errorf("failed to connect to %s database: %w", driver, err)
+	}
+	return db, driver, nil
+}
+
+// buildDSN returns the DSN for driver along with a copy that is safe to log.
+// A full DSN may be supplied via DATABASE_DSN (or MYSQL_DSN for mysql, kept
+// for backwards compatibility); otherwise it is assembled from DB_* vars.
+func buildDSN(driver string) (dsn, masked string, err error) {
+	dsn = os.Getenv("DATABASE_DSN")
+	if dsn == "" && driver == DriverMySQL {
+		dsn = os.Getenv("MYSQL_DSN")
 	}
+	if dsn != "" {
+		return dsn, maskDSN(dsn), nil
+	}
+
+	if driver == DriverSQLite {
+		path := getenv("SQLITE_PATH", "shopping_cart.db")
+		return path, path, nil
+	}
+
+	user := getenv("DB_USER", "root")
+	pass := os.Getenv("DB_PASS") // do NOT provide a default here - require it for safety
+	host := getenv("DB_HOST", "127.0.0.1")
+	name := getenv("DB_NAME", "shopping_cart")
 
-	log.Println("MySQL database connected and migrated successfully")
+	if strings.TrimSpace(pass) == "" {
+		return "", "", fmt.Errorf("No database credentials found. Set DATABASE_DSN or set DB_PASS in environment (see .env.example), or use DB_DRIVER=sqlite. Aborting for safety.")
+	}
+
+	switch driver {
+	case DriverMySQL:
+		port := getenv("DB_PORT", "3306")
+		dsn = fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", user, pass, host, port, name)
+		masked = strings.Replace(dsn, ":"+pass+"@", ":****@", 1)
+	case DriverPostgres:
+		port := getenv("DB_PORT", "5432")
+		sslmode := getenv("DB_SSLMODE", "disable")
+		dsn = fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s", host, port, user, pass, name, sslmode)
+		masked = strings.Replace(dsn, "password="+pass, "password=****", 1)
+	default:
+		return "", "", fmt.Errorf("unsupported DB_DRIVER %q (expected mysql, postgres or sqlite)", driver)
+	}
+	return dsn, masked, nil
+}
+
+// maskDSN hides the credentials of a user-provided DSN before logging it.
+func maskDSN(dsn string) string {
+	// key=value style (postgres)
+	if strings.Contains(dsn, "password=") {
+		fields := strings.Fields(dsn)
+		for i, f := range fields {
+			if strings.HasPrefix(f, "password=") {
+				fields[i] = "password=****"
+			}
+		}
+		return strings.Join(fields, " ")
+	}
+	// user:pass@... style (mysql, postgres URLs); keep everything after '@'
+	if at := strings.LastIndex(dsn, "@"); at != -1 && strings.Contains(dsn[:at], ":") {
+		if scheme := strings.Index(dsn, "://"); scheme != -1 && scheme < at {
+			return dsn[:scheme+3] + "****@" + dsn[at+1:]
+		}
+		return "****@" + dsn[at+1:]
+	}
+	return dsn
 }
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Supported values for DB_DRIVER
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Dialector returns the gorm dialector for the given driver name and DSN.
+func Dialector(driver, dsn string) (gorm.Dialector, error) {
+	switch driver {
+	case DriverMySQL:
+		return mysql.Open(dsn), nil
+	case DriverPostgres:
+		return postgres.Open(dsn), nil
+	case DriverSQLite:
+		// pure-Go driver so tests and local runs don't need cgo
+		return sqlite.Open(dsn), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+}
+
+// Open connects to the database without touching the package-level DB, which
+// lets tests and tools open their own (e.g. an in-process SQLite file).
+func Open(driver, dsn string) (*gorm.DB, error) {
+	dialector, err := Dialector(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	// TranslateError turns unique violations into gorm.ErrDuplicatedKey,
+	// which the stores map to their own ErrDuplicate
+	db, err := gorm.Open(dialector, &gorm.Config{TranslateError: true})
+	if err != nil {
+		return nil, err
+	}
+	if driver == DriverSQLite {
+		// SQLite allows a single writer; serialize access and enforce FKs
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.SetMaxOpenConns(1)
+		}
+		db.Exec("PRAGMA foreign_keys = ON")
+	}
+	return db, nil
+}
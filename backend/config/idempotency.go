@@ -0,0 +1,35 @@
+package config
+
+import (
+	"log"
+	"time"
+)
+
+// IdempotencyConfig controls how Idempotency-Key responses are kept.
+type IdempotencyConfig struct {
+	// TTL is how long the first response to a key is replayed for retries.
+	// After that the key can be used again for a new request.
+	TTL time.Duration
+	// InFlight is how long a request may hold its key before a retry takes
+	// it over, in case the request was lost to a crash. It should exceed
+	// the longest request, including payment gateway calls.
+	InFlight time.Duration
+}
+
+// LoadIdempotencyConfig reads IDEMPOTENCY_TTL, 24h by default, and
+// IDEMPOTENCY_IN_FLIGHT_TIMEOUT, 1m by default.
+func LoadIdempotencyConfig() IdempotencyConfig {
+	cfg := IdempotencyConfig{
+		TTL:      getduration("IDEMPOTENCY_TTL", 24*time.Hour),
+		InFlight: getduration("IDEMPOTENCY_IN_FLIGHT_TIMEOUT", time.Minute),
+	}
+	if cfg.TTL <= 0 {
+		log.Printf("WARNING: IDEMPOTENCY_TTL must be positive, using 24h")
+		cfg.TTL = 24 * time.Hour
+	}
+	if cfg.InFlight <= 0 {
+		log.Printf("WARNING: IDEMPOTENCY_IN_FLIGHT_TIMEOUT must be positive, using 1m")
+		cfg.InFlight = time.Minute
+	}
+	return cfg
+}
@@ -0,0 +1,30 @@
+package config
+
+import "time"
+
+// ImageConfig controls how uploaded item images are checked, resized and
+// linked to. Where they are stored is up to BlobConfig.
+type ImageConfig struct {
+	// MaxBytes caps the size of an uploaded image file.
+	MaxBytes int64
+	// MaxPixels caps width × height so small files can't expand into huge
+	// bitmaps when decoded.
+	MaxPixels int
+	// MediumSize and ThumbSize bound the longer side of the generated
+	// renditions, in pixels.
+	MediumSize int
+	ThumbSize  int
+	// URLTTL is how long the signed image URLs in responses stay valid.
+	URLTTL time.Duration
+}
+
+// LoadImageConfig reads the IMAGE_* settings.
+func LoadImageConfig() ImageConfig {
+	return ImageConfig{
+		MaxBytes:   int64(getint("IMAGE_MAX_BYTES", 5<<20)),
+		MaxPixels:  getint("IMAGE_MAX_PIXELS", 25_000_000),
+		MediumSize: getint("IMAGE_MEDIUM_SIZE", 600),
+		ThumbSize:  getint("IMAGE_THUMB_SIZE", 150),
+		URLTTL:     getduration("IMAGE_URL_TTL", time.Hour),
+	}
+}
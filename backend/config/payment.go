@@ -0,0 +1,28 @@
+package config
+
+import (
+	"log"
+	"strings"
+)
+
+// Payment gateways selected by PAYMENT_GATEWAY
+const (
+	PaymentGatewayFake = "fake"
+)
+
+// PaymentConfig selects the gateway orders are paid through.
+type PaymentConfig struct {
+	Gateway string
+}
+
+// LoadPaymentConfig reads PAYMENT_GATEWAY. Only the fake sandbox gateway
+// is built in, and it is the default.
+func LoadPaymentConfig() PaymentConfig {
+	cfg := PaymentConfig{
+		Gateway: strings.ToLower(getenv("PAYMENT_GATEWAY", PaymentGatewayFake)),
+	}
+	if cfg.Gateway != PaymentGatewayFake {
+		log.Fatalf("Unknown PAYMENT_GATEWAY %q (want %s)", cfg.Gateway, PaymentGatewayFake)
+	}
+	return cfg
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServerConfig holds the HTTP listener settings read from the environment.
+type ServerConfig struct {
+	Addr              string
+	TLSCertFile       string
+	TLSKeyFile        string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+	MigrateOnStart    bool
+}
+
+// TLSEnabled reports whether both a certificate and a key were configured.
+func (s ServerConfig) TLSEnabled() bool {
+	return s.TLSCertFile != "" && s.TLSKeyFile != ""
+}
+
+func getduration(key string, fallback time.Duration) time.Duration {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Invalid duration %q for %s, using default %s", v, key, fallback)
+		return fallback
+	}
+	return d
+}
+
+func getbool(key string, fallback bool) bool {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("Invalid boolean %q for %s, using default %t", v, key, fallback)
+		return fallback
+	}
+	return b
+}
+
+// LoadServerConfig reads listener settings. HTTP_ADDR takes precedence over
+// PORT so the usual PaaS convention keeps working.
+func LoadServerConfig() ServerConfig {
+	addr := os.Getenv("HTTP_ADDR")
+	if addr == "" {
+		addr = ":" + getenv("PORT", "8080")
+	}
+
+	cfg := ServerConfig{
+		Addr:              addr,
+		TLSCertFile:       os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:        os.Getenv("TLS_KEY_FILE"),
+		ReadTimeout:       getduration("HTTP_READ_TIMEOUT", 15*time.Second),
+		ReadHeaderTimeout: getduration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		WriteTimeout:      getduration("HTTP_WRITE_TIMEOUT", 30*time.Second),
+		IdleTimeout:       getduration("HTTP_IDLE_TIMEOUT", 60*time.Second),
+		ShutdownTimeout:   getduration("HTTP_SHUTDOWN_TIMEOUT", 20*time.Second),
+		MigrateOnStart:    getbool("MIGRATE_ON_START", false),
+	}
+
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		log.Fatal("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	return cfg
+}
+
+// CloseDatabase closes the underlying connection pool of DB, if any.
+func CloseDatabase() error {
+	if DB == nil {
+		return nil
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
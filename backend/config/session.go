@@ -0,0 +1,98 @@
+package config
+
+import (
+	"crypto/rand"
+	"log"
+	"os"
+	"shopping-cart/auth"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Authentication modes selected by AUTH_MODE
+const (
+	// AuthModeSession looks every bearer token up in the sessions table.
+	AuthModeSession = "session"
+	// AuthModeJWT issues short-lived signed access tokens that are verified
+	// without a database round trip; the session's token becomes the
+	// long-lived refresh token.
+	AuthModeJWT = "jwt"
+)
+
+// SessionConfig controls how long login sessions live, how many a user
+// may hold at once, and how requests are authenticated.
+type SessionConfig struct {
+	// Mode is AuthModeSession or AuthModeJWT.
+	Mode string
+	// TTL is how long a session stays valid after login or its last refresh.
+	TTL time.Duration
+	// MaxLifetime caps how far refreshes can extend a session past its
+	// creation; after that the user has to log in again.
+	MaxLifetime time.Duration
+	// MaxPerUser is the number of concurrent sessions (devices) allowed per
+	// user; the least recently used ones are revoked first. 0 means no limit.
+	MaxPerUser int
+	// TokenSecret keys the HMAC under which session tokens are stored.
+	TokenSecret []byte
+
+	// AccessTokenTTL is the lifetime of JWT access tokens (jwt mode only).
+	AccessTokenTTL time.Duration
+	// JWTIssuer is the iss claim set on and required of access tokens.
+	JWTIssuer string
+	// JWTKeys signs and verifies access tokens (jwt mode only).
+	JWTKeys *auth.KeySet
+}
+
+func getint(key string, fallback int) int {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Invalid integer %q for %s, using default %d", v, key, fallback)
+		return fallback
+	}
+	return n
+}
+
+// LoadSessionConfig reads the SESSION_* environment variables.
+func LoadSessionConfig() SessionConfig {
+	cfg := SessionConfig{
+		Mode:        strings.ToLower(getenv("AUTH_MODE", AuthModeSession)),
+		TTL:         getduration("SESSION_TTL", 24*time.Hour),
+		MaxLifetime: getduration("SESSION_MAX_LIFETIME", 30*24*time.Hour),
+		MaxPerUser:  getint("SESSION_MAX_PER_USER", 5),
+	}
+	if secret := os.Getenv("SESSION_TOKEN_SECRET"); secret != "" {
+		cfg.TokenSecret = []byte(secret)
+	} else {
+		// Sessions won't survive a restart (or work across replicas) like this
+		log.Println("WARNING: SESSION_TOKEN_SECRET is not set; using a random secret for this process")
+		cfg.TokenSecret = make([]byte, 32)
+		if _, err := rand.Read(cfg.TokenSecret); err != nil {
+			log.Fatal("Failed to generate session token secret:", err)
+		}
+	}
+	if cfg.MaxLifetime < cfg.TTL {
+		cfg.MaxLifetime = cfg.TTL
+	}
+
+	switch cfg.Mode {
+	case AuthModeSession:
+	case AuthModeJWT:
+		cfg.AccessTokenTTL = getduration("JWT_ACCESS_TTL", 15*time.Minute)
+		cfg.JWTIssuer = getenv("JWT_ISSUER", "shopping-cart")
+		// JWT_SIGNING_KEYS is "kid:alg:base64key,..."; JWT_ACTIVE_KID picks
+		// the signing key, the others only verify (for rotation)
+		keys, err := auth.ParseKeySet(os.Getenv("JWT_SIGNING_KEYS"), os.Getenv("JWT_ACTIVE_KID"))
+		if err != nil {
+			log.Fatal("Invalid JWT_SIGNING_KEYS: ", err)
+		}
+		cfg.JWTKeys = keys
+	default:
+		log.Fatalf("Unsupported AUTH_MODE %q (expected session or jwt)", cfg.Mode)
+	}
+	return cfg
+}
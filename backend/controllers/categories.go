@@ -0,0 +1,283 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"shopping-cart/models"
+	"shopping-cart/store"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Category Controllers
+
+// slugify turns a category name into a URL-friendly slug,
+// e.g. "Men's Shoes" -> "men-s-shoes".
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// categoryTree nests categories under their parents; roots come first in
+// the order given.
+func categoryTree(categories []models.Category) []models.Category {
+	children := map[uint][]models.Category{}
+	var roots []models.Category
+	for _, c := range categories {
+		if c.ParentID == nil {
+			roots = append(roots, c)
+		} else {
+			children[*c.ParentID] = append(children[*c.ParentID], c)
+		}
+	}
+	var attach func(nodes []models.Category) []models.Category
+	attach = func(nodes []models.Category) []models.Category {
+		for i := range nodes {
+			nodes[i].Children = attach(children[nodes[i].ID])
+		}
+		return nodes
+	}
+	if roots == nil {
+		return []models.Category{}
+	}
+	return attach(roots)
+}
+
+// descendantIDs returns id and the IDs of every category below it.
+func descendantIDs(categories []models.Category, id uint) []uint {
+	children := map[uint][]uint{}
+	for _, c := range categories {
+		if c.ParentID != nil {
+			children[*c.ParentID] = append(children[*c.ParentID], c.ID)
+		}
+	}
+	ids := []uint{id}
+	seen := map[uint]bool{id: true}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range children[ids[i]] {
+			if !seen[child] {
+				seen[child] = true
+				ids = append(ids, child)
+			}
+		}
+	}
+	return ids
+}
+
+// categoryError writes the response for an error from creating or
+// updating a category.
+func categoryError(c *gin.Context, err error, action string) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+	case errors.Is(err, store.ErrDuplicate):
+		c.JSON(http.StatusConflict, gin.H{"error": "A category with this slug already exists"})
+	case errors.Is(err, store.ErrParentNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Parent category not found"})
+	case errors.Is(err, store.ErrCategoryCycle):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A category can't be nested under itself or its subcategories"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to " + action + " category"})
+	}
+}
+
+func categoryID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetCategories returns every category as a tree of nested children.
+func (ctl *Controller) GetCategories(c *gin.Context) {
+	categories, err := ctl.categories.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"categories": categoryTree(categories)})
+}
+
+// GetCategoryItems lists the items in a category or any of its
+// subcategories, with the same paging, sorting and filters as GetItems.
+func (ctl *Controller) GetCategoryItems(c *gin.Context) {
+	id, ok := categoryID(c)
+	if !ok {
+		return
+	}
+	categories, err := ctl.categories.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+	var category *models.Category
+	for i := range categories {
+		if categories[i].ID == id {
+			category = &categories[i]
+		}
+	}
+	if category == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+
+	rate, ok := ctl.requestedRate(c, "")
+	if !ok {
+		return
+	}
+	opts, err := listQuery(c)
+	if err == nil {
+		err = ctl.amountParams(c, &opts.Filter, "min_price", "max_price")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	opts.Filter.CategoryIDs = descendantIDs(categories, id)
+
+	page, err := ctl.items.List(opts)
+	if err != nil {
+		listError(c, err, "items")
+		return
+	}
+	for i := range page.Items {
+		if err := setDisplayPrice(&page.Items[i], rate); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert prices"})
+			return
+		}
+		ctl.signImages(&page.Items[i])
+	}
+	resp := pageResponse("items", page)
+	resp["category"] = category
+	resp["currency"] = rate.To
+	c.JSON(http.StatusOK, resp)
+}
+
+type categoryInput struct {
+	Name     string `json:"name" binding:"required,max=100"`
+	Slug     string `json:"slug" binding:"max=120"`
+	ParentID *uint  `json:"parent_id"`
+}
+
+func (in categoryInput) category() models.Category {
+	slug := slugify(in.Slug)
+	if slug == "" {
+		slug = slugify(in.Name)
+	}
+	return models.Category{Name: strings.TrimSpace(in.Name), Slug: slug, ParentID: in.ParentID}
+}
+
+// CreateCategory adds a category, optionally under a parent. The slug is
+// derived from the name unless given. Admin only.
+func (ctl *Controller) CreateCategory(c *gin.Context) {
+	var input categoryInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	category := input.category()
+	if category.Slug == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Slug must contain letters or digits"})
+		return
+	}
+	if err := ctl.categories.Create(&category); err != nil {
+		categoryError(c, err, "create")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Category created successfully", "category": category})
+}
+
+// UpdateCategory renames or moves a category. Admin only.
+func (ctl *Controller) UpdateCategory(c *gin.Context) {
+	id, ok := categoryID(c)
+	if !ok {
+		return
+	}
+	var input categoryInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	category := input.category()
+	category.ID = id
+	if category.Slug == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Slug must contain letters or digits"})
+		return
+	}
+	if err := ctl.categories.Update(&category); err != nil {
+		categoryError(c, err, "update")
+		return
+	}
+	if updated, err := ctl.categories.Get(id); err == nil {
+		category = *updated
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Category updated successfully", "category": category})
+}
+
+// DeleteCategory removes an empty-of-subcategories category; its items
+// simply lose the assignment. Admin only.
+func (ctl *Controller) DeleteCategory(c *gin.Context) {
+	id, ok := categoryID(c)
+	if !ok {
+		return
+	}
+	if err := ctl.categories.Delete(id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		case errors.Is(err, store.ErrHasChildren):
+			c.JSON(http.StatusConflict, gin.H{"error": "Move or delete the subcategories first"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
+}
+
+// SetItemCategories replaces the categories an item is assigned to. An
+// empty list removes it from every category. Admin only.
+func (ctl *Controller) SetItemCategories(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var input struct {
+		CategoryIDs []uint `json:"category_ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := ctl.categories.SetItemCategories(uint(id), input.CategoryIDs); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Item or category not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign categories"})
+		return
+	}
+	item, err := ctl.items.Get(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch item"})
+		return
+	}
+	ctl.signImages(item)
+	c.JSON(http.StatusOK, gin.H{"message": "Categories updated", "item": item})
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"net/http"
+	"shopping-cart/models"
+	"shopping-cart/money"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Reasons a cart line changed since it was added
+const (
+	changePrice       = "price_changed"
+	changeUnavailable = "unavailable"
+)
+
+// cartChange describes a cart line that no longer matches what the
+// shopper saw when adding it. Prices are unit prices in the base currency.
+type cartChange struct {
+	CartItemID uint         `json:"cart_item_id"`
+	ItemID     uint         `json:"item_id"`
+	VariantID  *uint        `json:"variant_id,omitempty"`
+	Name       string       `json:"name,omitempty"`
+	Reason     string       `json:"reason"`
+	OldPrice   money.Money  `json:"old_price"`
+	NewPrice   *money.Money `json:"new_price,omitempty"`
+}
+
+// cartChanges compares each line of items with the price it was added at
+// and reports those whose price changed or whose item or variant has been
+// deleted.
+func cartChanges(items []models.CartItem) []cartChange {
+	changes := []cartChange{}
+	for _, ci := range items {
+		change := cartChange{CartItemID: ci.ID, ItemID: ci.ItemID, VariantID: ci.VariantID, Name: ci.Item.Name, OldPrice: ci.Price}
+		if !ci.Available() {
+			change.Reason = changeUnavailable
+		} else if price := ci.UnitPrice(); price != ci.Price {
+			change.Reason, change.NewPrice = changePrice, &price
+		} else {
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// cartChanged answers a checkout of cart that found changes with 409. The
+// cart is first brought up to date, repricing changed lines and dropping
+// unavailable ones, so checking out again confirms exactly what the
+// response showed.
+func (ctl *Controller) cartChanged(c *gin.Context, cart *models.Cart, changes []cartChange) {
+	prices := map[uint]money.Money{}
+	var removed []uint
+	for _, change := range changes {
+		if change.NewPrice != nil {
+			prices[change.CartItemID] = *change.NewPrice
+		} else {
+			removed = append(removed, change.CartItemID)
+		}
+	}
+	if err := ctl.carts.SyncLines(cart.ID, prices, removed); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart"})
+		return
+	}
+	if updated, err := ctl.carts.Get(cart.ID); err == nil {
+		cart = updated
+	}
+	ctl.signCartImages(cart)
+	c.JSON(http.StatusConflict, gin.H{"error": "Cart changed since items were added; check out again to confirm", "changes": changes, "cart": cart})
+}
@@ -1,25 +1,82 @@
 package controllers
 
 import (
-	"encoding/base64"
-	"io/ioutil"
+	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
-	"os"
-	"path/filepath"
+	"shopping-cart/auth"
+	"shopping-cart/blob"
 	"shopping-cart/config"
+	"shopping-cart/images"
 	"shopping-cart/models"
+	"shopping-cart/money"
+	"shopping-cart/payment"
+	"shopping-cart/search"
+	"shopping-cart/store"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Controller holds the handlers' dependencies. Build it with NewController.
+type Controller struct {
+	users      store.UserStore
+	items      store.ItemStore
+	carts      store.CartStore
+	orders     store.OrderStore
+	sessions   store.SessionStore
+	rates      store.RateStore
+	categories store.CategoryStore
+	variants   store.VariantStore
+	itemImages store.ItemImageStore
+	payments   store.PaymentStore
+	search     search.Index
+	blobs      blob.Store
+	gateway    payment.Gateway
+
+	sessionCfg config.SessionConfig
+	catalogCfg config.CatalogConfig
+	imageCfg   config.ImageConfig
+	tokens     *auth.TokenHasher
+}
+
+// NewController returns a Controller backed by the given stores.
+func NewController(s store.Stores, sessionCfg config.SessionConfig, catalogCfg config.CatalogConfig, imageCfg config.ImageConfig, blobs blob.Store, gateway payment.Gateway, idx search.Index) *Controller {
+	return &Controller{
+		users:      s.Users,
+		items:      s.Items,
+		carts:      s.Carts,
+		orders:     s.Orders,
+		sessions:   s.Sessions,
+		rates:      s.Rates,
+		categories: s.Categories,
+		variants:   s.Variants,
+		itemImages: s.ItemImages,
+		payments:   s.Payments,
+		search:     idx,
+		blobs:      blobs,
+		gateway:    gateway,
+		sessionCfg: sessionCfg,
+		catalogCfg: catalogCfg,
+		imageCfg:   imageCfg,
+		tokens:     auth.NewTokenHasher(sessionCfg.TokenSecret),
+	}
+}
+
+// currentUser returns the authenticated user set by AuthMiddleware
+func currentUser(c *gin.Context) models.User {
+	value, _ := c.Get("user")
+	user, _ := value.(models.User)
+	return user
+}
+
 // User Controllers
 
-func CreateUser(c *gin.Context) {
+func (ctl *Controller) CreateUser(c *gin.Context) {
 	var input struct {
 		Username string `json:"username" binding:"required"`
 		Password string `json:"password" binding:"required"`
@@ -40,9 +97,10 @@ func CreateUser(c *gin.Context) {
 	user := models.User{
 		Username: input.Username,
 		Password: string(hashedPassword),
+		Role:     models.RoleCustomer,
 	}
 
-	if err := config.DB.Create(&user).Error; err != nil {
+	if err := ctl.users.Create(&user); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Username already exists"})
 		return
 	}
@@ -50,13 +108,23 @@ func CreateUser(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"message": "User created successfully", "user": user})
 }
 
-func GetUsers(c *gin.Context) {
-	var users []models.User
-	config.DB.Find(&users)
-	c.JSON(http.StatusOK, gin.H{"users": users})
+// GetUsers lists users a page at a time. Sort keys: id, username,
+// created_at. Admin only.
+func (ctl *Controller) GetUsers(c *gin.Context) {
+	opts, err := listQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := ctl.users.List(opts)
+	if err != nil {
+		listError(c, err, "users")
+		return
+	}
+	c.JSON(http.StatusOK, pageResponse("users", page))
 }
 
-func LoginUser(c *gin.Context) {
+func (ctl *Controller) LoginUser(c *gin.Context) {
 	var input struct {
 		Username string `json:"username" binding:"required"`
 		Password string `json:"password" binding:"required"`
@@ -67,8 +135,8 @@ func LoginUser(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := config.DB.Where("username = ?", input.Username).First(&user).Error; err != nil {
+	user, err := ctl.users.GetByUsername(input.Username)
+	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
 		return
 	}
@@ -79,43 +147,66 @@ func LoginUser(c *gin.Context) {
 		return
 	}
 
-	// Invalidate previous sessions for this user (single active session requirement)
-	config.DB.Where("user_id = ?", user.ID).Delete(&models.Session{})
+	// Make room for the new device if the user is at the session cap
+	if err := ctl.pruneSessions(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
 
-	// Create a new session
-	token := uuid.New().String()
+	// Create a new session. The plaintext token is returned only in this
+	// response; the store keeps its hash.
+	token, err := auth.NewToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
 	now := time.Now()
-	// You can set an expiry if desired; leaving nil means no expiry
+	expiresAt := now.Add(ctl.sessionCfg.TTL)
 	session := models.Session{
-		UserID:    user.ID,
-		Token:     token,
-		CreatedAt: now,
-	}
-	if err := config.DB.Create(&session).Error; err != nil {
+		UserID:     user.ID,
+		TokenHash:  ctl.tokens.Hash(token),
+		UserAgent:  truncate(c.Request.UserAgent(), 255),
+		IPAddress:  c.ClientIP(),
+		CreatedAt:  now,
+		LastUsedAt: &now,
+		ExpiresAt:  &expiresAt,
+	}
+	if err := ctl.sessions.Create(&session); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Login successful",
-		"token":   token,
-		"user_id": user.ID,
-	})
+	resp := gin.H{
+		"message":    "Login successful",
+		"token":      token,
+		"user_id":    user.ID,
+		"session_id": session.ID,
+		"expires_at": expiresAt,
+	}
+
+	// In jwt mode the session token becomes the refresh token and "token"
+	// carries the short-lived access token used on every request
+	if ctl.sessionCfg.Mode == config.AuthModeJWT {
+		access, accessExpiresAt, err := ctl.signAccessToken(user, session.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue access token"})
+			return
+		}
+		resp["token"] = access
+		resp["access_token"] = access
+		resp["access_token_expires_at"] = accessExpiresAt
+		resp["refresh_token"] = token
+	}
+
+	c.JSON(http.StatusOK, resp)
 }
 
 // LogoutUser deletes the session associated with the provided token
-func LogoutUser(c *gin.Context) {
-	// Read Authorization header
-	authHeader := c.GetHeader("Authorization")
-	parts := strings.Split(authHeader, " ")
-	if len(parts) != 2 || parts[0] != "Bearer" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authorization header"})
-		return
-	}
-	token := parts[1]
+func (ctl *Controller) LogoutUser(c *gin.Context) {
+	// AuthMiddleware already resolved the bearer token to its session
+	sessionID, _ := c.Get("session_id")
 
-	// Delete the session with this token
-	if err := config.DB.Where("token = ?", token).Delete(&models.Session{}).Error; err != nil {
+	if err := ctl.sessions.Delete(sessionID.(uint)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
 		return
 	}
@@ -123,158 +214,299 @@ func LogoutUser(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
+// UpdateUserRole changes a user's role. Admin only.
+func (ctl *Controller) UpdateUserRole(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var input struct {
+		Role string `json:"role" binding:"required,oneof=customer admin"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Don't let an admin lock themselves out
+	if uint(id) == currentUser(c).ID && input.Role != models.RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Admins cannot remove their own admin role"})
+		return
+	}
+
+	if err := ctl.users.SetRole(uint(id), input.Role); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated"})
+}
+
 // Item Controllers
 
-func CreateItem(c *gin.Context) {
+// CreateItem adds an item to the catalog. The body is either JSON, with an
+// optional base64 image in image_data, or multipart/form-data with the
+// same fields and the image as a file in "image". Admin only.
+func (ctl *Controller) CreateItem(c *gin.Context) {
 	var input struct {
-		Name        string  `json:"name" binding:"required"`
-		Price       float64 `json:"price" binding:"required"`
-		Description string  `json:"description"`
-		ImageData   string  `json:"image_data"`
+		Name        string      `json:"name" form:"name" binding:"required"`
+		Price       json.Number `json:"price" form:"price" binding:"required"`
+		Currency    string      `json:"currency" form:"currency"`
+		Description string      `json:"description" form:"description"`
+		ImageData   string      `json:"image_data"`
+		MaxPerOrder int         `json:"max_per_order" form:"max_per_order" binding:"min=0"`
+		Stock       int         `json:"stock" form:"stock" binding:"min=0"`
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
+	ctl.limitBody(c)
+	multipart := c.ContentType() == gin.MIMEMultipartPOSTForm
+	var err error
+	if multipart {
+		err = c.ShouldBind(&input)
+	} else {
+		err = c.ShouldBindJSON(&input)
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			imageError(c, images.ErrTooLarge)
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	var imageData []byte
+	if multipart {
+		imageData, err = ctl.readImageUpload(c)
+		if errors.Is(err, errNoImage) {
+			err = nil
+		}
+	} else if strings.TrimSpace(input.ImageData) != "" {
+		imageData, err = ctl.decodeImageData(input.ImageData)
+	}
+	if err != nil {
+		imageError(c, err)
+		return
+	}
+
+	// Items are always priced in the base currency; other currencies are
+	// derived from the exchange-rate table when displaying
+	base := ctl.catalogCfg.BaseCurrency
+	if cur := strings.ToUpper(strings.TrimSpace(input.Currency)); cur != "" && cur != base {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Items must be priced in the base currency " + base})
+		return
+	}
+	// Parse the decimal string directly so prices never pass through float64
+	price, err := money.Parse(input.Price.String(), base)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !price.IsPositive() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Price must be greater than zero"})
+		return
+	}
+
 	item := models.Item{
 		Name:        input.Name,
-		Price:       input.Price,
+		Price:       price,
 		Description: input.Description,
+		MaxPerOrder: input.MaxPerOrder,
 	}
 
-	// If image data was provided (base64), decode and save it
-	if strings.TrimSpace(input.ImageData) != "" {
-		// ensure static/images directory exists
-		imgDir := filepath.Join("static", "images")
-		if err := os.MkdirAll(imgDir, 0755); err == nil {
-			// image data may be like: data:image/png;base64,XXXXX -- strip prefix
-			commaIndex := strings.Index(input.ImageData, ",")
-			raw := input.ImageData
-			if commaIndex != -1 {
-				raw = input.ImageData[commaIndex+1:]
-			}
-			decoded, err := base64.StdEncoding.DecodeString(raw)
-			if err == nil {
-				fname := uuid.New().String() + ".png"
-				fpath := filepath.Join(imgDir, fname)
-				if err := ioutil.WriteFile(fpath, decoded, 0644); err == nil {
-					// set ImageURL to be served from /static/images/
-					item.ImageURL = "/static/images/" + fname
-				}
-			}
+	ctx := c.Request.Context()
+	var image *models.ItemImage
+	if imageData != nil {
+		if image, err = ctl.saveImage(ctx, imageData); err != nil {
+			imageError(c, err)
+			return
 		}
 	}
 
-	if err := config.DB.Create(&item).Error; err != nil {
+	if err := ctl.items.Create(&item); err != nil {
+		if image != nil {
+			ctl.removeImage(ctx, *image)
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create item"})
 		return
 	}
+	ctl.indexItem(item)
+
+	// The uploaded image starts the item's gallery
+	item.Images = []models.ItemImage{}
+	if image != nil {
+		image.ItemID, image.AltText = item.ID, item.Name
+		if err := ctl.itemImages.Add(image); err != nil {
+			ctl.removeImage(ctx, *image)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save image"})
+			return
+		}
+		item.Images = append(item.Images, *image)
+	}
 
+	// Opening stock goes through the audit trail like any other change
+	if input.Stock > 0 {
+		actorID := currentUser(c).ID
+		movement := models.StockMovement{Reason: models.StockReasonInitial, UserID: &actorID}
+		if err := ctl.items.AdjustStock(item.ID, input.Stock, &movement); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set initial stock"})
+			return
+		}
+		item.Stock = movement.StockAfter
+	}
+
+	ctl.signImages(&item)
+	c.Header("ETag", itemETag(item))
 	c.JSON(http.StatusCreated, gin.H{"message": "Item created successfully", "item": item})
 }
 
-func GetItems(c *gin.Context) {
-	var items []models.Item
-	config.DB.Find(&items)
-	c.JSON(http.StatusOK, gin.H{"items": items})
+// GetItems lists the catalog a page at a time. Sort keys: id, name, price,
+// created_at. min_price and max_price filter on the base-currency price.
+func (ctl *Controller) GetItems(c *gin.Context) {
+	rate, ok := ctl.requestedRate(c, "")
+	if !ok {
+		return
+	}
+	opts, err := listQuery(c)
+	if err == nil {
+		err = ctl.amountParams(c, &opts.Filter, "min_price", "max_price")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := ctl.items.List(opts)
+	if err != nil {
+		listError(c, err, "items")
+		return
+	}
+	for i := range page.Items {
+		if err := setDisplayPrice(&page.Items[i], rate); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert prices"})
+			return
+		}
+		ctl.signImages(&page.Items[i])
+	}
+	resp := pageResponse("items", page)
+	resp["currency"] = rate.To
+	c.JSON(http.StatusOK, resp)
 }
 
 // Cart Controllers
 
-func AddToCart(c *gin.Context) {
+func (ctl *Controller) AddToCart(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 
 	var input struct {
-		ItemID uint `json:"item_id" binding:"required"`
+		ItemID    uint  `json:"item_id" binding:"required"`
+		VariantID *uint `json:"variant_id"`
+		Quantity  int   `json:"quantity" binding:"omitempty,min=1"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if input.Quantity == 0 {
+		input.Quantity = 1
+	}
 
 	// Check if item exists
-	var item models.Item
-	if err := config.DB.First(&item, input.ItemID).Error; err != nil {
+	item, err := ctl.items.Get(input.ItemID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
 		return
 	}
-
-	// Get or create cart for user in a transaction to avoid races
-	var cart models.Cart
-	tx := config.DB.Begin()
-	if tx.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start DB transaction"})
+	// Items with variants can only be bought as one of them
+	variant, ok := selectVariant(c, item, input.VariantID)
+	if !ok {
 		return
 	}
-	if err := tx.Where("user_id = ?", userID).First(&cart).Error; err != nil {
-		// not found -> create
-		cart = models.Cart{UserID: userID.(uint)}
-		if err := tx.Create(&cart).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create cart"})
-			return
-		}
+	price := item.Price
+	if variant != nil {
+		price = variant.Price(*item)
 	}
 
-	// Check if item already in cart
-	var existingCartItem models.CartItem
-	if err := tx.Where("cart_id = ? AND item_id = ?", cart.ID, input.ItemID).First(&existingCartItem).Error; err == nil {
-		// Update quantity
-		existingCartItem.Quantity++
-		if err := tx.Save(&existingCartItem).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart item"})
+	// Get or create the cart and add the item (atomic in the store)
+	limit := item.QuantityLimit()
+	cartItem, created, err := ctl.carts.AddItem(userID.(uint), input.ItemID, input.VariantID, input.Quantity, limit, price)
+	if err != nil {
+		if errors.Is(err, store.ErrQuantityLimit) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Quantity exceeds the per-order limit for this item", "max_per_order": limit})
 			return
 		}
-		tx.Commit()
-		c.JSON(http.StatusOK, gin.H{"message": "Item quantity updated in cart", "cart_item": existingCartItem})
-		return
-	}
-
-	// Add item to cart
-	cartItem := models.CartItem{
-		CartID:   cart.ID,
-		ItemID:   input.ItemID,
-		Quantity: 1,
-	}
-
-	if err := tx.Create(&cartItem).Error; err != nil {
-		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add item to cart"})
 		return
 	}
 
-	if err := tx.Commit().Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit cart transaction"})
+	if !created {
+		c.JSON(http.StatusOK, gin.H{"message": "Item quantity updated in cart", "cart_item": cartItem})
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{"message": "Item added to cart", "cart_item": cartItem})
 }
 
-func GetCarts(c *gin.Context) {
-	var carts []models.Cart
-	config.DB.Preload("Items.Item").Preload("User").Find(&carts)
-	c.JSON(http.StatusOK, gin.H{"carts": carts})
+// GetCarts lists every cart a page at a time. Sort keys: id, created_at,
+// updated_at; user_id filters to one user. Admin only.
+func (ctl *Controller) GetCarts(c *gin.Context) {
+	opts, err := listQuery(c)
+	if err == nil {
+		err = userIDParam(c, &opts.Filter)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := ctl.carts.List(opts)
+	if err != nil {
+		listError(c, err, "carts")
+		return
+	}
+	for i := range page.Items {
+		ctl.signCartImages(&page.Items[i])
+	}
+	c.JSON(http.StatusOK, pageResponse("carts", page))
 }
 
-func GetUserCart(c *gin.Context) {
+func (ctl *Controller) GetUserCart(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 
-	var cart models.Cart
-	if err := config.DB.Preload("Items.Item").Where("user_id = ?", userID).First(&cart).Error; err != nil {
+	rate, ok := ctl.requestedRate(c, "")
+	if !ok {
+		return
+	}
+
+	cart, err := ctl.carts.GetByUser(userID.(uint))
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Cart not found", "cart": models.Cart{Items: []models.CartItem{}}})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"cart": cart})
+	quote, err := quoteCart(cart.Items, rate)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range cart.Items {
+		if rate.From != rate.To {
+			cart.Items[i].Item.DisplayPrice = &quote.Units[i]
+		}
+	}
+
+	ctl.signCartImages(cart)
+	c.JSON(http.StatusOK, gin.H{"cart": cart, "total": quote.Total, "exchange_rate": rate.String(), "changes": cartChanges(cart.Items)})
 }
 
 // GetCartByID returns a cart by its ID. Non-admin users may only fetch their own cart.
-func GetCartByID(c *gin.Context) {
+func (ctl *Controller) GetCartByID(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 
 	idParam := c.Param("id")
@@ -291,23 +523,86 @@ func GetCartByID(c *gin.Context) {
 		return
 	}
 
-	var cart models.Cart
-	if err := config.DB.Preload("Items.Item").Preload("User").First(&cart, uint(cartID)).Error; err != nil {
+	cart, err := ctl.carts.Get(uint(cartID))
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Cart not found"})
 		return
 	}
 
-	// Enforce ownership: only the owner can fetch (no admin concept currently)
-	if cart.UserID != userID.(uint) {
+	// Enforce ownership: only the owner or an admin can fetch
+	if cart.UserID != userID.(uint) && !currentUser(c).IsAdmin() {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Cart does not belong to the authenticated user"})
 		return
 	}
 
+	ctl.signCartImages(cart)
 	c.JSON(http.StatusOK, gin.H{"cart": cart})
 }
 
-// RemoveFromCart removes an item from the authenticated user's cart by item_id
-func RemoveFromCart(c *gin.Context) {
+// UpdateCartItem sets the quantity of an item in the authenticated user's
+// cart; variant_id picks the line for items with variants. A quantity of 0
+// removes the item.
+func (ctl *Controller) UpdateCartItem(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	itemID, err := strconv.ParseUint(c.Param("item_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid item_id"})
+		return
+	}
+	variantID, ok := variantIDParam(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Quantity *int `json:"quantity" binding:"required,min=0"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	quantity := *input.Quantity
+
+	// price is only recorded if this creates the line; an existing line
+	// keeps the price it was added at
+	var price money.Money
+	if quantity > 0 {
+		item, err := ctl.items.Get(uint(itemID))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+			return
+		}
+		variant, ok := selectVariant(c, item, variantID)
+		if !ok {
+			return
+		}
+		if limit := item.QuantityLimit(); quantity > limit {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Quantity exceeds the per-order limit for this item", "max_per_order": limit})
+			return
+		}
+		price = item.Price
+		if variant != nil {
+			price = variant.Price(*item)
+		}
+	}
+
+	cartItem, err := ctl.carts.SetItemQuantity(userID.(uint), uint(itemID), variantID, quantity, price)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart item"})
+		return
+	}
+
+	if cartItem == nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Item removed from cart"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Item quantity updated in cart", "cart_item": cartItem})
+}
+
+// RemoveFromCart removes an item from the authenticated user's cart by
+// item_id, and variant_id for items with variants
+func (ctl *Controller) RemoveFromCart(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 
 	itemIDParam := c.Param("item_id")
@@ -323,16 +618,17 @@ func RemoveFromCart(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid item_id"})
 		return
 	}
-
-	// Find user's cart
-	var cart models.Cart
-	if err := config.DB.Where("user_id = ?", userID).First(&cart).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Cart not found"})
+	variantID, ok := variantIDParam(c)
+	if !ok {
 		return
 	}
 
-	// Delete the cart item for this cart and item id
-	if err := config.DB.Where("cart_id = ? AND item_id = ?", cart.ID, uint(itemID)).Delete(&models.CartItem{}).Error; err != nil {
+	// Delete the cart item from the user's cart
+	if err := ctl.carts.RemoveItem(userID.(uint), uint(itemID), variantID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Cart not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove item from cart"})
 		return
 	}
@@ -342,23 +638,32 @@ func RemoveFromCart(c *gin.Context) {
 
 // Order Controllers
 
-func CreateOrder(c *gin.Context) {
+// CreateOrder places an order for the cart. With a payment_source, the
+// token from the payment gateway's client SDK, the total is charged to it
+// and the order becomes paid; the cart is emptied once it is. Without one
+// the order is placed pending and unpaid, as before payments were taken,
+// and the cart is emptied straight away. Pending orders can't be
+// fulfilled, so clients should send payment_source.
+func (ctl *Controller) CreateOrder(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	// Accept optional cart_id in request body. If not provided, use authenticated user's cart.
 	var input struct {
-		CartID uint `json:"cart_id"`
+		CartID        uint   `json:"cart_id"`
+		Currency      string `json:"currency"`
+		PaymentSource string `json:"payment_source"`
 	}
 	if err := c.ShouldBindJSON(&input); err != nil && err != http.ErrBodyNotAllowed {
 		// if body present but invalid
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	source := strings.TrimSpace(input.PaymentSource)
 
-	var cart models.Cart
+	var cart *models.Cart
 	var err error
 	if input.CartID != 0 {
 		// find cart by id and ensure it belongs to user
-		err = config.DB.Preload("Items.Item").First(&cart, input.CartID).Error
+		cart, err = ctl.carts.Get(input.CartID)
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Cart not found"})
 			return
@@ -369,7 +674,7 @@ func CreateOrder(c *gin.Context) {
 		}
 	} else {
 		// Get user's cart
-		err = config.DB.Preload("Items.Item").Where("user_id = ?", userID).First(&cart).Error
+		cart, err = ctl.carts.GetByUser(userID.(uint))
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Cart not found"})
 			return
@@ -381,170 +686,218 @@ func CreateOrder(c *gin.Context) {
 		return
 	}
 
-	// Use transaction to create order and order items, then clear cart atomically
-	tx := config.DB.Begin()
-	if tx.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start DB transaction"})
+	// Nothing is charged for a cart whose prices changed or whose items
+	// went away since they were added; the shopper sees the changes first
+	if changes := cartChanges(cart.Items); len(changes) > 0 {
+		ctl.cartChanged(c, cart, changes)
 		return
 	}
 
-	// Calculate total
-	var total float64
-	for _, cartItem := range cart.Items {
-		total += cartItem.Item.Price * float64(cartItem.Quantity)
-	}
-
-	order := models.Order{
-		UserID: userID.(uint),
-		Total:  total,
+	rate, ok := ctl.requestedRate(c, input.Currency)
+	if !ok {
+		return
 	}
 
-	if err := tx.Create(&order).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
+	// Price every line in the requested currency and keep the rate used,
+	// so later rate changes don't alter what the customer was charged
+	quote, err := quoteCart(cart.Items, rate)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
 		return
 	}
 
-	for _, cartItem := range cart.Items {
-		orderItem := models.OrderItem{
-			OrderID:  order.ID,
-			ItemID:   cartItem.ItemID,
-			Quantity: cartItem.Quantity,
-			Price:    cartItem.Item.Price,
+	order := models.Order{
+		UserID:       userID.(uint),
+		Total:        quote.Total,
+		BaseTotal:    quote.BaseTotal,
+		ExchangeRate: rate.String(),
+	}
+	for i, cartItem := range cart.Items {
+		line := models.OrderItem{
+			ItemID:    cartItem.ItemID,
+			VariantID: cartItem.VariantID,
+			Quantity:  cartItem.Quantity,
+			Price:     quote.Units[i],
+		}
+		if cartItem.Variant != nil {
+			line.SKU = cartItem.Variant.SKU
 		}
-		if err := tx.Create(&orderItem).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order items"})
+		order.Items = append(order.Items, line)
+	}
+
+	// Authorize before placing the order so nothing is reserved for a
+	// payment that won't go through
+	ctx := c.Request.Context()
+	var authID string
+	if source != "" {
+		authID, err = ctl.gateway.Authorize(ctx, source, order.Total, "cart-"+strconv.FormatUint(uint64(cart.ID), 10))
+		if err != nil {
+			paymentError(c, err, nil)
 			return
 		}
 	}
 
-	if err := tx.Where("cart_id = ?", cart.ID).Delete(&models.CartItem{}).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear cart"})
+	// The store reserves stock and creates the order and its items
+	// atomically
+	if err := ctl.orders.Place(&order); err != nil {
+		if authID != "" {
+			if voidErr := ctl.gateway.Void(ctx, authID); voidErr != nil {
+				log.Printf("payments: failed to void %s: %v", authID, voidErr)
+			}
+		}
+		var outOfStock *store.OutOfStockError
+		if errors.As(err, &outOfStock) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Some items are out of stock", "lines": outOfStock.Lines})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
 		return
 	}
 
-	if err := tx.Commit().Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
-		return
+	// The order only becomes paid once the payment is captured
+	var captureErr error
+	if authID != "" {
+		p := models.Payment{
+			OrderID:   order.ID,
+			Gateway:   ctl.gateway.Name(),
+			Reference: authID,
+			Amount:    order.Total,
+			Refunded:  money.Zero(order.Total.Currency),
+			Status:    models.PaymentStatusAuthorized,
+		}
+		if err := ctl.payments.Create(&p); err != nil {
+			// Without the payment row the money could never be refunded,
+			// so the order is given up rather than captured
+			log.Printf("payments: failed to record authorization %s for order %d: %v", authID, order.ID, err)
+			if voidErr := ctl.gateway.Void(ctx, authID); voidErr != nil {
+				log.Printf("payments: failed to void %s: %v", authID, voidErr)
+			}
+			if err := ctl.orders.Cancel(order.ID, models.OrderStatusPending, "Payment could not be recorded", nil); err != nil {
+				log.Printf("payments: failed to cancel unpaid order %d: %v", order.ID, err)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record payment"})
+			return
+		}
+		captureErr = ctl.capturePayment(ctx, &order, &p)
+	}
+	// A failed payment or an order cancelled during it leaves the cart
+	// alone, so the shopper can try again with it. An order that only
+	// failed to be marked paid has the money, so its cart is emptied.
+	if captureErr == nil || errors.Is(captureErr, errNotMarkedPaid) {
+		lines := make([]uint, len(cart.Items))
+		for i, cartItem := range cart.Items {
+			lines[i] = cartItem.ID
+		}
+		if err := ctl.carts.SyncLines(cart.ID, nil, lines); err != nil {
+			log.Printf("orders: failed to empty cart %d after order %d: %v", cart.ID, order.ID, err)
+		}
 	}
 
 	// Load order with items
-	config.DB.Preload("Items.Item").First(&order, order.ID)
-
-	c.JSON(http.StatusCreated, gin.H{"message": "Order created successfully", "order": order})
-}
-
-func GetOrders(c *gin.Context) {
-	var orders []models.Order
-	config.DB.Preload("Items.Item").Preload("User").Find(&orders)
-	c.JSON(http.StatusOK, gin.H{"orders": orders})
-}
-
-func GetUserOrders(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-
-	var orders []models.Order
-	config.DB.Preload("Items.Item").Where("user_id = ?", userID).Find(&orders)
-	c.JSON(http.StatusOK, gin.H{"orders": orders})
-}
+	if placed, err := ctl.orders.Get(order.ID); err == nil {
+		order = *placed
+	}
+	ctl.signOrderImages(&order)
 
-// DeleteOrder deletes a single order by id if it belongs to the authenticated user
-func DeleteOrder(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-	idParam := c.Param("id")
-	if idParam == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "id is required"})
+	switch {
+	case errors.Is(captureErr, store.ErrInvalidTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": "Order was cancelled during payment", "order": order})
 		return
-	}
-	id, err := strconv.ParseUint(idParam, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+	case errors.Is(captureErr, errNotMarkedPaid):
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Payment captured, but the order could not be marked paid", "order": order})
+		return
+	case captureErr != nil:
+		paymentError(c, captureErr, gin.H{"order": order})
 		return
 	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Order created successfully", "order": order})
+}
 
-	var order models.Order
-	if err := config.DB.Preload("Items").First(&order, uint(id)).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
-		return
+// GetOrders lists every order a page at a time. Sort keys: id, total,
+// created_at; min_total and max_total filter on the base-currency total,
+// status on the order status and user_id to one user. Admin only.
+func (ctl *Controller) GetOrders(c *gin.Context) {
+	opts, err := listQuery(c)
+	if err == nil {
+		err = ctl.amountParams(c, &opts.Filter, "min_total", "max_total")
 	}
-	if order.UserID != userID.(uint) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Order does not belong to the authenticated user"})
-		return
+	if err == nil {
+		err = statusParam(c, &opts.Filter)
 	}
-
-	tx := config.DB.Begin()
-	if tx.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start DB transaction"})
-		return
+	if err == nil {
+		err = userIDParam(c, &opts.Filter)
 	}
-
-	if err := tx.Where("order_id = ?", order.ID).Delete(&models.OrderItem{}).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete order items"})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := tx.Delete(&models.Order{}, order.ID).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete order"})
+	page, err := ctl.orders.List(opts)
+	if err != nil {
+		listError(c, err, "orders")
 		return
 	}
-	if err := tx.Commit().Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
-		return
+	for i := range page.Items {
+		ctl.signOrderImages(&page.Items[i])
 	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "Order deleted"})
+	c.JSON(http.StatusOK, pageResponse("orders", page))
 }
 
-// ClearUserOrders deletes all orders (and their items) belonging to the authenticated user
-func ClearUserOrders(c *gin.Context) {
+// GetUserOrders lists the authenticated user's orders with the same
+// paging, sorting and filters as GetOrders, minus user_id.
+func (ctl *Controller) GetUserOrders(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 
-	var orders []models.Order
-	if err := config.DB.Where("user_id = ?", userID).Find(&orders).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query orders"})
+	opts, err := listQuery(c)
+	if err == nil {
+		err = ctl.amountParams(c, &opts.Filter, "min_total", "max_total")
+	}
+	if err == nil {
+		err = statusParam(c, &opts.Filter)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if len(orders) == 0 {
-		c.JSON(http.StatusOK, gin.H{"message": "No orders to delete"})
+	opts.Filter.UserID = userID.(uint)
+	page, err := ctl.orders.List(opts)
+	if err != nil {
+		listError(c, err, "orders")
 		return
 	}
-
-	ids := make([]uint, 0, len(orders))
-	for _, o := range orders {
-		ids = append(ids, o.ID)
+	for i := range page.Items {
+		ctl.signOrderImages(&page.Items[i])
 	}
+	c.JSON(http.StatusOK, pageResponse("orders", page))
+}
 
-	tx := config.DB.Begin()
-	if tx.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start DB transaction"})
-		return
-	}
+// GetOrderByID returns an order by its ID. Non-admin users may only fetch their own orders.
+func (ctl *Controller) GetOrderByID(c *gin.Context) {
+	userID, _ := c.Get("user_id")
 
-	if err := tx.Where("order_id IN ?", ids).Delete(&models.OrderItem{}).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete order items"})
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
 		return
 	}
 
-	if err := tx.Where("user_id = ?", userID).Delete(&models.Order{}).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete orders"})
+	order, err := ctl.orders.Get(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
 	}
 
-	if err := tx.Commit().Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit transaction"})
+	if order.UserID != userID.(uint) && !currentUser(c).IsAdmin() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Order does not belong to the authenticated user"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "All orders deleted"})
+	ctl.signOrderImages(order)
+	c.JSON(http.StatusOK, gin.H{"order": order})
 }
 
-// DeleteItem removes an item by id. Protected route.
-func DeleteItem(c *gin.Context) {
+// DeleteItem removes an item by id, along with its image gallery. Admin
+// only.
+func (ctl *Controller) DeleteItem(c *gin.Context) {
 	idParam := c.Param("id")
 	if idParam == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "id is required"})
@@ -558,16 +911,21 @@ func DeleteItem(c *gin.Context) {
 	}
 
 	// Check exists
-	var item models.Item
-	if err := config.DB.First(&item, uint(id)).Error; err != nil {
+	item, err := ctl.items.Get(uint(id))
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
 		return
 	}
 
-	if err := config.DB.Delete(&models.Item{}, uint(id)).Error; err != nil {
+	if err := ctl.items.Delete(uint(id)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete item"})
 		return
 	}
+	ctl.unindexItem(uint(id))
+	// Nothing else refers to the item's images, so don't leave them behind
+	for _, image := range item.Images {
+		ctl.removeImage(c.Request.Context(), image)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Item deleted successfully"})
 }
@@ -0,0 +1,685 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"shopping-cart/auth"
+	"shopping-cart/blob"
+	"shopping-cart/config"
+	"shopping-cart/models"
+	"shopping-cart/money"
+	"shopping-cart/payment"
+	"shopping-cart/routes"
+	"shopping-cart/search"
+	"shopping-cart/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testServer is the API wired up as in cmd/server, on the in-memory stores
+// and the fake payment gateway.
+type testServer struct {
+	t       *testing.T
+	handler http.Handler
+	stores  store.Stores
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	return newTestServerWith(t, payment.NewFake())
+}
+
+// newTestServerWith is newTestServer taking payments through gateway.
+func newTestServerWith(t *testing.T, gateway payment.Gateway) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("SESSION_TOKEN_SECRET", "test-secret")
+
+	r := gin.New()
+	s := store.NewMemoryStores()
+	blobs := blob.NewLocal(t.TempDir(), "/files", []byte("test-secret"))
+	routes.SetupRoutes(r, s, config.LoadSessionConfig(), config.LoadCatalogConfig(), config.LoadImageConfig(), blobs, gateway, search.NewMemoryIndex(), config.LoadIdempotencyConfig())
+	return &testServer{t: t, handler: r, stores: s}
+}
+
+// do sends a JSON request as the user holding token and decodes the
+// response body into out, if given.
+func (ts *testServer) do(method, path, token string, body interface{}, out interface{}) int {
+	ts.t.Helper()
+	return ts.send(method, path, token, nil, body, out).Code
+}
+
+// send is do with extra request headers, returning the whole response.
+func (ts *testServer) send(method, path, token string, header http.Header, body interface{}, out interface{}) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			ts.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, req)
+	if out != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			ts.t.Fatalf("%s %s: decoding %q: %v", method, path, w.Body.String(), err)
+		}
+	}
+	return w
+}
+
+// login registers username with role and returns a session token for it.
+func (ts *testServer) login(username, role string) string {
+	ts.t.Helper()
+	creds := gin.H{"username": username, "password": "password123"}
+	if code := ts.do("POST", "/users", "", creds, nil); code != http.StatusCreated {
+		ts.t.Fatalf("register %s: %d", username, code)
+	}
+	if role != models.RoleCustomer {
+		user, _ := ts.stores.Users.GetByUsername(username)
+		if err := ts.stores.Users.SetRole(user.ID, role); err != nil {
+			ts.t.Fatal(err)
+		}
+	}
+	var res struct{ Token string }
+	if code := ts.do("POST", "/users/login", "", creds, &res); code != http.StatusOK {
+		ts.t.Fatalf("login %s: %d", username, code)
+	}
+	return res.Token
+}
+
+// newItem adds an item priced at cents in the base currency.
+func (ts *testServer) newItem(cents int64, stock int) *models.Item {
+	ts.t.Helper()
+	item := &models.Item{Name: "Widget", Price: money.New(cents, money.DefaultCurrency), Stock: stock}
+	if err := ts.stores.Items.Create(item); err != nil {
+		ts.t.Fatal(err)
+	}
+	return item
+}
+
+func (ts *testServer) setPrice(item *models.Item, cents int64) {
+	ts.t.Helper()
+	current, err := ts.stores.Items.Get(item.ID)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	current.Price = money.New(cents, money.DefaultCurrency)
+	if err := ts.stores.Items.Update(current, current.Version, nil); err != nil {
+		ts.t.Fatal(err)
+	}
+}
+
+func (ts *testServer) stock(item *models.Item) int {
+	ts.t.Helper()
+	current, err := ts.stores.Items.Get(item.ID)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	return current.Stock
+}
+
+// cartLines returns the lines in the cart of the user holding token.
+func (ts *testServer) cartLines(token string) []models.CartItem {
+	ts.t.Helper()
+	var res struct {
+		Cart models.Cart `json:"cart"`
+	}
+	ts.do("GET", "/carts/user", token, nil, &res)
+	return res.Cart.Items
+}
+
+type orderResponse struct {
+	Error string       `json:"error"`
+	Order models.Order `json:"order"`
+}
+
+func TestUsersAPI(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.login("shopper", models.RoleCustomer)
+
+	creds := gin.H{"username": "shopper", "password": "password123"}
+	if code := ts.do("POST", "/users", "", creds, nil); code != http.StatusBadRequest {
+		t.Errorf("register a taken username: %d, want 400", code)
+	}
+	wrong := gin.H{"username": "shopper", "password": "wrong"}
+	if code := ts.do("POST", "/users/login", "", wrong, nil); code != http.StatusUnauthorized {
+		t.Errorf("login with a wrong password: %d, want 401", code)
+	}
+
+	if code := ts.do("GET", "/orders/user", "", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("protected route without a token: %d, want 401", code)
+	}
+	if code := ts.do("GET", "/orders/user", token, nil, nil); code != http.StatusOK {
+		t.Errorf("protected route with a token: %d, want 200", code)
+	}
+	if code := ts.do("POST", "/users/logout", token, nil, nil); code != http.StatusOK {
+		t.Errorf("logout: %d", code)
+	}
+	if code := ts.do("GET", "/orders/user", token, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("token after logout: %d, want 401", code)
+	}
+}
+
+func TestAdminRoutesNeedAdminRole(t *testing.T) {
+	ts := newTestServer(t)
+	customer := ts.login("shopper", models.RoleCustomer)
+	admin := ts.login("boss", models.RoleAdmin)
+
+	if code := ts.do("GET", "/users", customer, nil, nil); code != http.StatusForbidden {
+		t.Errorf("list users as a customer: %d, want 403", code)
+	}
+	if code := ts.do("GET", "/users", admin, nil, nil); code != http.StatusOK {
+		t.Errorf("list users as an admin: %d, want 200", code)
+	}
+}
+
+func TestSessionLimit(t *testing.T) {
+	t.Setenv("SESSION_MAX_PER_USER", "2")
+	ts := newTestServer(t)
+	first := ts.login("shopper", models.RoleCustomer)
+
+	creds := gin.H{"username": "shopper", "password": "password123"}
+	var second, third struct{ Token string }
+	ts.do("POST", "/users/login", "", creds, &second)
+	ts.do("GET", "/users/sessions", second.Token, nil, nil)
+	ts.do("POST", "/users/login", "", creds, &third)
+
+	// The third login revokes the least recently used session
+	if code := ts.do("GET", "/users/sessions", first, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("oldest session after the third login: %d, want 401", code)
+	}
+	var res struct {
+		Sessions []struct {
+			ID      uint
+			Current bool
+		}
+	}
+	if code := ts.do("GET", "/users/sessions", third.Token, nil, &res); code != http.StatusOK || len(res.Sessions) != 2 {
+		t.Fatalf("list sessions: %d %+v", code, res.Sessions)
+	}
+
+	// Revoking a session logs that device out
+	other := res.Sessions[0]
+	if other.Current {
+		other = res.Sessions[1]
+	}
+	if code := ts.do("DELETE", "/users/sessions/"+strconv.FormatUint(uint64(other.ID), 10), third.Token, nil, nil); code != http.StatusOK {
+		t.Fatalf("revoke: %d", code)
+	}
+	if code := ts.do("GET", "/users/sessions", second.Token, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("revoked session: %d, want 401", code)
+	}
+	if code := ts.do("POST", "/users/sessions/refresh", third.Token, nil, nil); code != http.StatusOK {
+		t.Errorf("refresh: %d", code)
+	}
+}
+
+func TestSessionTokenStoredHashed(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.login("shopper", models.RoleCustomer)
+
+	user, _ := ts.stores.Users.GetByUsername("shopper")
+	sessions, err := ts.stores.Sessions.ListByUser(user.ID)
+	if err != nil || len(sessions) != 1 {
+		t.Fatalf("sessions: %+v, %v", sessions, err)
+	}
+	hash := auth.NewTokenHasher([]byte("test-secret")).Hash(token)
+	if got := sessions[0].TokenHash; got != hash {
+		t.Errorf("stored %q, want the token's HMAC %q", got, hash)
+	}
+	// The stored value can't be used as a token itself
+	if code := ts.do("GET", "/users/sessions", hash, nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("request with the stored hash: %d, want 401", code)
+	}
+}
+
+func TestAddingMoreKeepsCartPrice(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.login("shopper", models.RoleCustomer)
+	item := ts.newItem(500, 10)
+
+	if code := ts.do("POST", "/carts", token, gin.H{"item_id": item.ID, "quantity": 1}, nil); code != http.StatusCreated {
+		t.Fatalf("first add: %d", code)
+	}
+	ts.setPrice(item, 700)
+	if code := ts.do("POST", "/carts", token, gin.H{"item_id": item.ID, "quantity": 1}, nil); code != http.StatusOK {
+		t.Fatalf("second add: %d", code)
+	}
+
+	if lines := ts.cartLines(token); len(lines) != 1 || lines[0].Quantity != 2 || lines[0].Price.Amount != 500 {
+		t.Fatalf("cart lines: %+v", lines)
+	}
+
+	// Checkout shows the price change instead of charging the new price
+	if code := ts.do("POST", "/orders", token, gin.H{"payment_source": "tok_ok"}, nil); code != http.StatusConflict {
+		t.Errorf("checkout after a price change: %d, want 409", code)
+	}
+}
+
+func TestCheckout(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		wantCode   int
+		wantStatus string
+		wantStock  int
+		wantLines  int
+	}{
+		{"paid", "tok_ok", http.StatusCreated, models.OrderStatusPaid, 8, 0},
+		{"without a payment source", "", http.StatusCreated, models.OrderStatusPending, 8, 0},
+		{"declined", payment.FakeSourceDeclined, http.StatusPaymentRequired, "", 10, 1},
+		{"capture fails", payment.FakeSourceCaptureFails, http.StatusPaymentRequired, models.OrderStatusCancelled, 10, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			token := ts.login("shopper", models.RoleCustomer)
+			item := ts.newItem(500, 10)
+			ts.do("POST", "/carts", token, gin.H{"item_id": item.ID, "quantity": 2}, nil)
+
+			var res orderResponse
+			code := ts.do("POST", "/orders", token, gin.H{"payment_source": tt.source}, &res)
+			if code != tt.wantCode {
+				t.Fatalf("checkout: %d (%s), want %d", code, res.Error, tt.wantCode)
+			}
+			if tt.wantStatus != "" {
+				orders, _ := ts.stores.Orders.List(store.ListOptions{})
+				if len(orders.Items) != 1 || orders.Items[0].Status != tt.wantStatus {
+					t.Errorf("orders: %+v, want one %s", orders.Items, tt.wantStatus)
+				}
+			}
+			if got := ts.stock(item); got != tt.wantStock {
+				t.Errorf("stock: %d, want %d", got, tt.wantStock)
+			}
+			// A failed payment leaves the cart for another try
+			if lines := ts.cartLines(token); len(lines) != tt.wantLines {
+				t.Errorf("cart has %d lines, want %d", len(lines), tt.wantLines)
+			}
+		})
+	}
+}
+
+// cancellingGateway is the fake gateway with every order cancelled by an
+// admin while its payment is being captured.
+type cancellingGateway struct {
+	payment.Gateway
+	orders store.OrderStore
+}
+
+func (g *cancellingGateway) Capture(ctx context.Context, id string, amount money.Money) error {
+	page, err := g.orders.List(store.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, o := range page.Items {
+		if err := g.orders.Cancel(o.ID, o.Status, "cancelled by support", nil); err != nil {
+			return err
+		}
+	}
+	return g.Gateway.Capture(ctx, id, amount)
+}
+
+func TestCheckoutCancelledDuringCapture(t *testing.T) {
+	gateway := &cancellingGateway{Gateway: payment.NewFake()}
+	ts := newTestServerWith(t, gateway)
+	gateway.orders = ts.stores.Orders
+	token := ts.login("shopper", models.RoleCustomer)
+	item := ts.newItem(500, 10)
+	ts.do("POST", "/carts", token, gin.H{"item_id": item.ID, "quantity": 2}, nil)
+
+	var res orderResponse
+	if code := ts.do("POST", "/orders", token, gin.H{"payment_source": "tok_ok"}, &res); code != http.StatusConflict {
+		t.Fatalf("checkout: %d (%s), want 409", code, res.Error)
+	}
+	if got := res.Order; got.Status != models.OrderStatusCancelled || len(got.Payments) != 1 ||
+		got.Payments[0].Status != models.PaymentStatusRefunded || got.Payments[0].Refunded != got.Total {
+		t.Errorf("order: status %s, payments %+v", got.Status, got.Payments)
+	}
+	if got := ts.stock(item); got != 10 {
+		t.Errorf("stock: %d, want 10", got)
+	}
+	if lines := ts.cartLines(token); len(lines) != 1 {
+		t.Errorf("cart has %d lines, want 1", len(lines))
+	}
+}
+
+func TestCheckoutOutOfStock(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.login("shopper", models.RoleCustomer)
+	admin := ts.login("boss", models.RoleAdmin)
+	item := ts.newItem(500, 3)
+	ts.do("POST", "/carts", token, gin.H{"item_id": item.ID, "quantity": 2}, nil)
+
+	// Someone else's order took stock since the item went into the cart
+	stockPath := "/items/" + strconv.FormatUint(uint64(item.ID), 10) + "/stock"
+	if code := ts.do("POST", stockPath, admin, gin.H{"delta": -2, "note": "sold in store"}, nil); code != http.StatusOK {
+		t.Fatalf("adjust stock: %d", code)
+	}
+	if code := ts.do("POST", stockPath, admin, gin.H{"delta": -2}, nil); code != http.StatusConflict {
+		t.Errorf("adjust below zero: %d, want 409", code)
+	}
+
+	var res struct {
+		Error string
+		Lines []store.StockShortage
+	}
+	if code := ts.do("POST", "/orders", token, gin.H{}, &res); code != http.StatusConflict {
+		t.Fatalf("checkout: %d (%s), want 409", code, res.Error)
+	}
+	if len(res.Lines) != 1 || res.Lines[0].Requested != 2 || res.Lines[0].Available != 1 {
+		t.Errorf("shortage: %+v", res.Lines)
+	}
+	if got := ts.stock(item); got != 1 {
+		t.Errorf("stock: %d, want 1", got)
+	}
+	if lines := ts.cartLines(token); len(lines) != 1 {
+		t.Errorf("cart has %d lines, want 1", len(lines))
+	}
+}
+
+func TestItemPaging(t *testing.T) {
+	ts := newTestServer(t)
+	var ids []uint
+	for _, cents := range []int64{300, 100, 300, 200, 500, 300, 100} {
+		ids = append(ids, ts.newItem(cents, 1).ID)
+	}
+
+	type page struct {
+		Error      string
+		Items      []models.Item
+		NextCursor string `json:"next_cursor"`
+		HasMore    bool   `json:"has_more"`
+	}
+	var got []uint
+	path := "/items?limit=2&sort=-price&min_price=1.50"
+	for pages := 0; ; pages++ {
+		if pages == 5 {
+			t.Fatal("paging didn't end")
+		}
+		var res page
+		if code := ts.do("GET", path, "", nil, &res); code != http.StatusOK {
+			t.Fatalf("GET %s: %d (%s)", path, code, res.Error)
+		}
+		for _, item := range res.Items {
+			got = append(got, item.ID)
+		}
+		if pages == 0 {
+			// Rows added after the first page don't shift the later ones
+			ts.newItem(400, 1)
+		}
+		if res.HasMore != (res.NextCursor != "") {
+			t.Fatalf("has_more %v with next_cursor %q", res.HasMore, res.NextCursor)
+		}
+		if !res.HasMore {
+			break
+		}
+		path = "/items?limit=2&sort=-price&min_price=1.50&cursor=" + res.NextCursor
+	}
+
+	// Highest price first, ties by ID in the same direction, the 1.00
+	// items filtered out
+	want := []uint{ids[4], ids[5], ids[2], ids[0], ids[3]}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("paged IDs %v, want %v", got, want)
+	}
+
+	var first page
+	ts.do("GET", "/items?limit=2&sort=-price", "", nil, &first)
+	for _, path := range []string{
+		"/items?cursor=not-a-cursor",
+		"/items?sort=price&cursor=" + first.NextCursor,
+		"/items?sort=colour",
+		"/items?limit=0",
+		"/items?min_price=abc",
+	} {
+		if code := ts.do("GET", path, "", nil, nil); code != http.StatusBadRequest {
+			t.Errorf("GET %s: %d, want 400", path, code)
+		}
+	}
+}
+
+func TestPatchItem(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.login("boss", models.RoleAdmin)
+	item := ts.newItem(500, 1)
+	path := "/items/" + strconv.FormatUint(uint64(item.ID), 10)
+	patch := func(ifMatch string, body interface{}) *httptest.ResponseRecorder {
+		t.Helper()
+		header := http.Header{"Content-Type": {"application/merge-patch+json"}}
+		if ifMatch != "" {
+			header.Set("If-Match", ifMatch)
+		}
+		return ts.send("PATCH", path, admin, header, body, nil)
+	}
+
+	etag := ts.send("GET", path, "", nil, nil, nil).Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("GET returned no ETag")
+	}
+	if w := patch("", gin.H{"price": "6.00"}); w.Code != http.StatusPreconditionRequired {
+		t.Errorf("without If-Match: %d, want 428", w.Code)
+	}
+
+	// Two admins edit from the same version; the second one loses
+	first := patch(etag, gin.H{"price": "6.00", "description": "Blue"})
+	if first.Code != http.StatusOK || first.Header().Get("ETag") == etag {
+		t.Fatalf("first edit: %d, ETag %q", first.Code, first.Header().Get("ETag"))
+	}
+	stale := patch(etag, gin.H{"price": "7.00"})
+	if stale.Code != http.StatusPreconditionFailed || stale.Header().Get("ETag") != first.Header().Get("ETag") {
+		t.Errorf("edit from a stale ETag: %d, ETag %q", stale.Code, stale.Header().Get("ETag"))
+	}
+
+	// null removes an optional field; absent fields are left alone
+	etag = first.Header().Get("ETag")
+	if w := patch(etag+`, "999"`, gin.H{"description": nil}); w.Code != http.StatusOK {
+		t.Errorf("reset description: %d %s", w.Code, w.Body)
+	}
+	current, _ := ts.stores.Items.Get(item.ID)
+	if current.Description != "" || current.Price.Amount != 600 || current.Name != "Widget" {
+		t.Errorf("item after patches: %+v", current)
+	}
+
+	for _, body := range []gin.H{{"stock": 5}, {"price": nil}, {"name": ""}, {"colour": "red"}, {"price": "0"}} {
+		if w := patch("*", body); w.Code != http.StatusBadRequest {
+			t.Errorf("patch %v: %d, want 400", body, w.Code)
+		}
+	}
+
+	var history struct {
+		PriceHistory []models.PriceChange `json:"price_history"`
+	}
+	ts.do("GET", path+"/price-history", admin, nil, &history)
+	if len(history.PriceHistory) != 1 || history.PriceHistory[0].NewPrice.Amount != 600 {
+		t.Errorf("price history: %+v", history.PriceHistory)
+	}
+}
+
+func TestCreateItemImageSizeLimit(t *testing.T) {
+	t.Setenv("IMAGE_MAX_BYTES", strconv.Itoa(4<<20))
+	ts := newTestServer(t)
+	admin := ts.login("boss", models.RoleAdmin)
+
+	var small bytes.Buffer
+	png.Encode(&small, image.NewGray(image.Rect(0, 0, 4, 4)))
+	// Decoders stop at the PNG's end, so padding makes a valid image of any size
+	padded := func(size int) string {
+		data := append(small.Bytes(), make([]byte, size-small.Len())...)
+		return "data:image/png;base64," + base64.StdEncoding.EncodeToString(data)
+	}
+
+	tests := []struct {
+		name string
+		size int
+		want int
+	}{
+		// Base64 makes this about 5.3MB of JSON, more than the image limit
+		// plus the headroom for the other fields
+		{"at the limit", 4 << 20, http.StatusCreated},
+		{"over the limit", 4<<20 + 1, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		body := gin.H{"name": "Poster", "price": "10.00", "image_data": padded(tt.size)}
+		var res struct{ Error string }
+		if code := ts.do("POST", "/items", admin, body, &res); code != tt.want {
+			t.Errorf("%s: %d (%s), want %d", tt.name, code, res.Error, tt.want)
+		}
+	}
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.login("shopper", models.RoleCustomer)
+	admin := ts.login("boss", models.RoleAdmin)
+	item := ts.newItem(500, 10)
+	ts.do("POST", "/carts", token, gin.H{"item_id": item.ID, "quantity": 1}, nil)
+
+	var placed orderResponse
+	if code := ts.do("POST", "/orders", token, gin.H{}, &placed); code != http.StatusCreated {
+		t.Fatalf("checkout: %d (%s)", code, placed.Error)
+	}
+	orderPath := "/orders/" + strconv.FormatUint(uint64(placed.Order.ID), 10)
+	path := orderPath + "/status"
+
+	var conflict struct {
+		Error   string
+		Allowed []string
+	}
+	if code := ts.do("POST", path, admin, gin.H{"status": "shipped"}, &conflict); code != http.StatusConflict ||
+		fmt.Sprint(conflict.Allowed) != "[paid cancelled]" {
+		t.Errorf("pending to shipped: %d, allowed %v", code, conflict.Allowed)
+	}
+	for _, status := range []string{"cancelled", "paid", "lost"} {
+		if code := ts.do("POST", path, admin, gin.H{"status": status}, nil); code != http.StatusBadRequest {
+			t.Errorf("status %s: %d, want 400", status, code)
+		}
+	}
+	if code := ts.do("POST", path, token, gin.H{"status": "fulfilled"}, nil); code != http.StatusForbidden {
+		t.Errorf("as a customer: %d, want 403", code)
+	}
+
+	ts.stores.Orders.Transition(placed.Order.ID, models.OrderStatusPending, models.OrderStatusPaid, nil, "")
+	var res orderResponse
+	if code := ts.do("POST", path, admin, gin.H{"status": "fulfilled", "note": "packed"}, &res); code != http.StatusOK ||
+		res.Order.Status != models.OrderStatusFulfilled {
+		t.Fatalf("paid to fulfilled: %d (%s) %s", code, res.Error, res.Order.Status)
+	}
+
+	// The customer sees the history of their order
+	var mine orderResponse
+	ts.do("GET", orderPath, token, nil, &mine)
+	history := mine.Order.StatusHistory
+	if len(history) != 3 || history[2].To != models.OrderStatusFulfilled || history[2].Note != "packed" {
+		t.Errorf("status history: %+v", history)
+	}
+}
+
+// downGateway is the fake gateway with refunds failing while down is set,
+// as during a provider outage.
+type downGateway struct {
+	payment.Gateway
+	down bool
+}
+
+func (g *downGateway) Refund(ctx context.Context, id string, amount money.Money) error {
+	if g.down {
+		return errors.New("gateway unavailable")
+	}
+	return g.Gateway.Refund(ctx, id, amount)
+}
+
+func TestCancelRefundsOnce(t *testing.T) {
+	ts := newTestServer(t)
+	token := ts.login("shopper", models.RoleCustomer)
+	item := ts.newItem(500, 10)
+	ts.do("POST", "/carts", token, gin.H{"item_id": item.ID, "quantity": 2}, nil)
+
+	var placed orderResponse
+	if code := ts.do("POST", "/orders", token, gin.H{"payment_source": "tok_ok"}, &placed); code != http.StatusCreated {
+		t.Fatalf("checkout: %d (%s)", code, placed.Error)
+	}
+	path := "/orders/" + strconv.FormatUint(uint64(placed.Order.ID), 10) + "/cancel"
+
+	var cancelled orderResponse
+	if code := ts.do("POST", path, token, gin.H{"reason": "changed my mind"}, &cancelled); code != http.StatusOK {
+		t.Fatalf("cancel: %d (%s)", code, cancelled.Error)
+	}
+	if got := cancelled.Order; got.Status != models.OrderStatusCancelled || len(got.Payments) != 1 ||
+		got.Payments[0].Status != models.PaymentStatusRefunded || got.Payments[0].Refunded != got.Total {
+		t.Errorf("cancelled order: status %s, payments %+v", got.Status, got.Payments)
+	}
+	if got := ts.stock(item); got != 10 {
+		t.Errorf("stock after cancelling: %d, want 10", got)
+	}
+
+	// Cancelling again is refused and refunds nothing more
+	if code := ts.do("POST", path, token, gin.H{"reason": "again"}, nil); code != http.StatusConflict {
+		t.Errorf("second cancel: %d, want 409", code)
+	}
+	payments, _ := ts.stores.Payments.ListByOrder(placed.Order.ID)
+	if len(payments) != 1 || payments[0].Refunded != placed.Order.Total {
+		t.Errorf("payments after the second cancel: %+v", payments)
+	}
+}
+
+func TestCancelRetriesFailedRefund(t *testing.T) {
+	gateway := &downGateway{Gateway: payment.NewFake()}
+	ts := newTestServerWith(t, gateway)
+	token := ts.login("shopper", models.RoleCustomer)
+	item := ts.newItem(500, 10)
+	ts.do("POST", "/carts", token, gin.H{"item_id": item.ID, "quantity": 2}, nil)
+
+	var placed orderResponse
+	if code := ts.do("POST", "/orders", token, gin.H{"payment_source": "tok_ok"}, &placed); code != http.StatusCreated {
+		t.Fatalf("checkout: %d (%s)", code, placed.Error)
+	}
+	path := "/orders/" + strconv.FormatUint(uint64(placed.Order.ID), 10) + "/cancel"
+
+	gateway.down = true
+	var res orderResponse
+	if code := ts.do("POST", path, token, gin.H{"reason": "changed my mind"}, &res); code != http.StatusBadGateway {
+		t.Fatalf("cancel during the outage: %d (%s), want 502", code, res.Error)
+	}
+	if got := res.Order; got.Status != models.OrderStatusCancelled || got.Payments[0].Status != models.PaymentStatusCaptured ||
+		got.Payments[0].FailureReason == "" {
+		t.Errorf("order after the failed refund: status %s, payments %+v", got.Status, got.Payments)
+	}
+	if code := ts.do("POST", path, token, gin.H{"reason": "still"}, nil); code != http.StatusBadGateway {
+		t.Errorf("retry during the outage: %d, want 502", code)
+	}
+
+	gateway.down = false
+	if code := ts.do("POST", path, token, gin.H{"reason": "still"}, &res); code != http.StatusOK {
+		t.Fatalf("retry after the outage: %d (%s)", code, res.Error)
+	}
+	if p := res.Order.Payments[0]; p.Status != models.PaymentStatusRefunded || p.Refunded != res.Order.Total {
+		t.Errorf("payment after the retry: %+v", p)
+	}
+	// Retrying changed neither the history nor the stock
+	if len(res.Order.StatusHistory) != 3 || ts.stock(item) != 10 {
+		t.Errorf("history %+v, stock %d", res.Order.StatusHistory, ts.stock(item))
+	}
+	if code := ts.do("POST", path, token, gin.H{"reason": "again"}, nil); code != http.StatusConflict {
+		t.Errorf("cancel once refunded: %d, want 409", code)
+	}
+}
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"shopping-cart/currency"
+	"shopping-cart/models"
+	"shopping-cart/money"
+	"shopping-cart/store"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxRateImportSize bounds an exchange-rate upload.
+const maxRateImportSize = 1 << 20
+
+// errUnknownCurrency is returned when no exchange rate exists for the
+// requested currency.
+var errUnknownCurrency = errors.New("unsupported currency")
+
+// rateFor returns the rate from the base currency to code. An empty code
+// means the base currency itself.
+func (ctl *Controller) rateFor(code string) (money.Rate, error) {
+	base := ctl.catalogCfg.BaseCurrency
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" || code == base {
+		return money.Identity(base), nil
+	}
+	if !money.ValidCurrency(code) {
+		return money.Rate{}, fmt.Errorf("%w %q", errUnknownCurrency, code)
+	}
+	rate, err := ctl.rates.Get(code)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return money.Rate{}, fmt.Errorf("%w %q", errUnknownCurrency, code)
+		}
+		return money.Rate{}, err
+	}
+	return money.ParseRate(base, code, rate.Rate)
+}
+
+// requestedRate resolves the display currency from the currency query
+// parameter (or fallback, when the caller has one from the body) and
+// writes an error response if it can't be used.
+func (ctl *Controller) requestedRate(c *gin.Context, fallback string) (money.Rate, bool) {
+	code := c.Query("currency")
+	if code == "" {
+		code = fallback
+	}
+	rate, err := ctl.rateFor(code)
+	if err != nil {
+		if errors.Is(err, errUnknownCurrency) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load exchange rate"})
+		}
+		return money.Rate{}, false
+	}
+	return rate, true
+}
+
+// setDisplayPrice fills item.DisplayPrice when rate converts away from the
+// base currency.
+func setDisplayPrice(item *models.Item, rate money.Rate) error {
+	if rate.From == rate.To {
+		return nil
+	}
+	price, err := rate.Convert(item.Price)
+	if err != nil {
+		return err
+	}
+	item.DisplayPrice = &price
+	return nil
+}
+
+// cartQuote is a cart priced in one currency.
+type cartQuote struct {
+	// Units are the converted unit prices, one per cart line.
+	Units     []money.Money
+	Total     money.Money
+	BaseTotal money.Money
+}
+
+// quoteCart converts each line's unit price with rate and totals the
+// lines both in the requested and in the base currency. Unit prices are
+// rounded before multiplying so the lines add up to the total. Lines that
+// are no longer available are left out of the totals, with a zero unit.
+func quoteCart(items []models.CartItem, rate money.Rate) (cartQuote, error) {
+	q := cartQuote{Total: money.Zero(rate.To), BaseTotal: money.Zero(rate.From)}
+	for _, cartItem := range items {
+		if !cartItem.Available() {
+			q.Units = append(q.Units, money.Zero(rate.To))
+			continue
+		}
+		price := cartItem.UnitPrice()
+		unit, err := rate.Convert(price)
+		if err != nil {
+			return cartQuote{}, err
+		}
+		line, err := unit.Mul(int64(cartItem.Quantity))
+		if err == nil {
+			q.Total, err = q.Total.Add(line)
+		}
+		if err != nil {
+			return cartQuote{}, err
+		}
+		baseLine, err := price.Mul(int64(cartItem.Quantity))
+		if err == nil {
+			q.BaseTotal, err = q.BaseTotal.Add(baseLine)
+		}
+		if err != nil {
+			return cartQuote{}, err
+		}
+		q.Units = append(q.Units, unit)
+	}
+	return q, nil
+}
+
+// Exchange-rate Controllers
+
+// GetExchangeRates lists the currencies prices can be shown in.
+func (ctl *Controller) GetExchangeRates(c *gin.Context) {
+	rates, err := ctl.rates.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch exchange rates"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"base_currency": ctl.catalogCfg.BaseCurrency, "rates": rates})
+}
+
+// ImportExchangeRates inserts or updates exchange rates. The table is read
+// from a multipart "file" upload (format picked by its extension) or from
+// the request body, as CSV when the Content-Type is text/csv and as JSON
+// otherwise. Currencies not in the upload are left alone. Admin only.
+func (ctl *Controller) ImportExchangeRates(c *gin.Context) {
+	base := ctl.catalogCfg.BaseCurrency
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxRateImportSize)
+
+	var rates []models.ExchangeRate
+	var err error
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		header, ferr := c.FormFile("file")
+		if ferr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			return
+		}
+		f, ferr := header.Open()
+		if ferr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": ferr.Error()})
+			return
+		}
+		defer f.Close()
+		rates, err = currency.Parse(f, currency.FormatFromName(header.Filename), base)
+	} else {
+		format := currency.FormatJSON
+		if c.ContentType() == "text/csv" {
+			format = currency.FormatCSV
+		}
+		rates, err = currency.Parse(c.Request.Body, format, base)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ctl.rates.Upsert(rates); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save exchange rates"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Exchange rates imported", "imported": len(rates), "rates": rates})
+}
+
+// DeleteExchangeRate stops offering a currency. Admin only.
+func (ctl *Controller) DeleteExchangeRate(c *gin.Context) {
+	code := strings.ToUpper(c.Param("currency"))
+	if err := ctl.rates.Delete(code); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Exchange rate not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete exchange rate"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Exchange rate deleted"})
+}
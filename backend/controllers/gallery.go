@@ -0,0 +1,240 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"shopping-cart/images"
+	"shopping-cart/models"
+	"shopping-cart/store"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Gallery Controllers
+
+// maxAltText matches the size of the alt_text column.
+const maxAltText = 255
+
+// galleryImage loads the image named by the :image_id parameter, provided
+// it belongs to the item in :id. It writes an error response and returns
+// nil otherwise.
+func (ctl *Controller) galleryImage(c *gin.Context) *models.ItemImage {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return nil
+	}
+	imageID, err := strconv.ParseUint(c.Param("image_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image_id"})
+		return nil
+	}
+	image, err := ctl.itemImages.Get(uint(imageID))
+	if err != nil || image.ItemID != uint(id) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return nil
+	}
+	return image
+}
+
+// GetItemImages lists an item's gallery in order.
+func (ctl *Controller) GetItemImages(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	item, err := ctl.items.Get(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+
+	ctl.signImages(item)
+	c.JSON(http.StatusOK, gin.H{"images": item.Images})
+}
+
+// AddItemImage appends an image to an item's gallery. The body is either
+// multipart/form-data with the file in "image", or JSON linking an image
+// hosted elsewhere by url. Both take alt_text (the item name by default)
+// and primary. Admin only.
+func (ctl *Controller) AddItemImage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var input struct {
+		URL     string `json:"url"`
+		AltText string `json:"alt_text" form:"alt_text"`
+		Primary bool   `json:"primary" form:"primary"`
+	}
+	ctl.limitBody(c)
+	multipart := c.ContentType() == gin.MIMEMultipartPOSTForm
+	if multipart {
+		err = c.ShouldBind(&input)
+	} else {
+		err = c.ShouldBindJSON(&input)
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			imageError(c, images.ErrTooLarge)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.AltText = strings.TrimSpace(input.AltText)
+	if len(input.AltText) > maxAltText {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Alt text must be at most 255 characters"})
+		return
+	}
+
+	var data []byte
+	if multipart {
+		if data, err = ctl.readImageUpload(c); err != nil {
+			imageError(c, err)
+			return
+		}
+	} else if u, err := url.ParseRequestURI(input.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url must be an absolute http or https URL"})
+		return
+	}
+
+	item, err := ctl.items.Get(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	image := &models.ItemImage{URL: input.URL}
+	if data != nil {
+		if image, err = ctl.saveImage(ctx, data); err != nil {
+			imageError(c, err)
+			return
+		}
+	}
+	image.ItemID, image.AltText, image.Primary = item.ID, input.AltText, input.Primary
+	if image.AltText == "" {
+		image.AltText = item.Name
+	}
+	if err := ctl.itemImages.Add(image); err != nil {
+		ctl.removeImage(ctx, *image)
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save image"})
+		return
+	}
+
+	ctl.signImage(image)
+	c.JSON(http.StatusCreated, gin.H{"message": "Image added successfully", "image": image})
+}
+
+// UpdateItemImage changes an image's alt text or makes it the primary
+// image. An image stops being primary only when another one takes over.
+// Admin only.
+func (ctl *Controller) UpdateItemImage(c *gin.Context) {
+	image := ctl.galleryImage(c)
+	if image == nil {
+		return
+	}
+
+	var input struct {
+		AltText *string `json:"alt_text"`
+		Primary *bool   `json:"primary"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.AltText != nil {
+		image.AltText = strings.TrimSpace(*input.AltText)
+		if len(image.AltText) > maxAltText {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Alt text must be at most 255 characters"})
+			return
+		}
+	}
+	if input.Primary != nil {
+		if !*input.Primary && image.Primary {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Make another image primary instead"})
+			return
+		}
+		image.Primary = *input.Primary
+	}
+
+	if err := ctl.itemImages.Update(image); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update image"})
+		return
+	}
+
+	ctl.signImage(image)
+	c.JSON(http.StatusOK, gin.H{"message": "Image updated successfully", "image": image})
+}
+
+// ReorderItemImages sets the order of an item's gallery. image_ids must
+// list every image of the item exactly once. Admin only.
+func (ctl *Controller) ReorderItemImages(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var input struct {
+		ImageIDs []uint `json:"image_ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := ctl.itemImages.Reorder(uint(id), input.ImageIDs); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		case errors.Is(err, store.ErrImageOrder):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "image_ids must list each of the item's images once"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reorder images"})
+		}
+		return
+	}
+
+	gallery, err := ctl.itemImages.ListByItem(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch images"})
+		return
+	}
+	for i := range gallery {
+		ctl.signImage(&gallery[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Images reordered successfully", "images": gallery})
+}
+
+// DeleteItemImage removes an image from an item's gallery along with its
+// blobs. If it was the primary image, the next one takes over. Admin only.
+func (ctl *Controller) DeleteItemImage(c *gin.Context) {
+	image := ctl.galleryImage(c)
+	if image == nil {
+		return
+	}
+	if err := ctl.itemImages.Delete(image.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete image"})
+		return
+	}
+	ctl.removeImage(c.Request.Context(), *image)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Image deleted successfully"})
+}
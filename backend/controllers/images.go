@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"shopping-cart/images"
+	"shopping-cart/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Image Controllers
+
+// uploadOverhead is allowed on top of the image size for the other
+// fields and the multipart or JSON framing.
+const uploadOverhead = 1 << 20
+
+// errNoImage is returned by readImageUpload when the request has no image.
+var errNoImage = errors.New("no image uploaded")
+
+// limitBody caps the request body at what an image upload may need. JSON
+// bodies carry the image base64 encoded, a third larger than the file.
+func (ctl *Controller) limitBody(c *gin.Context) {
+	limit := ctl.imageCfg.MaxBytes
+	if c.ContentType() != gin.MIMEMultipartPOSTForm {
+		limit = int64(base64.StdEncoding.EncodedLen(int(limit)))
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit+uploadOverhead)
+}
+
+// readImageUpload reads the multipart "image" file. It returns errNoImage if
+// there is none and images.ErrTooLarge if it exceeds the size limit.
+func (ctl *Controller) readImageUpload(c *gin.Context) ([]byte, error) {
+	header, err := c.FormFile("image")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, images.ErrTooLarge
+		}
+		return nil, errNoImage
+	}
+	if header.Size > ctl.imageCfg.MaxBytes {
+		return nil, images.ErrTooLarge
+	}
+	f, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, ctl.imageCfg.MaxBytes+1))
+}
+
+// decodeImageData decodes a base64 image, optionally given as a data URL
+// ("data:image/png;base64,...").
+func (ctl *Controller) decodeImageData(s string) ([]byte, error) {
+	if i := strings.Index(s, ","); i != -1 && strings.HasPrefix(s, "data:") {
+		s = s[i+1:]
+	}
+	s = strings.TrimSpace(s)
+	if int64(len(s)) > int64(base64.StdEncoding.EncodedLen(int(ctl.imageCfg.MaxBytes))) {
+		return nil, images.ErrTooLarge
+	}
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, images.ErrInvalidImage
+	}
+	return data, nil
+}
+
+// imageError writes the response for an error from reading or processing
+// an image.
+func imageError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, images.ErrTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Image is too large"})
+	case errors.Is(err, images.ErrUnsupportedType):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Image must be a JPEG, PNG or GIF", "detail": err.Error()})
+	case errors.Is(err, images.ErrInvalidImage):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Image could not be decoded"})
+	case errors.Is(err, errNoImage):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An image file is required in the \"image\" field"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store image"})
+	}
+}
+
+// saveImage validates data and stores it and its medium and thumbnail
+// renditions as blobs. It returns a gallery image for them, which the
+// caller attaches to an item.
+func (ctl *Controller) saveImage(ctx context.Context, data []byte) (*models.ItemImage, error) {
+	img, err := images.Process(data, images.Options{
+		MaxBytes:  ctl.imageCfg.MaxBytes,
+		MaxPixels: ctl.imageCfg.MaxPixels,
+		Sizes: []images.Size{
+			{Name: "medium", Max: ctl.imageCfg.MediumSize},
+			{Name: "thumb", Max: ctl.imageCfg.ThumbSize},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	base := "items/" + uuid.New().String()
+	files := []struct {
+		key  string
+		file images.File
+	}{
+		{base + img.Original.Ext, img.Original},
+		{base + "_medium" + img.Renditions["medium"].Ext, img.Renditions["medium"]},
+		{base + "_thumb" + img.Renditions["thumb"].Ext, img.Renditions["thumb"]},
+	}
+	var written []string
+	for _, f := range files {
+		if err := ctl.blobs.Put(ctx, f.key, f.file.Data, f.file.ContentType); err != nil {
+			ctl.deleteBlobs(ctx, written)
+			return nil, err
+		}
+		written = append(written, f.key)
+	}
+	return &models.ItemImage{
+		Key:       files[0].key,
+		MediumKey: files[1].key,
+		ThumbKey:  files[2].key,
+		Width:     img.Original.Width,
+		Height:    img.Original.Height,
+	}, nil
+}
+
+// removeImage deletes the blobs of an uploaded gallery image, if any.
+func (ctl *Controller) removeImage(ctx context.Context, image models.ItemImage) {
+	ctl.deleteBlobs(ctx, []string{image.Key, image.MediumKey, image.ThumbKey})
+}
+
+func (ctl *Controller) deleteBlobs(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := ctl.blobs.Delete(ctx, key); err != nil {
+			log.Printf("images: failed to delete blob %s: %v", key, err)
+		}
+	}
+}
+
+// signImage fills image's URLs with signed URLs for its blobs. Linked
+// images keep their URL.
+func (ctl *Controller) signImage(image *models.ItemImage) {
+	for _, f := range []struct {
+		key string
+		url *string
+	}{
+		{image.Key, &image.URL},
+		{image.MediumKey, &image.MediumURL},
+		{image.ThumbKey, &image.ThumbURL},
+	} {
+		if f.key == "" {
+			continue
+		}
+		url, err := ctl.blobs.SignedURL(f.key, ctl.imageCfg.URLTTL)
+		if err != nil {
+			log.Printf("images: failed to sign URL for %s: %v", f.key, err)
+			continue
+		}
+		*f.url = url
+	}
+}
+
+// signImages signs item's gallery and copies the primary image's URLs to
+// the item. Call it only on items about to be served, never on ones that
+// will be saved.
+func (ctl *Controller) signImages(item *models.Item) {
+	for i := range item.Images {
+		ctl.signImage(&item.Images[i])
+	}
+	if primary := item.PrimaryImage(); primary != nil {
+		item.ImageURL, item.ImageMediumURL, item.ImageThumbURL = primary.URL, primary.MediumURL, primary.ThumbURL
+	}
+}
+
+// signCartImages and signOrderImages sign the images of every line's item.
+func (ctl *Controller) signCartImages(cart *models.Cart) {
+	for i := range cart.Items {
+		ctl.signImages(&cart.Items[i].Item)
+	}
+}
+
+func (ctl *Controller) signOrderImages(order *models.Order) {
+	for i := range order.Items {
+		ctl.signImages(&order.Items[i].Item)
+	}
+}
+
+// UploadItemImage replaces an item's primary image with a multipart upload
+// in the "image" field, keeping its alt text and place in the gallery.
+// Other gallery images are managed through the /items/:id/images
+// endpoints. Admin only.
+func (ctl *Controller) UploadItemImage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	ctl.limitBody(c)
+	data, err := ctl.readImageUpload(c)
+	if err != nil {
+		imageError(c, err)
+		return
+	}
+
+	item, err := ctl.items.Get(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	image, err := ctl.saveImage(ctx, data)
+	if err != nil {
+		imageError(c, err)
+		return
+	}
+	image.ItemID, image.AltText, image.Primary = item.ID, item.Name, true
+	previous := item.PrimaryImage()
+	if previous != nil {
+		image.AltText = previous.AltText
+	}
+	if err := ctl.itemImages.Add(image); err != nil {
+		ctl.removeImage(ctx, *image)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save image"})
+		return
+	}
+	if previous != nil {
+		// Put the new image where the old one was
+		order := make([]uint, 0, len(item.Images))
+		for _, other := range item.Images {
+			if other.ID == previous.ID {
+				order = append(order, image.ID)
+			} else {
+				order = append(order, other.ID)
+			}
+		}
+		if err := ctl.itemImages.Delete(previous.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove previous image"})
+			return
+		}
+		ctl.removeImage(ctx, *previous)
+		if err := ctl.itemImages.Reorder(item.ID, order); err != nil {
+			log.Printf("images: failed to reorder gallery of item %d: %v", item.ID, err)
+		}
+	}
+
+	if updated, err := ctl.items.Get(item.ID); err == nil {
+		item = updated
+	}
+	ctl.signImages(item)
+	c.Header("ETag", itemETag(*item))
+	c.JSON(http.StatusOK, gin.H{"message": "Image uploaded successfully", "item": item})
+}
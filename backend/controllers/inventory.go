@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"shopping-cart/models"
+	"shopping-cart/store"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Inventory Controllers
+
+// AdjustItemStock changes an item's stock level, or that of one of its
+// variants when variant_id is given, by a signed delta and records the
+// change in the item's audit trail. Admin only.
+func (ctl *Controller) AdjustItemStock(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var input struct {
+		Delta     int    `json:"delta" binding:"required"`
+		VariantID *uint  `json:"variant_id"`
+		Note      string `json:"note" binding:"max=255"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	actorID := currentUser(c).ID
+	movement := models.StockMovement{
+		Reason:    models.StockReasonAdjustment,
+		VariantID: input.VariantID,
+		Note:      input.Note,
+		UserID:    &actorID,
+	}
+	if err := ctl.items.AdjustStock(uint(id), input.Delta, &movement); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			if input.VariantID != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+			} else {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+			}
+		case errors.Is(err, store.ErrInsufficientStock):
+			c.JSON(http.StatusConflict, gin.H{"error": "Stock cannot go below zero"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adjust stock"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Stock adjusted", "stock": movement.StockAfter, "movement": movement})
+}
+
+// GetStockMovements returns an item's stock audit trail, newest first. Admin only.
+func (ctl *Controller) GetStockMovements(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if _, err := ctl.items.Get(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+
+	movements, err := ctl.items.ListStockMovements(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stock movements"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"movements": movements})
+}
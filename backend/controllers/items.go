@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"shopping-cart/models"
+	"shopping-cart/money"
+	"shopping-cart/store"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Item Controllers
+
+// itemETag is the entity tag for the item's current version.
+func itemETag(item models.Item) string {
+	return fmt.Sprintf("\"%d\"", item.Version)
+}
+
+// matchesETag reports whether an If-Match header value, a comma-separated
+// list of entity tags or "*", matches etag. Weak tags never match.
+func matchesETag(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// GetItem returns a single item. Its ETag header is the value to send in
+// If-Match when updating it.
+func (ctl *Controller) GetItem(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	rate, ok := ctl.requestedRate(c, "")
+	if !ok {
+		return
+	}
+
+	item, err := ctl.items.Get(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+	if err := setDisplayPrice(item, rate); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert prices"})
+		return
+	}
+
+	ctl.signImages(item)
+	c.Header("ETag", itemETag(*item))
+	c.JSON(http.StatusOK, gin.H{"item": item, "currency": rate.To})
+}
+
+// applyItemPatch applies a JSON Merge Patch (RFC 7396) to item. Only the
+// editable fields may appear; null resets the optional ones. Prices are in
+// the base currency.
+func (ctl *Controller) applyItemPatch(item *models.Item, patch map[string]json.RawMessage) error {
+	for field, raw := range patch {
+		null := string(raw) == "null"
+		switch field {
+		case "name":
+			var name string
+			if null || json.Unmarshal(raw, &name) != nil || strings.TrimSpace(name) == "" {
+				return errors.New("name must be a non-empty string")
+			}
+			item.Name = strings.TrimSpace(name)
+		case "price":
+			var amount json.Number
+			if null || json.Unmarshal(raw, &amount) != nil {
+				return errors.New("price must be a decimal number")
+			}
+			price, err := money.Parse(amount.String(), ctl.catalogCfg.BaseCurrency)
+			if err != nil {
+				return err
+			}
+			if !price.IsPositive() {
+				return errors.New("Price must be greater than zero")
+			}
+			item.Price = price
+		case "currency":
+			var cur string
+			base := ctl.catalogCfg.BaseCurrency
+			if !null && (json.Unmarshal(raw, &cur) != nil || strings.ToUpper(strings.TrimSpace(cur)) != base) {
+				return errors.New("Items must be priced in the base currency " + base)
+			}
+		case "description":
+			item.Description = ""
+			if !null && json.Unmarshal(raw, &item.Description) != nil {
+				return errors.New("description must be a string")
+			}
+		case "image_url", "images":
+			return errors.New("images are changed through /items/:id/images")
+		case "max_per_order":
+			item.MaxPerOrder = 0
+			if !null && (json.Unmarshal(raw, &item.MaxPerOrder) != nil || item.MaxPerOrder < 0) {
+				return errors.New("max_per_order must be a non-negative integer")
+			}
+		case "stock":
+			return errors.New("stock is changed through POST /items/:id/stock")
+		default:
+			return fmt.Errorf("field %q cannot be changed", field)
+		}
+	}
+	return nil
+}
+
+// UpdateItem edits an item with a JSON Merge Patch. The If-Match header
+// must carry the item's current ETag so that concurrent edits can't
+// silently overwrite each other. Price changes are kept in the item's price
+// history. Admin only.
+func (ctl *Controller) UpdateItem(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if ct := c.ContentType(); ct != "application/merge-patch+json" && ct != "application/json" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be application/merge-patch+json"})
+		return
+	}
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header is required"})
+		return
+	}
+
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(c.Request.Body).Decode(&patch); err != nil || patch == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Body must be a JSON object"})
+		return
+	}
+
+	item, err := ctl.items.Get(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+	if !matchesETag(ifMatch, itemETag(*item)) {
+		ctl.signImages(item)
+		c.Header("ETag", itemETag(*item))
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Item has been modified since it was fetched", "item": item})
+		return
+	}
+
+	before, version := *item, item.Version
+	if err := ctl.applyItemPatch(item, patch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if item.Name == before.Name && item.Price == before.Price && item.Description == before.Description &&
+		item.MaxPerOrder == before.MaxPerOrder {
+		// Nothing changed, so there's no new version
+		ctl.signImages(item)
+		c.Header("ETag", itemETag(*item))
+		c.JSON(http.StatusOK, gin.H{"message": "Item unchanged", "item": item})
+		return
+	}
+
+	actorID := currentUser(c).ID
+	if err := ctl.items.Update(item, version, &actorID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrVersionConflict):
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Item has been modified since it was fetched"})
+		case errors.Is(err, store.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update item"})
+		}
+		return
+	}
+
+	if updated, err := ctl.items.Get(item.ID); err == nil {
+		item = updated
+	}
+	ctl.indexItem(*item)
+
+	ctl.signImages(item)
+	c.Header("ETag", itemETag(*item))
+	c.JSON(http.StatusOK, gin.H{"message": "Item updated successfully", "item": item})
+}
+
+// GetPriceHistory returns an item's price changes, newest first. Admin only.
+func (ctl *Controller) GetPriceHistory(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if _, err := ctl.items.Get(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+
+	changes, err := ctl.items.ListPriceHistory(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price history"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"price_history": changes})
+}
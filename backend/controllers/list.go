@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"shopping-cart/models"
+	"shopping-cart/money"
+	"shopping-cart/store"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listQuery reads the paging, sorting and created-at query parameters
+// shared by every listing:
+//
+//	limit           page size (default 20, max 100)
+//	cursor          next_cursor from the previous page
+//	sort            sort key, "-" prefix for descending
+//	created_after   RFC 3339 timestamp or YYYY-MM-DD (inclusive)
+//	created_before  RFC 3339 timestamp or YYYY-MM-DD (inclusive, whole day)
+func listQuery(c *gin.Context) (store.ListOptions, error) {
+	opts := store.ListOptions{
+		Cursor: c.Query("cursor"),
+		Sort:   c.Query("sort"),
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return opts, errors.New("limit must be a positive integer")
+		}
+		opts.Limit = n
+	}
+	var err error
+	if opts.Filter.CreatedAfter, err = timeParam(c, "created_after", false); err != nil {
+		return opts, err
+	}
+	if opts.Filter.CreatedBefore, err = timeParam(c, "created_before", true); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// timeParam parses an RFC 3339 or date-only query parameter. A date-only
+// upper bound covers the whole day.
+func timeParam(c *gin.Context, name string, endOfDay bool) (*time.Time, error) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse(time.DateOnly, v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 timestamp or a YYYY-MM-DD date", name)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return &t, nil
+}
+
+// amountParams reads a decimal range such as min_price/max_price in the
+// base currency into f's amount bounds.
+func (ctl *Controller) amountParams(c *gin.Context, f *store.Filter, minName, maxName string) error {
+	for _, p := range []struct {
+		name string
+		dst  **int64
+	}{{minName, &f.MinAmount}, {maxName, &f.MaxAmount}} {
+		v := c.Query(p.name)
+		if v == "" {
+			continue
+		}
+		m, err := money.Parse(v, ctl.catalogCfg.BaseCurrency)
+		if err != nil {
+			return fmt.Errorf("%s: %v", p.name, err)
+		}
+		*p.dst = &m.Amount
+	}
+	return nil
+}
+
+// userIDParam reads the user_id filter of the admin listings.
+func userIDParam(c *gin.Context, f *store.Filter) error {
+	v := c.Query("user_id")
+	if v == "" {
+		return nil
+	}
+	id, err := strconv.ParseUint(v, 10, 64)
+	if err != nil || id == 0 {
+		return errors.New("user_id must be a positive integer")
+	}
+	f.UserID = uint(id)
+	return nil
+}
+
+// statusParam reads the status filter of the order listings.
+func statusParam(c *gin.Context, f *store.Filter) error {
+	v := c.Query("status")
+	if v == "" {
+		return nil
+	}
+	if !models.ValidOrderStatus(v) {
+		return fmt.Errorf("unknown order status %q", v)
+	}
+	f.Status = v
+	return nil
+}
+
+// listError writes the response for an error returned by a store's List.
+func listError(c *gin.Context, err error, what string) {
+	if errors.Is(err, store.ErrInvalidSort) || errors.Is(err, store.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch " + what})
+}
+
+// pageResponse is the envelope every listing uses: the rows under key,
+// plus next_cursor (empty on the last page) and has_more.
+func pageResponse[T any](key string, page store.Page[T]) gin.H {
+	items := page.Items
+	if items == nil {
+		items = []T{}
+	}
+	return gin.H{key: items, "next_cursor": page.NextCursor, "has_more": page.NextCursor != ""}
+}
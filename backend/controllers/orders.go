@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"shopping-cart/models"
+	"shopping-cart/store"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Order Lifecycle Controllers
+
+// customerCancellable lists the statuses in which customers may cancel
+// their own orders. Admins may cancel whenever models.OrderTransitions
+// allows it.
+var customerCancellable = map[string]bool{
+	models.OrderStatusPending: true,
+	models.OrderStatusPaid:    true,
+}
+
+// UpdateOrderStatus moves an order to the status in the body along
+// models.OrderTransitions, recording an optional note in its history.
+// Refunding an order refunds its payments. Orders become paid only through
+// checkout and are cancelled through CancelOrder. Admin only.
+func (ctl *Controller) UpdateOrderStatus(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var input struct {
+		Status string `json:"status" binding:"required"`
+		Note   string `json:"note" binding:"max=255"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.ValidOrderStatus(input.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown order status " + strconv.Quote(input.Status)})
+		return
+	}
+	if input.Status == models.OrderStatusCancelled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Orders are cancelled through POST /orders/:id/cancel"})
+		return
+	}
+	if input.Status == models.OrderStatusPaid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Orders become paid when their payment is captured"})
+		return
+	}
+
+	order, err := ctl.orders.Get(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	actorID := currentUser(c).ID
+	if err := ctl.orders.Transition(order.ID, order.Status, input.Status, &actorID, input.Note); err != nil {
+		if errors.Is(err, store.ErrInvalidTransition) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Order cannot move from " + order.Status + " to " + input.Status,
+				"allowed": models.OrderTransitions[order.Status],
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order status"})
+		return
+	}
+
+	if updated, err := ctl.orders.Get(order.ID); err == nil {
+		order = updated
+	}
+	// Only the request whose transition went through refunds, so the
+	// money is given back once and never for an order that stayed live
+	if input.Status == models.OrderStatusRefunded {
+		if err := ctl.reversePayments(c.Request.Context(), order); err != nil {
+			ctl.signOrderImages(order)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Order marked refunded, but its payments could not be refunded", "order": order})
+			return
+		}
+	}
+	ctl.signOrderImages(order)
+	c.JSON(http.StatusOK, gin.H{"message": "Order status updated", "order": order})
+}
+
+// CancelOrder cancels an order with the reason in the body, puts its items
+// back in stock, then voids or refunds its payments. The order stays in
+// the user's history. Customers may cancel their own orders until they are
+// fulfilled; admins any order that hasn't shipped. Cancelling an order
+// again retries the reversal of payments that failed the first time.
+func (ctl *Controller) CancelOrder(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason" binding:"required,max=255"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	reason := strings.TrimSpace(input.Reason)
+	if reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A cancellation reason is required"})
+		return
+	}
+
+	order, err := ctl.orders.Get(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	// Only the reversal is left to do for a cancelled order still holding
+	// the customer's money
+	retry := order.Status == models.OrderStatusCancelled && unreversedPayments(order)
+	user := currentUser(c)
+	if !user.IsAdmin() {
+		if order.UserID != user.ID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Order does not belong to the authenticated user"})
+			return
+		}
+		if !retry && !customerCancellable[order.Status] {
+			c.JSON(http.StatusConflict, gin.H{"error": "Order can no longer be cancelled", "status": order.Status})
+			return
+		}
+	}
+
+	if !retry {
+		if !models.CanTransition(order.Status, models.OrderStatusCancelled) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Order can no longer be cancelled", "status": order.Status})
+			return
+		}
+		if err := ctl.orders.Cancel(order.ID, order.Status, reason, &user.ID); err != nil {
+			if errors.Is(err, store.ErrInvalidTransition) {
+				c.JSON(http.StatusConflict, gin.H{"error": "Order can no longer be cancelled", "status": order.Status})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel order"})
+			return
+		}
+		if updated, err := ctl.orders.Get(order.ID); err == nil {
+			order = updated
+		}
+	}
+	// The money goes back only after the cancellation went through, so a
+	// rejected or concurrent cancel never reverses a payment. Retries
+	// racing each other are held back by the gateway, which never refunds
+	// more than was captured.
+	if err := ctl.reversePayments(c.Request.Context(), order); err != nil {
+		ctl.signOrderImages(order)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Order cancelled, but its payments could not be reversed; cancel it again to retry", "order": order})
+		return
+	}
+	ctl.signOrderImages(order)
+	c.JSON(http.StatusOK, gin.H{"message": "Order cancelled", "order": order})
+}
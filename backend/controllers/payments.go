@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"shopping-cart/models"
+	"shopping-cart/payment"
+	"shopping-cart/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Payment Controllers
+
+// paymentError writes the response for an error from the payment gateway.
+func paymentError(c *gin.Context, err error, extra gin.H) {
+	body := gin.H{}
+	for k, v := range extra {
+		body[k] = v
+	}
+	if errors.Is(err, payment.ErrDeclined) {
+		body["error"], body["detail"] = "Payment declined", err.Error()
+		c.JSON(http.StatusPaymentRequired, body)
+		return
+	}
+	body["error"] = "Payment could not be processed"
+	c.JSON(http.StatusBadGateway, body)
+}
+
+// errNotMarkedPaid is returned by capturePayment when the money was taken
+// but the order could not be moved to paid.
+var errNotMarkedPaid = errors.New("payment captured, but the order could not be marked paid")
+
+// capturePayment captures an authorized payment for a freshly placed,
+// pending order and marks the order paid. If the capture fails, the
+// authorization is voided and the order cancelled, which puts its stock
+// back, and the capture error is returned. If the order was cancelled
+// while the capture was in flight, the payment is refunded and an error
+// wrapping store.ErrInvalidTransition returned; any other failure to mark
+// the order paid returns one wrapping errNotMarkedPaid.
+func (ctl *Controller) capturePayment(ctx context.Context, order *models.Order, p *models.Payment) error {
+	err := ctl.gateway.Capture(ctx, p.Reference, p.Amount)
+	if err != nil {
+		if voidErr := ctl.gateway.Void(ctx, p.Reference); voidErr != nil {
+			log.Printf("payments: failed to void %s: %v", p.Reference, voidErr)
+		}
+		p.Status, p.FailureReason = models.PaymentStatusFailed, err.Error()
+		if err := ctl.payments.Update(p); err != nil {
+			log.Printf("payments: failed to record failure of payment %d: %v", p.ID, err)
+		}
+		if err := ctl.orders.Cancel(order.ID, models.OrderStatusPending, "Payment failed", nil); err != nil {
+			log.Printf("payments: failed to cancel unpaid order %d: %v", order.ID, err)
+		}
+		return err
+	}
+
+	p.Status = models.PaymentStatusCaptured
+	if err := ctl.payments.Update(p); err != nil {
+		log.Printf("payments: failed to record capture of payment %d: %v", p.ID, err)
+	}
+	err = ctl.orders.Transition(order.ID, models.OrderStatusPending, models.OrderStatusPaid, nil, "Payment captured")
+	if errors.Is(err, store.ErrInvalidTransition) {
+		// The order was cancelled during the capture, when the payment was
+		// still only authorized, so the refund falls to us. One that fails
+		// is retried by cancelling the order again.
+		order.Payments = []models.Payment{*p}
+		if err := ctl.reversePayments(ctx, order); err != nil {
+			log.Printf("payments: failed to refund payment %d of cancelled order %d: %v", p.ID, order.ID, err)
+		}
+		return fmt.Errorf("order %d was cancelled during payment: %w", order.ID, err)
+	}
+	if err != nil {
+		log.Printf("payments: failed to mark order %d paid: %v", order.ID, err)
+		return fmt.Errorf("%w: %w", errNotMarkedPaid, err)
+	}
+	return nil
+}
+
+// unreversedPayments reports whether any of the order's payments still
+// holds money, authorized or captured, that reversePayments would return.
+func unreversedPayments(order *models.Order) bool {
+	for _, p := range order.Payments {
+		if p.Status == models.PaymentStatusAuthorized || p.Status == models.PaymentStatusCaptured {
+			return true
+		}
+	}
+	return false
+}
+
+// reversePayments gives back what the order's payments took: open
+// authorizations are voided and captured payments refunded in full. It
+// must only run once the order has left the statuses that keep the money.
+// A payment the gateway won't reverse keeps its status with the gateway's
+// error as its failure reason, so running it again retries just those.
+func (ctl *Controller) reversePayments(ctx context.Context, order *models.Order) error {
+	for i := range order.Payments {
+		p := &order.Payments[i]
+		var err error
+		switch p.Status {
+		case models.PaymentStatusAuthorized:
+			if err = ctl.gateway.Void(ctx, p.Reference); err == nil {
+				p.Status = models.PaymentStatusVoided
+			}
+		case models.PaymentStatusCaptured:
+			remaining := p.Amount
+			remaining.Amount -= p.Refunded.Amount
+			if remaining.IsPositive() {
+				err = ctl.gateway.Refund(ctx, p.Reference, remaining)
+			}
+			if err == nil {
+				p.Status, p.Refunded = models.PaymentStatusRefunded, p.Amount
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			log.Printf("payments: failed to reverse payment %d: %v", p.ID, err)
+			p.FailureReason = err.Error()
+			if err := ctl.payments.Update(p); err != nil {
+				log.Printf("payments: failed to record reversal failure of payment %d: %v", p.ID, err)
+			}
+			return err
+		}
+		if err := ctl.payments.Update(p); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"shopping-cart/models"
+	"shopping-cart/search"
+	"shopping-cart/store"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxQueryLength bounds the q parameter of SearchItems.
+const maxQueryLength = 200
+
+// indexItem adds item to the search index. The catalog write already
+// succeeded, so a failure is logged rather than returned to the client.
+func (ctl *Controller) indexItem(item models.Item) {
+	if err := ctl.search.Index(search.ItemDocument(item)); err != nil {
+		log.Printf("search: failed to index item %d: %v", item.ID, err)
+	}
+}
+
+// unindexItem removes an item from the search index.
+func (ctl *Controller) unindexItem(id uint) {
+	if err := ctl.search.Remove(id); err != nil {
+		log.Printf("search: failed to remove item %d: %v", id, err)
+	}
+}
+
+// SearchItems runs a full-text search over item names and descriptions.
+// Results are ranked best first and carry snippets with the matched words
+// wrapped in <mark> tags. It takes limit and cursor like the listings and
+// the currency parameter like GetItems.
+func (ctl *Controller) SearchItems(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+	if utf8.RuneCountInString(q) > maxQueryLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is too long"})
+		return
+	}
+	rate, ok := ctl.requestedRate(c, "")
+	if !ok {
+		return
+	}
+	opts, err := listQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = store.DefaultPageSize
+	}
+	limit = min(limit, store.MaxPageSize)
+
+	// Search pages are ranked, not keyed, so the cursor is just an offset
+	offset := 0
+	if opts.Cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+		if err == nil {
+			offset, err = strconv.Atoi(string(raw))
+		}
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": store.ErrInvalidCursor.Error()})
+			return
+		}
+	}
+
+	res, err := ctl.search.Search(q, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed"})
+		return
+	}
+
+	type result struct {
+		Item       models.Item       `json:"item"`
+		Score      float64           `json:"score"`
+		Highlights map[string]string `json:"highlights"`
+	}
+	results := []result{}
+	for _, hit := range res.Hits {
+		item, err := ctl.items.Get(hit.ID)
+		if errors.Is(err, store.ErrNotFound) {
+			// The index can briefly lag a delete
+			continue
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch items"})
+			return
+		}
+		if err := setDisplayPrice(item, rate); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert prices"})
+			return
+		}
+		ctl.signImages(item)
+		results = append(results, result{Item: *item, Score: hit.Score, Highlights: hit.Highlights})
+	}
+
+	next := ""
+	if offset+len(res.Hits) < res.Total {
+		next = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset + len(res.Hits))))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"query":       q,
+		"results":     results,
+		"total":       res.Total,
+		"currency":    rate.To,
+		"next_cursor": next,
+		"has_more":    next != "",
+	})
+}
@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"net/http"
+	"shopping-cart/auth"
+	"shopping-cart/models"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Session Controllers
+
+// pruneSessions deletes the user's expired sessions and, if the user is at
+// the per-user cap, the least recently used ones so a new session fits.
+func (ctl *Controller) pruneSessions(userID uint) error {
+	sessions, err := ctl.sessions.ListByUser(userID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	live := sessions[:0]
+	for _, s := range sessions {
+		if s.Expired(now) {
+			if err := ctl.sessions.Delete(s.ID); err != nil {
+				return err
+			}
+			continue
+		}
+		live = append(live, s)
+	}
+
+	limit := ctl.sessionCfg.MaxPerUser
+	if limit <= 0 || len(live) < limit {
+		return nil
+	}
+
+	// Least recently used first; sessions never used fall back to creation time
+	lastUsed := func(i int) time.Time {
+		if live[i].LastUsedAt != nil {
+			return *live[i].LastUsedAt
+		}
+		return live[i].CreatedAt
+	}
+	sort.SliceStable(live, func(i, j int) bool { return lastUsed(i).Before(lastUsed(j)) })
+
+	for _, s := range live[:len(live)-limit+1] {
+		if err := ctl.sessions.Delete(s.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListSessions returns the authenticated user's active sessions (devices)
+func (ctl *Controller) ListSessions(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	sessionID, _ := c.Get("session_id")
+	currentID, _ := sessionID.(uint)
+
+	sessions, err := ctl.sessions.ListByUser(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	now := time.Now()
+	live := sessions[:0]
+	for _, s := range sessions {
+		if s.Expired(now) {
+			continue
+		}
+		s.Current = s.ID == currentID
+		live = append(live, s)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": live})
+}
+
+// RevokeSession deletes one of the authenticated user's sessions by id
+func (ctl *Controller) RevokeSession(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	session, err := ctl.sessions.Get(uint(id))
+	// Don't reveal whether another user's session id exists
+	if err != nil || session.UserID != userID.(uint) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	if err := ctl.sessions.Delete(session.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RefreshSession slides the current session's expiry forward by the session
+// TTL, without going past the session's maximum lifetime.
+func (ctl *Controller) RefreshSession(c *gin.Context) {
+	sessionID, _ := c.Get("session_id")
+
+	session, err := ctl.sessions.Get(sessionID.(uint))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	expiresAt := time.Now().Add(ctl.sessionCfg.TTL)
+	if limit := session.CreatedAt.Add(ctl.sessionCfg.MaxLifetime); expiresAt.After(limit) {
+		expiresAt = limit
+	}
+
+	if err := ctl.sessions.SetExpiry(session.ID, expiresAt); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session refreshed", "expires_at": expiresAt})
+}
+
+// signAccessToken issues a JWT access token for user bound to sessionID
+func (ctl *Controller) signAccessToken(user *models.User, sessionID uint) (string, time.Time, error) {
+	claims := auth.AccessClaims{
+		UserID:    user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		SessionID: sessionID,
+	}
+	return ctl.sessionCfg.JWTKeys.Sign(claims, ctl.sessionCfg.JWTIssuer, ctl.sessionCfg.AccessTokenTTL)
+}
+
+// RefreshToken exchanges a refresh token for a new access token (jwt mode).
+// The refresh token is rotated on every use and its expiry slides forward
+// like RefreshSession's, bounded by the session's maximum lifetime.
+func (ctl *Controller) RefreshToken(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := ctl.sessions.GetByTokenHash(ctl.tokens.Hash(input.RefreshToken))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	now := time.Now()
+	if session.Expired(now) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token expired"})
+		return
+	}
+
+	// Reload the user so role changes are picked up on refresh
+	user, err := ctl.users.Get(session.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session user"})
+		return
+	}
+
+	token, err := auth.NewToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+	expiresAt := now.Add(ctl.sessionCfg.TTL)
+	if limit := session.CreatedAt.Add(ctl.sessionCfg.MaxLifetime); expiresAt.After(limit) {
+		expiresAt = limit
+	}
+	if err := ctl.sessions.RotateToken(session.ID, ctl.tokens.Hash(token), expiresAt); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+	ctl.sessions.Touch(session.ID, now)
+
+	access, accessExpiresAt, err := ctl.signAccessToken(user, session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue access token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":                   access,
+		"access_token":            access,
+		"access_token_expires_at": accessExpiresAt,
+		"refresh_token":           token,
+		"expires_at":              expiresAt,
+	})
+}
+
+// truncate shortens s to at most n bytes
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"shopping-cart/models"
+	"shopping-cart/money"
+	"shopping-cart/store"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Variant Controllers
+
+// variantIDParam parses the optional variant_id query parameter.
+func variantIDParam(c *gin.Context) (*uint, bool) {
+	raw := c.Query("variant_id")
+	if raw == "" {
+		return nil, true
+	}
+	id, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid variant_id"})
+		return nil, false
+	}
+	variantID := uint(id)
+	return &variantID, true
+}
+
+// selectVariant checks that variantID names a concrete variant of item,
+// and that one was given if and only if the item has variants. It writes
+// an error response and returns false otherwise.
+func selectVariant(c *gin.Context, item *models.Item, variantID *uint) (*models.Variant, bool) {
+	if len(item.Variants) == 0 {
+		if variantID != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Item has no variants"})
+			return nil, false
+		}
+		return nil, true
+	}
+	if variantID == nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Select a variant", "variants": item.Variants})
+		return nil, false
+	}
+	for i := range item.Variants {
+		if item.Variants[i].ID == *variantID {
+			return &item.Variants[i], true
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+	return nil, false
+}
+
+// GetItemVariants lists an item's variants.
+func (ctl *Controller) GetItemVariants(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if _, err := ctl.items.Get(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+
+	variants, err := ctl.variants.ListByItem(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch variants"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"variants": variants})
+}
+
+// CreateVariant adds a variant to an item. Options must differ from the
+// item's other variants; price, when given, overrides the item's price and
+// is in the base currency. Admin only.
+func (ctl *Controller) CreateVariant(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var input struct {
+		SKU     string                `json:"sku" binding:"required,max=64"`
+		Options models.VariantOptions `json:"options" binding:"required"`
+		Price   json.Number           `json:"price"`
+		Stock   int                   `json:"stock" binding:"min=0"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sku := strings.TrimSpace(input.SKU)
+	if sku == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "SKU is required"})
+		return
+	}
+	for name, value := range input.Options {
+		if strings.TrimSpace(name) == "" || strings.TrimSpace(value) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Option names and values must not be empty"})
+			return
+		}
+	}
+
+	item, err := ctl.items.Get(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+	for _, other := range item.Variants {
+		if other.Options.Equal(input.Options) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A variant with these options already exists", "variant_id": other.ID})
+			return
+		}
+	}
+
+	variant := models.Variant{ItemID: item.ID, SKU: sku, Options: input.Options}
+	if input.Price != "" {
+		price, err := money.Parse(input.Price.String(), ctl.catalogCfg.BaseCurrency)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !price.IsPositive() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Price must be greater than zero"})
+			return
+		}
+		variant.PriceOverride = &price
+	}
+
+	if err := ctl.variants.Create(&variant); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		case errors.Is(err, store.ErrDuplicate):
+			c.JSON(http.StatusConflict, gin.H{"error": "SKU already in use"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create variant"})
+		}
+		return
+	}
+
+	if input.Stock > 0 {
+		actorID := currentUser(c).ID
+		movement := models.StockMovement{Reason: models.StockReasonInitial, VariantID: &variant.ID, UserID: &actorID}
+		if err := ctl.items.AdjustStock(item.ID, input.Stock, &movement); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set initial stock"})
+			return
+		}
+		variant.Stock = movement.StockAfter
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Variant created successfully", "variant": variant})
+}
+
+// DeleteVariant removes a variant from an item. Cart lines and orders that
+// reference it keep their variant_id. Admin only.
+func (ctl *Controller) DeleteVariant(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	variantID, err := strconv.ParseUint(c.Param("variant_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid variant_id"})
+		return
+	}
+
+	variant, err := ctl.variants.Get(uint(variantID))
+	if err != nil || variant.ItemID != uint(id) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+		return
+	}
+	if err := ctl.variants.Delete(variant.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete variant"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Variant deleted successfully"})
+}
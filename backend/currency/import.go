@@ -0,0 +1,118 @@
+// Package currency reads exchange-rate tables from CSV or JSON so they can
+// be loaded through the admin API or the admin command.
+package currency
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"shopping-cart/models"
+	"shopping-cart/money"
+)
+
+// Supported import formats
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// maxRateLength matches the size of the exchange_rates.rate column.
+const maxRateLength = 32
+
+// FormatFromName picks the import format from a file name's extension,
+// defaulting to JSON.
+func FormatFromName(name string) string {
+	if strings.EqualFold(filepath.Ext(name), ".csv") {
+		return FormatCSV
+	}
+	return FormatJSON
+}
+
+// ParseFile reads the rate table at path.
+func ParseFile(path, base string) ([]models.ExchangeRate, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f, FormatFromName(path), base)
+}
+
+// Parse reads a rate table quoted against base.
+//
+// CSV has one "currency,rate" row per currency; a leading header row is
+// skipped. JSON is an object of the form
+//
+//	{"base": "USD", "rates": {"EUR": "0.92", "JPY": 151.3}}
+//
+// where base is optional but must match when given. Each rate is how many
+// units of the currency one unit of base buys.
+func Parse(r io.Reader, format, base string) ([]models.ExchangeRate, error) {
+	var pairs [][2]string
+	switch format {
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = 2
+		cr.TrimLeadingSpace = true
+		records, err := cr.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		for i, rec := range records {
+			if i == 0 && strings.EqualFold(strings.TrimSpace(rec[0]), "currency") {
+				continue
+			}
+			pairs = append(pairs, [2]string{rec[0], rec[1]})
+		}
+	case FormatJSON:
+		var doc struct {
+			Base  string                 `json:"base"`
+			Rates map[string]json.Number `json:"rates"`
+		}
+		dec := json.NewDecoder(r)
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return nil, err
+		}
+		if doc.Base != "" && !strings.EqualFold(doc.Base, base) {
+			return nil, fmt.Errorf("rates are quoted against %s, but the base currency is %s", doc.Base, base)
+		}
+		for code, rate := range doc.Rates {
+			pairs = append(pairs, [2]string{code, rate.String()})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+
+	if len(pairs) == 0 {
+		return nil, errors.New("no exchange rates found")
+	}
+
+	rates := make([]models.ExchangeRate, 0, len(pairs))
+	seen := map[string]bool{}
+	for _, p := range pairs {
+		code := strings.ToUpper(strings.TrimSpace(p[0]))
+		value := strings.TrimSpace(p[1])
+		if !money.ValidCurrency(code) {
+			return nil, fmt.Errorf("invalid currency code %q", p[0])
+		}
+		if code == base {
+			return nil, fmt.Errorf("%s is the base currency and can't have a rate", code)
+		}
+		if seen[code] {
+			return nil, fmt.Errorf("duplicate rate for %s", code)
+		}
+		seen[code] = true
+		if _, err := money.ParseRate(base, code, value); err != nil || len(value) > maxRateLength {
+			return nil, fmt.Errorf("%s: invalid rate %q", code, value)
+		}
+		rates = append(rates, models.ExchangeRate{Currency: code, Rate: value})
+	}
+	return rates, nil
+}
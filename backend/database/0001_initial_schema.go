@@ -0,0 +1,116 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Schema as previously produced by AutoMigrate on startup.
+
+type user0001 struct {
+	ID        uint   `gorm:"primaryKey"`
+	Username  string `gorm:"size:191;unique;not null"`
+	Password  string `gorm:"not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (user0001) TableName() string { return "users" }
+
+type item0001 struct {
+	ID          uint    `gorm:"primaryKey"`
+	Name        string  `gorm:"not null"`
+	Price       float64 `gorm:"not null"`
+	Description string
+	ImageURL    string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   gorm.DeletedAt `gorm:"index"`
+}
+
+func (item0001) TableName() string { return "items" }
+
+type cart0001 struct {
+	ID        uint `gorm:"primaryKey"`
+	UserID    uint `gorm:"not null;unique"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (cart0001) TableName() string { return "carts" }
+
+type cartItem0001 struct {
+	ID        uint `gorm:"primaryKey"`
+	CartID    uint `gorm:"not null"`
+	ItemID    uint `gorm:"not null"`
+	Quantity  int  `gorm:"default:1"`
+	CreatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (cartItem0001) TableName() string { return "cart_items" }
+
+type order0001 struct {
+	ID        uint `gorm:"primaryKey"`
+	UserID    uint `gorm:"not null"`
+	Total     float64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (order0001) TableName() string { return "orders" }
+
+type orderItem0001 struct {
+	ID        uint    `gorm:"primaryKey"`
+	OrderID   uint    `gorm:"not null"`
+	ItemID    uint    `gorm:"not null"`
+	Quantity  int     `gorm:"default:1"`
+	Price     float64 `gorm:"not null"`
+	CreatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (orderItem0001) TableName() string { return "order_items" }
+
+type session0001 struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	Token     string `gorm:"size:191;unique;not null"`
+	CreatedAt time.Time
+	ExpiresAt *time.Time
+}
+
+func (session0001) TableName() string { return "sessions" }
+
+func init() {
+	register(Migration{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: func(tx *gorm.DB) error {
+			// Databases created by the old AutoMigrate already have these
+			// tables; only create the missing ones so they can be adopted.
+			for _, t := range []interface{}{
+				&user0001{}, &item0001{}, &cart0001{}, &cartItem0001{},
+				&order0001{}, &orderItem0001{}, &session0001{},
+			} {
+				if tx.Migrator().HasTable(t) {
+					continue
+				}
+				if err := tx.Migrator().CreateTable(t); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(
+				&session0001{}, &orderItem0001{}, &order0001{},
+				&cartItem0001{}, &cart0001{}, &item0001{}, &user0001{},
+			)
+		},
+	})
+}
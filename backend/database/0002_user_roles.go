@@ -0,0 +1,22 @@
+package database
+
+import "gorm.io/gorm"
+
+type user0002 struct {
+	Role string `gorm:"size:32;not null;default:customer"`
+}
+
+func (user0002) TableName() string { return "users" }
+
+func init() {
+	register(Migration{
+		Version: 2,
+		Name:    "user_roles",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&user0002{}, "Role")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumn(tx, &user0002{}, "Role")
+		},
+	})
+}
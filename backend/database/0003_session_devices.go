@@ -0,0 +1,43 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type session0003 struct {
+	UserAgent  string `gorm:"size:255"`
+	IPAddress  string `gorm:"size:64"`
+	LastUsedAt *time.Time
+}
+
+func (session0003) TableName() string { return "sessions" }
+
+// legacySessionGrace is how long sessions created before expiry existed
+// remain valid, so deploying this doesn't log everybody out at once.
+const legacySessionGrace = 7 * 24 * time.Hour
+
+func init() {
+	register(Migration{
+		Version: 3,
+		Name:    "session_devices",
+		Up: func(tx *gorm.DB) error {
+			for _, col := range []string{"UserAgent", "IPAddress", "LastUsedAt"} {
+				if err := tx.Migrator().AddColumn(&session0003{}, col); err != nil {
+					return err
+				}
+			}
+			return tx.Exec("UPDATE sessions SET expires_at = ? WHERE expires_at IS NULL",
+				time.Now().Add(legacySessionGrace)).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, col := range []string{"LastUsedAt", "IPAddress", "UserAgent"} {
+				if err := dropColumn(tx, &session0003{}, col); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
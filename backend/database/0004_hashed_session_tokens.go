@@ -0,0 +1,57 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// session0004 is the full sessions table once tokens are stored hashed
+type session0004 struct {
+	ID         uint   `gorm:"primaryKey"`
+	UserID     uint   `gorm:"not null;index"`
+	TokenHash  string `gorm:"size:64;uniqueIndex;not null"`
+	UserAgent  string `gorm:"size:255"`
+	IPAddress  string `gorm:"size:64"`
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+}
+
+func (session0004) TableName() string { return "sessions" }
+
+// session0003Full is the sessions table as left by migration 3
+type session0003Full struct {
+	ID         uint   `gorm:"primaryKey"`
+	UserID     uint   `gorm:"not null;index"`
+	Token      string `gorm:"size:191;unique;not null"`
+	UserAgent  string `gorm:"size:255"`
+	IPAddress  string `gorm:"size:64"`
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+}
+
+func (session0003Full) TableName() string { return "sessions" }
+
+func init() {
+	register(Migration{
+		Version: 4,
+		Name:    "hashed_session_tokens",
+		// Plaintext tokens can't be carried over, so every existing session is
+		// invalidated and users log in again. Since no rows survive, the table
+		// is simply recreated, which sidesteps SQLite's limited ALTER TABLE.
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&session0003Full{}); err != nil {
+				return err
+			}
+			return tx.Migrator().CreateTable(&session0004{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&session0004{}); err != nil {
+				return err
+			}
+			return tx.Migrator().CreateTable(&session0003Full{})
+		},
+	})
+}
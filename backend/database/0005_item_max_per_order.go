@@ -0,0 +1,22 @@
+package database
+
+import "gorm.io/gorm"
+
+type item0005 struct {
+	MaxPerOrder int `gorm:"not null;default:0"`
+}
+
+func (item0005) TableName() string { return "items" }
+
+func init() {
+	register(Migration{
+		Version: 5,
+		Name:    "item_max_per_order",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&item0005{}, "MaxPerOrder")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumn(tx, &item0005{}, "MaxPerOrder")
+		},
+	})
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type item0006 struct {
+	Stock int `gorm:"not null;default:0"`
+}
+
+func (item0006) TableName() string { return "items" }
+
+type stockMovement0006 struct {
+	ID         uint   `gorm:"primaryKey"`
+	ItemID     uint   `gorm:"not null;index"`
+	Delta      int    `gorm:"not null"`
+	StockAfter int    `gorm:"not null"`
+	Reason     string `gorm:"size:32;not null"`
+	Note       string `gorm:"size:255"`
+	OrderID    *uint  `gorm:"index"`
+	UserID     *uint
+	CreatedAt  time.Time
+}
+
+func (stockMovement0006) TableName() string { return "stock_movements" }
+
+func init() {
+	register(Migration{
+		Version: 6,
+		Name:    "inventory",
+		// Existing items start with no stock; admins must stock them through
+		// POST /items/:id/stock before they can be ordered again.
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AddColumn(&item0006{}, "Stock"); err != nil {
+				return err
+			}
+			return tx.Migrator().CreateTable(&stockMovement0006{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&stockMovement0006{}); err != nil {
+				return err
+			}
+			return dropColumn(tx, &item0006{}, "Stock")
+		},
+	})
+}
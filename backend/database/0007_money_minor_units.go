@@ -0,0 +1,118 @@
+package database
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"shopping-cart/money"
+
+	"gorm.io/gorm"
+)
+
+type item0007 struct {
+	Price         float64
+	PriceAmount   int64  `gorm:"not null;default:0"`
+	PriceCurrency string `gorm:"size:3;not null;default:''"`
+}
+
+func (item0007) TableName() string { return "items" }
+
+type orderItem0007 struct {
+	Price         float64
+	PriceAmount   int64  `gorm:"not null;default:0"`
+	PriceCurrency string `gorm:"size:3;not null;default:''"`
+}
+
+func (orderItem0007) TableName() string { return "order_items" }
+
+type order0007 struct {
+	Total         float64
+	TotalAmount   int64  `gorm:"not null;default:0"`
+	TotalCurrency string `gorm:"size:3;not null;default:''"`
+}
+
+func (order0007) TableName() string { return "orders" }
+
+// moneyColumns0007 lists the float columns replaced by amount/currency pairs.
+var moneyColumns0007 = []struct {
+	model  interface{}
+	table  string
+	column string
+}{
+	{&item0007{}, "items", "price"},
+	{&orderItem0007{}, "order_items", "price"},
+	{&order0007{}, "orders", "total"},
+}
+
+// legacyCurrency0007 is the currency existing float amounts were in. The
+// old schema had no currency, so it is taken from DEFAULT_CURRENCY.
+func legacyCurrency0007() (string, error) {
+	cur := strings.ToUpper(strings.TrimSpace(os.Getenv("DEFAULT_CURRENCY")))
+	if cur == "" {
+		cur = money.DefaultCurrency
+	}
+	if !money.ValidCurrency(cur) {
+		return "", fmt.Errorf("DEFAULT_CURRENCY %q is not an ISO 4217 code", cur)
+	}
+	return cur, nil
+}
+
+func init() {
+	register(Migration{
+		Version: 7,
+		Name:    "money_minor_units",
+		// Float prices and totals are converted to integer minor units,
+		// rounding to the nearest unit, then the float columns are dropped.
+		Up: func(tx *gorm.DB) error {
+			cur, err := legacyCurrency0007()
+			if err != nil {
+				return err
+			}
+			factor := math.Pow10(money.MinorUnits(cur))
+			m := tx.Migrator()
+			for _, c := range moneyColumns0007 {
+				for _, field := range []string{c.column + "_amount", c.column + "_currency"} {
+					if err := m.AddColumn(c.model, field); err != nil {
+						return err
+					}
+				}
+				sql := fmt.Sprintf("UPDATE %s SET %s_amount = ROUND(%s * ?), %s_currency = ?",
+					c.table, c.column, c.column, c.column)
+				if err := tx.Exec(sql, factor, cur).Error; err != nil {
+					return err
+				}
+				if err := dropColumn(tx, c.model, c.column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		// Down converts back assuming every row is in DEFAULT_CURRENCY;
+		// the currency of each row is lost.
+		Down: func(tx *gorm.DB) error {
+			cur, err := legacyCurrency0007()
+			if err != nil {
+				return err
+			}
+			factor := math.Pow10(money.MinorUnits(cur))
+			m := tx.Migrator()
+			for _, c := range moneyColumns0007 {
+				if err := m.AddColumn(c.model, c.column); err != nil {
+					return err
+				}
+				sql := fmt.Sprintf("UPDATE %s SET %s = %s_amount / ?", c.table, c.column, c.column)
+				if err := tx.Exec(sql, factor).Error; err != nil {
+					return err
+				}
+				for _, field := range []string{c.column + "_amount", c.column + "_currency"} {
+					if err := dropColumn(tx, c.model, field); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type exchangeRate0008 struct {
+	ID        uint   `gorm:"primaryKey"`
+	Currency  string `gorm:"size:3;uniqueIndex;not null"`
+	Rate      string `gorm:"size:32;not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (exchangeRate0008) TableName() string { return "exchange_rates" }
+
+type order0008 struct {
+	BaseTotalAmount   int64  `gorm:"not null;default:0"`
+	BaseTotalCurrency string `gorm:"size:3;not null;default:''"`
+	ExchangeRate      string `gorm:"size:32;not null;default:'1'"`
+}
+
+func (order0008) TableName() string { return "orders" }
+
+func init() {
+	register(Migration{
+		Version: 8,
+		Name:    "exchange_rates",
+		// Orders placed so far were charged in the base currency, so their
+		// base total is their total at a rate of 1.
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&exchangeRate0008{}); err != nil {
+				return err
+			}
+			for _, field := range []string{"BaseTotalAmount", "BaseTotalCurrency", "ExchangeRate"} {
+				if err := tx.Migrator().AddColumn(&order0008{}, field); err != nil {
+					return err
+				}
+			}
+			return tx.Exec("UPDATE orders SET base_total_amount = total_amount, base_total_currency = total_currency").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, field := range []string{"ExchangeRate", "BaseTotalCurrency", "BaseTotalAmount"} {
+				if err := dropColumn(tx, &order0008{}, field); err != nil {
+					return err
+				}
+			}
+			return tx.Migrator().DropTable(&exchangeRate0008{})
+		},
+	})
+}
@@ -0,0 +1,38 @@
+package database
+
+import "gorm.io/gorm"
+
+// listIndexes0009 backs the sort keys and filters of the paginated
+// listings; id is already covered by the primary keys.
+var listIndexes0009 = []struct{ name, table, columns string }{
+	{"idx_items_price_amount", "items", "price_amount, id"},
+	{"idx_items_created_at", "items", "created_at, id"},
+	{"idx_orders_user_id", "orders", "user_id, id"},
+	{"idx_orders_created_at", "orders", "created_at, id"},
+	{"idx_orders_base_total_amount", "orders", "base_total_amount, id"},
+	{"idx_users_created_at", "users", "created_at, id"},
+	{"idx_carts_created_at", "carts", "created_at, id"},
+}
+
+func init() {
+	register(Migration{
+		Version: 9,
+		Name:    "list_indexes",
+		Up: func(tx *gorm.DB) error {
+			for _, idx := range listIndexes0009 {
+				if err := tx.Exec("CREATE INDEX " + idx.name + " ON " + idx.table + " (" + idx.columns + ")").Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, idx := range listIndexes0009 {
+				if err := tx.Migrator().DropIndex(idx.table, idx.name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type category0010 struct {
+	ID        uint   `gorm:"primaryKey"`
+	Name      string `gorm:"size:100;not null"`
+	Slug      string `gorm:"size:120;uniqueIndex;not null"`
+	ParentID  *uint  `gorm:"index"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (category0010) TableName() string { return "categories" }
+
+type itemCategory0010 struct {
+	ItemID     uint `gorm:"primaryKey"`
+	CategoryID uint `gorm:"primaryKey;index"`
+}
+
+func (itemCategory0010) TableName() string { return "item_categories" }
+
+func init() {
+	register(Migration{
+		Version: 10,
+		Name:    "categories",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().CreateTable(&category0010{}); err != nil {
+				return err
+			}
+			return tx.Migrator().CreateTable(&itemCategory0010{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&itemCategory0010{}); err != nil {
+				return err
+			}
+			return tx.Migrator().DropTable(&category0010{})
+		},
+	})
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type variant0011 struct {
+	ID                    uint   `gorm:"primaryKey"`
+	ItemID                uint   `gorm:"not null;index"`
+	SKU                   string `gorm:"size:64;not null;uniqueIndex"`
+	Options               string `gorm:"type:text;not null"`
+	PriceOverrideAmount   *int64
+	PriceOverrideCurrency *string `gorm:"size:3"`
+	Stock                 int     `gorm:"not null;default:0"`
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
+	DeletedAt             gorm.DeletedAt `gorm:"index"`
+}
+
+func (variant0011) TableName() string { return "variants" }
+
+type cartItem0011 struct {
+	VariantID *uint `gorm:"index"`
+}
+
+func (cartItem0011) TableName() string { return "cart_items" }
+
+type orderItem0011 struct {
+	VariantID *uint  `gorm:"index"`
+	SKU       string `gorm:"size:64"`
+}
+
+func (orderItem0011) TableName() string { return "order_items" }
+
+type stockMovement0011 struct {
+	VariantID *uint `gorm:"index"`
+}
+
+func (stockMovement0011) TableName() string { return "stock_movements" }
+
+// variantColumns lists the tables that gain a nullable, indexed variant_id.
+var variantColumns = []interface{}{&cartItem0011{}, &orderItem0011{}, &stockMovement0011{}}
+
+func init() {
+	register(Migration{
+		Version: 11,
+		Name:    "variants",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.CreateTable(&variant0011{}); err != nil {
+				return err
+			}
+			for _, model := range variantColumns {
+				if err := m.AddColumn(model, "VariantID"); err != nil {
+					return err
+				}
+				if err := m.CreateIndex(model, "VariantID"); err != nil {
+					return err
+				}
+			}
+			return m.AddColumn(&orderItem0011{}, "SKU")
+		},
+		Down: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			// Drop the indexes first: SQLite rebuilds the table to drop a
+			// column, which loses them
+			for _, model := range variantColumns {
+				if err := m.DropIndex(model, "VariantID"); err != nil {
+					return err
+				}
+			}
+			if err := dropColumn(tx, &orderItem0011{}, "SKU"); err != nil {
+				return err
+			}
+			for _, model := range variantColumns {
+				if err := dropColumn(tx, model, "VariantID"); err != nil {
+					return err
+				}
+			}
+			return m.DropTable(&variant0011{})
+		},
+	})
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type item0012 struct {
+	Version uint `gorm:"not null;default:1"`
+}
+
+func (item0012) TableName() string { return "items" }
+
+type priceChange0012 struct {
+	ID               uint   `gorm:"primaryKey"`
+	ItemID           uint   `gorm:"not null;index"`
+	OldPriceAmount   int64  `gorm:"not null"`
+	OldPriceCurrency string `gorm:"size:3;not null"`
+	NewPriceAmount   int64  `gorm:"not null"`
+	NewPriceCurrency string `gorm:"size:3;not null"`
+	UserID           *uint
+	CreatedAt        time.Time
+}
+
+func (priceChange0012) TableName() string { return "price_changes" }
+
+func init() {
+	register(Migration{
+		Version: 12,
+		Name:    "item_versions",
+		// Existing items start at version 1; their price history begins
+		// with the next change.
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Migrator().AddColumn(&item0012{}, "Version"); err != nil {
+				return err
+			}
+			return tx.Migrator().CreateTable(&priceChange0012{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&priceChange0012{}); err != nil {
+				return err
+			}
+			return dropColumn(tx, &item0012{}, "Version")
+		},
+	})
+}
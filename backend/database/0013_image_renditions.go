@@ -0,0 +1,35 @@
+package database
+
+import "gorm.io/gorm"
+
+type item0013 struct {
+	ImageMediumURL string `gorm:"not null;default:''"`
+	ImageThumbURL  string `gorm:"not null;default:''"`
+}
+
+func (item0013) TableName() string { return "items" }
+
+func init() {
+	register(Migration{
+		Version: 13,
+		Name:    "image_renditions",
+		// Images uploaded before this have no renditions; clients should
+		// fall back to image_url when these are empty.
+		Up: func(tx *gorm.DB) error {
+			for _, field := range []string{"ImageMediumURL", "ImageThumbURL"} {
+				if err := tx.Migrator().AddColumn(&item0013{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, field := range []string{"ImageThumbURL", "ImageMediumURL"} {
+				if err := dropColumn(tx, &item0013{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
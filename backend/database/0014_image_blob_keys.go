@@ -0,0 +1,92 @@
+package database
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// legacyImagePrefix is where images were served from when they were plain
+// files under static/images; the file name is their blob key now.
+const legacyImagePrefix = "/static/images/"
+
+type item0014 struct {
+	ID             uint
+	ImageURL       string
+	ImageMediumURL string `gorm:"not null;default:''"`
+	ImageThumbURL  string `gorm:"not null;default:''"`
+	ImageKey       string `gorm:"size:255;not null;default:''"`
+	ImageMediumKey string `gorm:"size:255;not null;default:''"`
+	ImageThumbKey  string `gorm:"size:255;not null;default:''"`
+}
+
+func (item0014) TableName() string { return "items" }
+
+func init() {
+	register(Migration{
+		Version: 14,
+		Name:    "image_blob_keys",
+		// Uploaded images move from URL columns to blob keys; signed URLs are
+		// generated from the keys on every response. Linked images that
+		// aren't under static/images keep their URL.
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			for _, field := range []string{"ImageKey", "ImageMediumKey", "ImageThumbKey"} {
+				if err := m.AddColumn(&item0014{}, field); err != nil {
+					return err
+				}
+			}
+			var items []item0014
+			if err := tx.Where("image_url LIKE ?", legacyImagePrefix+"%").Find(&items).Error; err != nil {
+				return err
+			}
+			for _, item := range items {
+				err := tx.Model(&item0014{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+					"image_url":        "",
+					"image_key":        strings.TrimPrefix(item.ImageURL, legacyImagePrefix),
+					"image_medium_key": strings.TrimPrefix(item.ImageMediumURL, legacyImagePrefix),
+					"image_thumb_key":  strings.TrimPrefix(item.ImageThumbURL, legacyImagePrefix),
+				}).Error
+				if err != nil {
+					return err
+				}
+			}
+			for _, field := range []string{"ImageMediumURL", "ImageThumbURL"} {
+				if err := dropColumn(tx, &item0014{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			for _, field := range []string{"ImageMediumURL", "ImageThumbURL"} {
+				if err := m.AddColumn(&item0014{}, field); err != nil {
+					return err
+				}
+			}
+			var items []item0014
+			if err := tx.Where("image_key <> ''").Find(&items).Error; err != nil {
+				return err
+			}
+			for _, item := range items {
+				urls := map[string]interface{}{"image_url": legacyImagePrefix + item.ImageKey}
+				if item.ImageMediumKey != "" {
+					urls["image_medium_url"] = legacyImagePrefix + item.ImageMediumKey
+				}
+				if item.ImageThumbKey != "" {
+					urls["image_thumb_url"] = legacyImagePrefix + item.ImageThumbKey
+				}
+				if err := tx.Model(&item0014{}).Where("id = ?", item.ID).Updates(urls).Error; err != nil {
+					return err
+				}
+			}
+			for _, field := range []string{"ImageThumbKey", "ImageMediumKey", "ImageKey"} {
+				if err := dropColumn(tx, &item0014{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
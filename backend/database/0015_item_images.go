@@ -0,0 +1,102 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type itemImage0015 struct {
+	ID        uint   `gorm:"primaryKey"`
+	ItemID    uint   `gorm:"not null;index"`
+	Position  int    `gorm:"not null;default:0"`
+	Primary   bool   `gorm:"column:is_primary;not null;default:false"`
+	AltText   string `gorm:"size:255;not null;default:''"`
+	URL       string `gorm:"size:2048;not null;default:''"`
+	Key       string `gorm:"size:255;not null;default:''"`
+	MediumKey string `gorm:"size:255;not null;default:''"`
+	ThumbKey  string `gorm:"size:255;not null;default:''"`
+	Width     int    `gorm:"not null;default:0"`
+	Height    int    `gorm:"not null;default:0"`
+	CreatedAt time.Time
+}
+
+func (itemImage0015) TableName() string { return "item_images" }
+
+type item0015 struct {
+	ID             uint
+	Name           string
+	ImageURL       string
+	ImageKey       string `gorm:"size:255;not null;default:''"`
+	ImageMediumKey string `gorm:"size:255;not null;default:''"`
+	ImageThumbKey  string `gorm:"size:255;not null;default:''"`
+}
+
+func (item0015) TableName() string { return "items" }
+
+func init() {
+	register(Migration{
+		Version: 15,
+		Name:    "item_images",
+		// Each item's single image becomes the primary image of its gallery,
+		// with the item name as alt text, and the image columns on items are
+		// dropped. Down keeps only the primary images.
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.CreateTable(&itemImage0015{}); err != nil {
+				return err
+			}
+			var items []item0015
+			if err := tx.Where("image_url <> '' OR image_key <> ''").Find(&items).Error; err != nil {
+				return err
+			}
+			for _, item := range items {
+				image := itemImage0015{
+					ItemID:    item.ID,
+					Primary:   true,
+					AltText:   item.Name,
+					URL:       item.ImageURL,
+					Key:       item.ImageKey,
+					MediumKey: item.ImageMediumKey,
+					ThumbKey:  item.ImageThumbKey,
+				}
+				if image.Key != "" {
+					image.URL = ""
+				}
+				if err := tx.Create(&image).Error; err != nil {
+					return err
+				}
+			}
+			for _, field := range []string{"ImageThumbKey", "ImageMediumKey", "ImageKey", "ImageURL"} {
+				if err := dropColumn(tx, &item0015{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			for _, field := range []string{"ImageURL", "ImageKey", "ImageMediumKey", "ImageThumbKey"} {
+				if err := m.AddColumn(&item0015{}, field); err != nil {
+					return err
+				}
+			}
+			var images []itemImage0015
+			if err := tx.Where("is_primary = ?", true).Find(&images).Error; err != nil {
+				return err
+			}
+			for _, image := range images {
+				err := tx.Model(&item0015{}).Where("id = ?", image.ItemID).Updates(map[string]interface{}{
+					"image_url":        image.URL,
+					"image_key":        image.Key,
+					"image_medium_key": image.MediumKey,
+					"image_thumb_key":  image.ThumbKey,
+				}).Error
+				if err != nil {
+					return err
+				}
+			}
+			return m.DropTable(&itemImage0015{})
+		},
+	})
+}
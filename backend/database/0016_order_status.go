@@ -0,0 +1,87 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type order0016 struct {
+	ID          uint
+	Status      string `gorm:"size:16;not null;default:pending;index"`
+	PaidAt      *time.Time
+	FulfilledAt *time.Time
+	ShippedAt   *time.Time
+	DeliveredAt *time.Time
+	CancelledAt *time.Time
+	RefundedAt  *time.Time
+	CreatedAt   time.Time
+}
+
+func (order0016) TableName() string { return "orders" }
+
+type orderStatusChange0016 struct {
+	ID         uint   `gorm:"primaryKey"`
+	OrderID    uint   `gorm:"not null;index"`
+	FromStatus string `gorm:"size:16;not null;default:''"`
+	ToStatus   string `gorm:"size:16;not null"`
+	UserID     *uint
+	Note       string `gorm:"size:255"`
+	CreatedAt  time.Time
+}
+
+func (orderStatusChange0016) TableName() string { return "order_status_changes" }
+
+var orderTimestamps0016 = []string{"PaidAt", "FulfilledAt", "ShippedAt", "DeliveredAt", "CancelledAt", "RefundedAt"}
+
+func init() {
+	register(Migration{
+		Version: 16,
+		Name:    "order_status",
+		// Existing orders become pending, with a history that starts when
+		// they were placed.
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.AddColumn(&order0016{}, "Status"); err != nil {
+				return err
+			}
+			if err := m.CreateIndex(&order0016{}, "Status"); err != nil {
+				return err
+			}
+			for _, field := range orderTimestamps0016 {
+				if err := m.AddColumn(&order0016{}, field); err != nil {
+					return err
+				}
+			}
+			if err := m.CreateTable(&orderStatusChange0016{}); err != nil {
+				return err
+			}
+			var orders []order0016
+			if err := tx.Select("id", "created_at").Find(&orders).Error; err != nil {
+				return err
+			}
+			for _, order := range orders {
+				change := orderStatusChange0016{OrderID: order.ID, ToStatus: "pending", CreatedAt: order.CreatedAt}
+				if err := tx.Create(&change).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.DropTable(&orderStatusChange0016{}); err != nil {
+				return err
+			}
+			if err := m.DropIndex(&order0016{}, "Status"); err != nil {
+				return err
+			}
+			for _, field := range append(orderTimestamps0016, "Status") {
+				if err := dropColumn(tx, &order0016{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,25 @@
+package database
+
+import "gorm.io/gorm"
+
+type order0017 struct {
+	CancelReason string `gorm:"size:255;not null;default:''"`
+}
+
+func (order0017) TableName() string { return "orders" }
+
+func init() {
+	register(Migration{
+		Version: 17,
+		Name:    "order_cancellation",
+		// Orders are cancelled now rather than deleted. Orders deleted
+		// before this stay deleted: there is no telling which were deleted
+		// by customers and which for other reasons.
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&order0017{}, "CancelReason")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumn(tx, &order0017{}, "CancelReason")
+		},
+	})
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type payment0018 struct {
+	ID               uint   `gorm:"primaryKey"`
+	OrderID          uint   `gorm:"not null;index"`
+	Gateway          string `gorm:"size:32;not null"`
+	Reference        string `gorm:"size:64;not null;default:''"`
+	AmountAmount     int64  `gorm:"not null"`
+	AmountCurrency   string `gorm:"size:3;not null"`
+	RefundedAmount   int64  `gorm:"not null"`
+	RefundedCurrency string `gorm:"size:3;not null"`
+	Status           string `gorm:"size:16;not null"`
+	FailureReason    string `gorm:"size:255;not null;default:''"`
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+func (payment0018) TableName() string { return "payments" }
+
+func init() {
+	register(Migration{
+		Version: 18,
+		Name:    "payments",
+		// Orders placed before this have no payments.
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&payment0018{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&payment0018{})
+		},
+	})
+}
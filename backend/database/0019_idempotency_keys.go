@@ -0,0 +1,36 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type idempotencyKey0019 struct {
+	ID             uint   `gorm:"primaryKey"`
+	UserID         uint   `gorm:"not null;uniqueIndex:idx_idempotency_keys_user_key"`
+	IdempotencyKey string `gorm:"size:255;not null;uniqueIndex:idx_idempotency_keys_user_key"`
+	RequestHash    string `gorm:"size:64;not null"`
+	StatusCode     int    `gorm:"not null;default:0"`
+	ContentType    string `gorm:"size:128;not null;default:''"`
+	ResponseBody   string `gorm:"type:text"`
+	CreatedAt      time.Time
+	ExpiresAt      time.Time `gorm:"not null;index"`
+}
+
+func (idempotencyKey0019) TableName() string { return "idempotency_keys" }
+
+func init() {
+	register(Migration{
+		Version: 19,
+		Name:    "idempotency_keys",
+		// Stored responses are only replayed for a while, so nothing is lost
+		// by dropping them on Down.
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().CreateTable(&idempotencyKey0019{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&idempotencyKey0019{})
+		},
+	})
+}
@@ -0,0 +1,45 @@
+package database
+
+import "gorm.io/gorm"
+
+type cartItem0020 struct {
+	PriceAmount   int64  `gorm:"not null;default:0"`
+	PriceCurrency string `gorm:"size:3;not null;default:''"`
+}
+
+func (cartItem0020) TableName() string { return "cart_items" }
+
+func init() {
+	register(Migration{
+		Version: 20,
+		Name:    "cart_item_prices",
+		// Lines already in carts take the current price of their item, or
+		// of their variant if it overrides it, so checkout reports no price
+		// change for them.
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			for _, field := range []string{"PriceAmount", "PriceCurrency"} {
+				if err := m.AddColumn(&cartItem0020{}, field); err != nil {
+					return err
+				}
+			}
+			if err := tx.Exec(`UPDATE cart_items SET
+				price_amount = COALESCE((SELECT price_amount FROM items WHERE items.id = cart_items.item_id), 0),
+				price_currency = COALESCE((SELECT price_currency FROM items WHERE items.id = cart_items.item_id), '')`).Error; err != nil {
+				return err
+			}
+			return tx.Exec(`UPDATE cart_items SET
+				price_amount = (SELECT price_override_amount FROM variants WHERE variants.id = cart_items.variant_id),
+				price_currency = (SELECT price_override_currency FROM variants WHERE variants.id = cart_items.variant_id)
+				WHERE variant_id IN (SELECT id FROM variants WHERE price_override_amount IS NOT NULL)`).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, field := range []string{"PriceAmount", "PriceCurrency"} {
+				if err := dropColumn(tx, &cartItem0020{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,350 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Migration is a single numbered schema change. Up and Down each run inside
+// their own transaction (note that MySQL implicitly commits DDL statements).
+// Migrations must not reference models.* types: they describe the schema as
+// it was at that version, so they declare their own frozen structs.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// MigrationStatus describes whether a known migration has been applied.
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// ErrLocked is returned when another process holds the migration lock for
+// longer than the runner is willing to wait.
+var ErrLocked = errors.New("migrations are locked by another process")
+
+// ErrLockLost is returned when the migration lock was taken over by another
+// process while migrations were running.
+var ErrLockLost = errors.New("migration lock was taken over by another process")
+
+var registry []Migration
+
+// register adds a migration to the global list. It is called from the init
+// function of each numbered migration file.
+func register(m Migration) {
+	for _, existing := range registry {
+		if existing.Version == m.Version {
+			panic(fmt.Sprintf("duplicate migration version %d (%s and %s)", m.Version, existing.Name, m.Name))
+		}
+	}
+	registry = append(registry, m)
+}
+
+// Migrations returns all registered migrations ordered by version.
+func Migrations() []Migration {
+	out := make([]Migration, len(registry))
+	copy(out, registry)
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out
+}
+
+// schemaMigration records an applied migration
+type schemaMigration struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"size:255;not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string { return "schema_migrations" }
+
+// schemaMigrationLock holds at most one row (ID 1) while a runner is active.
+// A plain table works the same on every supported driver, unlike advisory locks.
+type schemaMigrationLock struct {
+	ID       int       `gorm:"primaryKey;autoIncrement:false"`
+	Owner    string    `gorm:"size:255;not null"`
+	LockedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigrationLock) TableName() string { return "schema_migrations_lock" }
+
+// Runner applies and reverts migrations against a database.
+type Runner struct {
+	db         *gorm.DB
+	migrations []Migration
+
+	// LockTimeout is how long to wait for another runner to finish.
+	LockTimeout time.Duration
+	// StaleLockAfter is the age after which a lock is assumed to belong to a
+	// crashed process and is taken over. A running process refreshes its
+	// lock three times in that span, so only a dead one goes stale.
+	StaleLockAfter time.Duration
+}
+
+// NewRunner returns a Runner for all registered migrations.
+func NewRunner(db *gorm.DB) *Runner {
+	return &Runner{
+		db:             db,
+		migrations:     Migrations(),
+		LockTimeout:    2 * time.Minute,
+		StaleLockAfter: 15 * time.Minute,
+	}
+}
+
+func (r *Runner) ensureTables() error {
+	return r.db.AutoMigrate(&schemaMigration{}, &schemaMigrationLock{})
+}
+
+// heldLock is the migration lock held by this process. Its timestamp is
+// refreshed in the background until it is released.
+type heldLock struct {
+	db    *gorm.DB
+	owner string
+	stop  chan struct{}
+	done  chan struct{}
+	lost  atomic.Bool
+}
+
+func (r *Runner) lock() (*heldLock, error) {
+	host, _ := os.Hostname()
+	owner := fmt.Sprintf("%s:%d", host, os.Getpid())
+	deadline := time.Now().Add(r.LockTimeout)
+	// Losing the insert race is expected; don't log it as an error
+	quiet := r.db.Session(&gorm.Session{Logger: r.db.Logger.LogMode(logger.Silent)})
+
+	for {
+		now := time.Now()
+		if err := quiet.Create(&schemaMigrationLock{ID: 1, Owner: owner, LockedAt: now}).Error; err == nil {
+			l := &heldLock{db: r.db, owner: owner, stop: make(chan struct{}), done: make(chan struct{})}
+			go l.refresh(r.StaleLockAfter / 3)
+			return l, nil
+		}
+
+		// Someone else holds the lock; take it over if it looks abandoned
+		var held schemaMigrationLock
+		if err := r.db.First(&held, 1).Error; err == nil && now.Sub(held.LockedAt) > r.StaleLockAfter {
+			r.db.Where("id = ? AND owner = ?", 1, held.Owner).Delete(&schemaMigrationLock{})
+			continue
+		}
+
+		if now.After(deadline) {
+			return nil, ErrLocked
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// refresh bumps the lock's timestamp every interval so other runners don't
+// take it over as stale. A failed update is retried on the next tick (on
+// SQLite it may just be waiting for a migration's transaction); finding
+// the lock gone or owned by someone else marks it lost.
+func (l *heldLock) refresh(interval time.Duration) {
+	defer close(l.done)
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			res := l.db.Model(&schemaMigrationLock{}).
+				Where("id = ? AND owner = ?", 1, l.owner).
+				Update("locked_at", time.Now())
+			if res.Error == nil && res.RowsAffected == 0 {
+				l.lost.Store(true)
+				return
+			}
+		}
+	}
+}
+
+// check returns ErrLockLost once the lock has been taken over.
+func (l *heldLock) check() error {
+	if l.lost.Load() {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// release stops refreshing the lock and deletes it, unless another process
+// has taken it over since.
+func (l *heldLock) release() error {
+	close(l.stop)
+	<-l.done
+	return l.db.Where("id = ? AND owner = ?", 1, l.owner).Delete(&schemaMigrationLock{}).Error
+}
+
+func (r *Runner) applied() (map[int64]schemaMigration, error) {
+	var rows []schemaMigration
+	if err := r.db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[int64]schemaMigration, len(rows))
+	for _, row := range rows {
+		out[row.Version] = row
+	}
+	return out, nil
+}
+
+// Status lists every known migration and whether it has been applied.
+func (r *Runner) Status() ([]MigrationStatus, error) {
+	if err := r.ensureTables(); err != nil {
+		return nil, err
+	}
+	done, err := r.applied()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]MigrationStatus, 0, len(r.migrations))
+	for _, m := range r.migrations {
+		st := MigrationStatus{Version: m.Version, Name: m.Name}
+		if row, ok := done[m.Version]; ok {
+			at := row.AppliedAt
+			st.Applied = true
+			st.AppliedAt = &at
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// Pending returns the migrations that have not been applied yet.
+func (r *Runner) Pending() ([]Migration, error) {
+	if err := r.ensureTables(); err != nil {
+		return nil, err
+	}
+	done, err := r.applied()
+	if err != nil {
+		return nil, err
+	}
+	var out []Migration
+	for _, m := range r.migrations {
+		if _, ok := done[m.Version]; !ok {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+// Up applies all pending migrations in version order and returns the ones
+// that ran.
+func (r *Runner) Up() ([]Migration, error) {
+	if err := r.ensureTables(); err != nil {
+		return nil, err
+	}
+	l, err := r.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer l.release()
+
+	// Re-read under the lock so a concurrent runner's work isn't repeated
+	pending, err := r.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for _, m := range pending {
+		if err := l.check(); err != nil {
+			return ran, err
+		}
+		err := r.db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return ran, fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+// Down reverts the most recently applied migrations, at most steps of them.
+func (r *Runner) Down(steps int) ([]Migration, error) {
+	if err := r.ensureTables(); err != nil {
+		return nil, err
+	}
+	l, err := r.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer l.release()
+
+	done, err := r.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	for i := len(r.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		m := r.migrations[i]
+		if _, ok := done[m.Version]; !ok {
+			continue
+		}
+		if m.Down == nil {
+			return reverted, fmt.Errorf("migration %d (%s) is irreversible", m.Version, m.Name)
+		}
+		if err := l.check(); err != nil {
+			return reverted, err
+		}
+		err := r.db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("reverting migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		reverted = append(reverted, m)
+	}
+	return reverted, nil
+}
+
+// dropColumn drops field from model's table. SQLite drops a column by
+// rebuilding the table, which also drops every index on it, so there the
+// table's indexes are recreated afterwards. Indexes on the column itself
+// must be dropped first.
+func dropColumn(tx *gorm.DB, model interface{}, field string) error {
+	var indexes []string
+	if tx.Dialector.Name() == "sqlite" {
+		stmt := &gorm.Statement{DB: tx}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		err := tx.Raw("SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", stmt.Table).
+			Scan(&indexes).Error
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Migrator().DropColumn(model, field); err != nil {
+		return err
+	}
+	for _, sql := range indexes {
+		sql = strings.Replace(sql, "INDEX ", "INDEX IF NOT EXISTS ", 1)
+		if err := tx.Exec(sql).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
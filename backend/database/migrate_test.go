@@ -0,0 +1,167 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"shopping-cart/config"
+
+	"gorm.io/gorm"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := config.Open(config.DriverSQLite, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	return db
+}
+
+func TestLockIsRefreshedWhileHeld(t *testing.T) {
+	db := openTestDB(t)
+	r := NewRunner(db)
+	r.StaleLockAfter = 150 * time.Millisecond
+	if err := r.ensureTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := r.lock()
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	defer l.release()
+
+	// Well past StaleLockAfter, a live lock must not look abandoned
+	time.Sleep(3 * r.StaleLockAfter)
+	other := NewRunner(db)
+	other.StaleLockAfter = r.StaleLockAfter
+	other.LockTimeout = 0
+	if _, err := other.lock(); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second lock: got %v, want ErrLocked", err)
+	}
+	if err := l.check(); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+}
+
+func TestLockLostWhenTakenOver(t *testing.T) {
+	db := openTestDB(t)
+	r := NewRunner(db)
+	r.StaleLockAfter = 90 * time.Millisecond
+	if err := r.ensureTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := r.lock()
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	// Another runner found the lock stale and took it over
+	db.Model(&schemaMigrationLock{}).Where("id = ?", 1).Update("owner", "other:1")
+
+	deadline := time.Now().Add(time.Second)
+	for l.check() == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := l.check(); !errors.Is(err, ErrLockLost) {
+		t.Fatalf("check: got %v, want ErrLockLost", err)
+	}
+
+	// Releasing a lost lock leaves the new owner's row alone
+	if err := l.release(); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	var held schemaMigrationLock
+	if err := db.First(&held, 1).Error; err != nil || held.Owner != "other:1" {
+		t.Fatalf("lock row after release: %+v, %v", held, err)
+	}
+}
+
+// sqliteSchema returns the columns and index definitions of every table,
+// in a stable order, for comparing databases.
+func sqliteSchema(t *testing.T, db *gorm.DB) []string {
+	t.Helper()
+	var tables []string
+	if err := db.Raw("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name").Scan(&tables).Error; err != nil {
+		t.Fatal(err)
+	}
+	var schema []string
+	for _, table := range tables {
+		var columns []struct {
+			Name, Type string
+			NotNull    bool `gorm:"column:notnull"`
+		}
+		db.Raw("SELECT name, type, \"notnull\" FROM pragma_table_info(?) ORDER BY name", table).Scan(&columns)
+		for _, c := range columns {
+			schema = append(schema, fmt.Sprintf("%s.%s %s notnull=%v", table, c.Name, c.Type, c.NotNull))
+		}
+		var indexes []string
+		db.Raw("SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL ORDER BY name", table).Scan(&indexes)
+		schema = append(schema, indexes...)
+	}
+	return schema
+}
+
+func TestDropColumnKeepsIndexes(t *testing.T) {
+	type widget struct {
+		ID    uint   `gorm:"primaryKey"`
+		Name  string `gorm:"index"`
+		Price int
+		Stock int
+		Note  string
+	}
+	db := openTestDB(t)
+	if err := db.Migrator().CreateTable(&widget{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("CREATE INDEX idx_widgets_price_id ON widgets (price, id)").Error; err != nil {
+		t.Fatal(err)
+	}
+	before := sqliteSchema(t, db)
+
+	if err := dropColumn(db, &widget{}, "Note"); err != nil {
+		t.Fatalf("dropColumn: %v", err)
+	}
+	after := sqliteSchema(t, db)
+	var want []string
+	for _, line := range before {
+		if !strings.HasPrefix(line, "widgets.note ") {
+			want = append(want, line)
+		}
+	}
+	if strings.Join(after, "\n") != strings.Join(want, "\n") {
+		t.Errorf("schema after dropping a column:\n%s\nwant\n%s", strings.Join(after, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestMigrationsRoundTrip(t *testing.T) {
+	fresh := openTestDB(t)
+	if _, err := NewRunner(fresh).Up(); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	want := sqliteSchema(t, fresh)
+
+	// Reverting any number of migrations and reapplying them leaves the
+	// same schema as a fresh database
+	db := openTestDB(t)
+	r := NewRunner(db)
+	if _, err := r.Up(); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	for steps := 1; steps <= len(registry); steps++ {
+		if _, err := r.Down(steps); err != nil {
+			t.Fatalf("down %d: %v", steps, err)
+		}
+		if _, err := r.Up(); err != nil {
+			t.Fatalf("up after down %d: %v", steps, err)
+		}
+		if got := sqliteSchema(t, db); strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Fatalf("schema after down %d and up differs from a fresh database", steps)
+		}
+	}
+}
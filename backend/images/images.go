@@ -0,0 +1,131 @@
+// Package images validates uploaded images and generates resized
+// renditions of them.
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // registers the GIF decoder
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+var (
+	// ErrTooLarge is returned when the file or its pixel count exceeds the
+	// configured limits.
+	ErrTooLarge = errors.New("image is too large")
+	// ErrUnsupportedType is returned when the content isn't one of the
+	// allowed image formats, whatever its name or declared type.
+	ErrUnsupportedType = errors.New("unsupported image type")
+	// ErrInvalidImage is returned when the content claims to be an allowed
+	// format but can't be decoded.
+	ErrInvalidImage = errors.New("invalid image")
+)
+
+// formats maps the sniffed MIME types we accept to their file extension
+// and the decoder's format name.
+var formats = map[string]struct{ ext, name string }{
+	"image/jpeg": {".jpg", "jpeg"},
+	"image/png":  {".png", "png"},
+	"image/gif":  {".gif", "gif"},
+}
+
+// Size is a rendition to generate: Max bounds the longer side in pixels.
+type Size struct {
+	Name string
+	Max  int
+}
+
+// Options are the limits and renditions Process applies.
+type Options struct {
+	MaxBytes  int64
+	MaxPixels int
+	Sizes     []Size
+}
+
+// File is encoded image data ready to be stored.
+type File struct {
+	Data        []byte
+	ContentType string
+	Ext         string
+	Width       int
+	Height      int
+}
+
+// Image is a validated upload: the original as received and one resized
+// rendition per requested size, keyed by Size.Name.
+type Image struct {
+	Original   File
+	Renditions map[string]File
+}
+
+// Process checks that data is an allowed image within the limits in opts
+// and generates its renditions. JPEGs are re-encoded as JPEG, everything
+// else as PNG; renditions are never larger than the original.
+func Process(data []byte, opts Options) (*Image, error) {
+	if opts.MaxBytes > 0 && int64(len(data)) > opts.MaxBytes {
+		return nil, ErrTooLarge
+	}
+	contentType := http.DetectContentType(data)
+	format, ok := formats[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedType, contentType)
+	}
+
+	// Check the dimensions from the header before decoding the pixels
+	cfg, name, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || name != format.name {
+		return nil, ErrInvalidImage
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, ErrInvalidImage
+	}
+	if opts.MaxPixels > 0 && cfg.Width*cfg.Height > opts.MaxPixels {
+		return nil, ErrTooLarge
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	img := &Image{
+		Original: File{
+			Data:        data,
+			ContentType: contentType,
+			Ext:         format.ext,
+			Width:       cfg.Width,
+			Height:      cfg.Height,
+		},
+		Renditions: map[string]File{},
+	}
+	var prev image.Image
+	for _, size := range opts.Sizes {
+		w, h := fit(cfg.Width, cfg.Height, size.Max)
+		// Downscale from the previous rendition when it's big enough, which
+		// is much cheaper than going back to the original each time
+		from := src
+		if prev != nil && prev.Bounds().Dx() >= w && prev.Bounds().Dy() >= h {
+			from = prev
+		}
+		resized := resize(from, w, h)
+		prev = resized
+		var buf bytes.Buffer
+		file := File{Width: w, Height: h}
+		if contentType == "image/jpeg" {
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+			file.ContentType, file.Ext = "image/jpeg", ".jpg"
+		} else {
+			err = png.Encode(&buf, resized)
+			file.ContentType, file.Ext = "image/png", ".png"
+		}
+		if err != nil {
+			return nil, err
+		}
+		file.Data = buf.Bytes()
+		img.Renditions[size.Name] = file
+	}
+	return img, nil
+}
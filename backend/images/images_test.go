@@ -0,0 +1,115 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// encode returns a w×h image in format (jpeg, png or gif).
+func encode(t *testing.T, format string, w, h int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "png":
+		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcessLimits(t *testing.T) {
+	small := encode(t, "png", 40, 30)
+	tests := []struct {
+		name string
+		data []byte
+		opts Options
+		want error
+	}{
+		{"within limits", small, Options{MaxBytes: int64(len(small)), MaxPixels: 40 * 30}, nil},
+		{"no limits", small, Options{}, nil},
+		{"one byte over", small, Options{MaxBytes: int64(len(small)) - 1}, ErrTooLarge},
+		{"one pixel over", small, Options{MaxPixels: 40*30 - 1}, ErrTooLarge},
+		{"text", []byte("hello, this is not an image"), Options{}, ErrUnsupportedType},
+		{"empty", nil, Options{}, ErrUnsupportedType},
+		{"bmp", append([]byte("BM"), make([]byte, 64)...), Options{}, ErrUnsupportedType},
+		// Sniffed as a PNG, but the rest doesn't decode
+		{"truncated png", small[:len(small)/2], Options{}, ErrInvalidImage},
+		{"png signature only", small[:8], Options{}, ErrInvalidImage},
+	}
+	for _, tt := range tests {
+		if _, err := Process(tt.data, tt.opts); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestProcessRenditions(t *testing.T) {
+	sizes := []Size{{Name: "medium", Max: 60}, {Name: "thumb", Max: 20}, {Name: "huge", Max: 1000}}
+	tests := []struct {
+		format   string
+		wantType string
+		wantExt  string
+	}{
+		{"jpeg", "image/jpeg", ".jpg"},
+		{"png", "image/png", ".png"},
+		// Only JPEGs stay JPEG; everything else becomes PNG
+		{"gif", "image/png", ".png"},
+	}
+	for _, tt := range tests {
+		img, err := Process(encode(t, tt.format, 120, 80), Options{Sizes: sizes})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		if o := img.Original; o.Width != 120 || o.Height != 80 || o.ContentType != "image/"+tt.format {
+			t.Errorf("%s original: %dx%d %s", tt.format, o.Width, o.Height, o.ContentType)
+		}
+
+		want := map[string][2]int{"medium": {60, 40}, "thumb": {20, 13}, "huge": {120, 80}}
+		for name, size := range want {
+			r := img.Renditions[name]
+			if r.Width != size[0] || r.Height != size[1] || r.ContentType != tt.wantType || r.Ext != tt.wantExt {
+				t.Errorf("%s %s: %dx%d %s %s", tt.format, name, r.Width, r.Height, r.ContentType, r.Ext)
+				continue
+			}
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(r.Data))
+			if err != nil || cfg.Width != size[0] || cfg.Height != size[1] {
+				t.Errorf("%s %s decodes as %dx%d, %v", tt.format, name, cfg.Width, cfg.Height, err)
+			}
+		}
+	}
+}
+
+func TestFit(t *testing.T) {
+	tests := []struct{ w, h, max, wantW, wantH int }{
+		{1200, 800, 600, 600, 400},
+		{800, 1200, 600, 400, 600},
+		{300, 200, 600, 300, 200},
+		{600, 600, 600, 600, 600},
+		{5000, 10, 100, 100, 1},
+		{300, 200, 0, 300, 200},
+	}
+	for _, tt := range tests {
+		if w, h := fit(tt.w, tt.h, tt.max); w != tt.wantW || h != tt.wantH {
+			t.Errorf("fit(%d, %d, %d) = %d, %d; want %d, %d", tt.w, tt.h, tt.max, w, h, tt.wantW, tt.wantH)
+		}
+	}
+}
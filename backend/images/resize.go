@@ -0,0 +1,64 @@
+package images
+
+import "image"
+
+// fit scales w×h down to fit within max×max, keeping the aspect ratio.
+// Images that already fit are left as they are.
+func fit(w, h, max int) (int, int) {
+	if max <= 0 || (w <= max && h <= max) {
+		return w, h
+	}
+	if w >= h {
+		return max, atLeastOne(h * max / w)
+	}
+	return atLeastOne(w * max / h), max
+}
+
+func atLeastOne(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// resize scales src to w×h by averaging the source pixels each destination
+// pixel covers (a box filter), which is good enough for downscaling
+// product photos. Colors are averaged premultiplied so transparent pixels
+// don't darken the edges.
+func resize(src image.Image, w, h int) *image.NRGBA {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + y*sh/h
+		y1 := b.Min.Y + (y+1)*sh/h
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*sw/w
+			x1 := b.Min.X + (x+1)*sw/w
+			if x1 == x0 {
+				x1++
+			}
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			if a == 0 {
+				continue
+			}
+			// Un-premultiply and scale 16-bit channels down to 8 bits
+			dst.Pix[i+0] = uint8(r * 0xffff / a >> 8)
+			dst.Pix[i+1] = uint8(g * 0xffff / a >> 8)
+			dst.Pix[i+2] = uint8(bl * 0xffff / a >> 8)
+			dst.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+	return dst
+}
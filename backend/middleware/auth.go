@@ -2,62 +2,129 @@ package middleware
 
 import (
 	"net/http"
-	"shopping-cart/config"
+	"shopping-cart/auth"
 	"shopping-cart/models"
+	"shopping-cart/store"
 	"strings"
-	"time" // This line is already present, so we don't need to remove it.
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware validates the user token
-func AuthMiddleware() gin.HandlerFunc {
+// touchInterval limits how often a session's last-used time is written
+const touchInterval = time.Minute
+
+// bearerToken extracts the token from the Authorization header. On failure
+// it writes the 401 response, aborts, and returns false.
+func bearerToken(c *gin.Context) (string, bool) {
+	// Get token from Authorization header
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+		c.Abort()
+		return "", false
+	}
+
+	// Extract token (format: "Bearer <token>")
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization format"})
+		c.Abort()
+		return "", false
+	}
+
+	return parts[1], true
+}
+
+// AuthMiddleware validates the user token against the session store
+func AuthMiddleware(sessions store.SessionStore, users store.UserStore, tokens *auth.TokenHasher) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get token from Authorization header
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			c.Abort()
+		token, ok := bearerToken(c)
+		if !ok {
 			return
 		}
 
-		// Extract token (format: "Bearer <token>")
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization format"})
+		// Validate token by looking up in sessions table
+		// Sessions are stored by token hash only
+		session, err := sessions.GetByTokenHash(tokens.Hash(token))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
-		token := parts[1]
+		// Check expiry
+		now := time.Now()
+		if session.Expired(now) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
+			c.Abort()
+			return
+		}
 
-		// Validate token by looking up in sessions table
-		var session models.Session
-		if err := config.DB.Where("token = ?", token).First(&session).Error; err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		user, err := users.Get(session.UserID)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session user"})
 			c.Abort()
 			return
 		}
 
-		// Optional: check expiry
-		if session.ExpiresAt != nil {
-			// if expired
-			if session.ExpiresAt.Before(time.Now()) {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
-				c.Abort()
-				return
-			}
+		// Record activity for the device list, at most once per touchInterval
+		if session.LastUsedAt == nil || now.Sub(*session.LastUsedAt) > touchInterval {
+			sessions.Touch(session.ID, now)
 		}
 
-		var user models.User
-		if err := config.DB.First(&user, session.UserID).Error; err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session user"})
+		c.Set("user_id", user.ID)
+		c.Set("user", *user)
+		c.Set("session_id", session.ID)
+		c.Next()
+	}
+}
+
+// JWTAuthMiddleware validates a signed access token without touching the
+// database. The user on the context is built from the token's claims, so a
+// role change or revoked session only takes effect once the (short-lived)
+// access token expires.
+func JWTAuthMiddleware(keys *auth.KeySet, issuer string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := bearerToken(c)
+		if !ok {
+			return
+		}
+
+		claims, err := keys.Verify(token, issuer)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
-		c.Set("user_id", user.ID)
-		c.Set("user", user)
+		c.Set("user_id", claims.UserID)
+		c.Set("user", models.User{ID: claims.UserID, Username: claims.Username, Role: claims.Role})
+		c.Set("session_id", claims.SessionID)
 		c.Next()
 	}
 }
+
+// RequireRole only lets through users holding one of the given roles. It must
+// run after AuthMiddleware, which puts the user on the context.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, exists := c.Get("user")
+		user, ok := value.(models.User)
+		if !exists || !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.Abort()
+			return
+		}
+
+		for _, role := range roles {
+			if user.Role == role {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		c.Abort()
+	}
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"shopping-cart/auth"
+	"shopping-cart/models"
+	"shopping-cart/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serve runs one request through handlers, ending in a handler that
+// answers 200, and returns the status code.
+func serve(handlers ...gin.HandlerFunc) int {
+	return serveToken("", handlers...)
+}
+
+// serveToken is serve with token sent as a bearer token, if not empty.
+func serveToken(token string, handlers ...gin.HandlerFunc) int {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	handlers = append(handlers, func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/", handlers...)
+	req := httptest.NewRequest("GET", "/", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+// withUser stands in for AuthMiddleware, putting user on the context.
+func withUser(user interface{}) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		name  string
+		user  gin.HandlerFunc
+		roles []string
+		want  int
+	}{
+		{"no user", nil, []string{models.RoleAdmin}, http.StatusUnauthorized},
+		{"not a user", withUser("admin"), []string{models.RoleAdmin}, http.StatusUnauthorized},
+		{"wrong role", withUser(models.User{Role: models.RoleCustomer}), []string{models.RoleAdmin}, http.StatusForbidden},
+		{"right role", withUser(models.User{Role: models.RoleAdmin}), []string{models.RoleAdmin}, http.StatusOK},
+		{"one of several", withUser(models.User{Role: models.RoleCustomer}), []string{models.RoleAdmin, models.RoleCustomer}, http.StatusOK},
+		{"no roles allowed", withUser(models.User{Role: models.RoleAdmin}), nil, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		handlers := []gin.HandlerFunc{}
+		if tt.user != nil {
+			handlers = append(handlers, tt.user)
+		}
+		handlers = append(handlers, RequireRole(tt.roles...))
+		if got := serve(handlers...); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAuthMiddlewareSessionExpiry(t *testing.T) {
+	s := store.NewMemoryStores()
+	tokens := auth.NewTokenHasher([]byte("test-secret"))
+	user := &models.User{Username: "shopper", Password: "x", Role: models.RoleCustomer}
+	if err := s.Users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	tests := []struct {
+		name      string
+		expiresAt *time.Time
+		want      int
+	}{
+		{"live", &future, http.StatusOK},
+		{"expired", &past, http.StatusUnauthorized},
+		{"unlimited", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		token := tt.name + "-token"
+		session := &models.Session{UserID: user.ID, TokenHash: tokens.Hash(token), CreatedAt: now, ExpiresAt: tt.expiresAt}
+		if err := s.Sessions.Create(session); err != nil {
+			t.Fatal(err)
+		}
+		if got := serveToken(token, AuthMiddleware(s.Sessions, s.Users, tokens)); got != tt.want {
+			t.Errorf("%s session: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	// A request marks the session used, for the device list
+	live, _ := s.Sessions.GetByTokenHash(tokens.Hash("live-token"))
+	if live.LastUsedAt == nil {
+		t.Error("LastUsedAt not set after a request")
+	}
+}
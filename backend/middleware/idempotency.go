@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"shopping-cart/models"
+	"shopping-cart/store"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyHeader names the request header carrying a client's
+// idempotency key.
+const IdempotencyHeader = "Idempotency-Key"
+
+// ReplayedHeader is set on responses replayed from an earlier request.
+const ReplayedHeader = "Idempotent-Replayed"
+
+const (
+	// maxIdempotencyKey matches the size of the idempotency_key column
+	maxIdempotencyKey = 255
+	// maxIdempotentBody bounds the request bodies read for hashing
+	maxIdempotentBody = 1 << 20
+	// purgeInterval limits how often expired keys are deleted
+	purgeInterval = time.Hour
+)
+
+// recordingWriter keeps a copy of the response body as it is written.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// retryable reports whether a response with status is a temporary outcome
+// that the same request may get past when retried, such as a conflict the
+// client resolves or a rate limit. Those responses are not stored.
+func retryable(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusUnprocessableEntity, http.StatusTooManyRequests:
+		return true
+	}
+	return status >= http.StatusInternalServerError
+}
+
+// requestHash identifies a request by user, method, path, query and body,
+// so a key reused for a different request can be told apart from a retry.
+func requestHash(userID uint, r *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d %s %s?%s\n", userID, r.Method, r.URL.Path, r.URL.RawQuery)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Idempotency makes a route safe to retry. When a request carries an
+// Idempotency-Key header, the first response for that user and key is
+// stored and replayed for any retry within ttl, instead of running the
+// handler again. Requests without the header are handled as usual.
+//
+// Server errors and other retryable outcomes, such as a 409 asking the
+// client to confirm a changed cart, are not stored, so a retry after one
+// runs the handler again. A retry that arrives while the first request is
+// still running gets 409; after inFlight the first request is taken to be
+// lost, say to a crash, and the retry runs instead. It must run after the
+// auth middleware.
+func Idempotency(keys store.IdempotencyStore, ttl, inFlight time.Duration) gin.HandlerFunc {
+	var lastPurge atomic.Int64
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentBody))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large"})
+			} else {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			}
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := time.Now()
+		if last := lastPurge.Load(); now.Sub(time.Unix(0, last)) >= purgeInterval && lastPurge.CompareAndSwap(last, now.UnixNano()) {
+			if _, err := keys.DeleteExpired(now); err != nil {
+				log.Println("Failed to delete expired idempotency keys:", err)
+			}
+		}
+
+		userID := c.GetUint("user_id")
+		record := &models.IdempotencyKey{
+			UserID:      userID,
+			Key:         key,
+			RequestHash: requestHash(userID, c.Request, body),
+			ExpiresAt:   now.Add(inFlight),
+		}
+		existing, err := keys.Claim(record, now)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check Idempotency-Key"})
+			c.Abort()
+			return
+		}
+		if existing != nil {
+			switch {
+			case existing.RequestHash != record.RequestHash:
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+			case existing.StatusCode == 0:
+				c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still being processed"})
+			default:
+				c.Header(ReplayedHeader, "true")
+				c.Data(existing.StatusCode, existing.ContentType, []byte(existing.ResponseBody))
+			}
+			c.Abort()
+			return
+		}
+
+		// The claim is released unless the response is stored, including
+		// when the handler panics
+		stored := false
+		defer func() {
+			if !stored {
+				if err := keys.Release(record.ID); err != nil {
+					log.Println("Failed to release Idempotency-Key:", err)
+				}
+			}
+		}()
+
+		w := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+
+		if status := w.Status(); !retryable(status) {
+			err := keys.Complete(record.ID, status, w.Header().Get("Content-Type"), w.body.String(), time.Now().Add(ttl))
+			if err != nil {
+				log.Println("Failed to store idempotent response:", err)
+			}
+			stored = err == nil
+		}
+	}
+}
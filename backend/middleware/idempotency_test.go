@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestHash(t *testing.T) {
+	base := requestHash(1, httptest.NewRequest("POST", "/orders?currency=EUR", nil), []byte(`{"cart_id":1}`))
+	tests := []struct {
+		name   string
+		userID uint
+		method string
+		target string
+		body   string
+	}{
+		{"another user", 2, "POST", "/orders?currency=EUR", `{"cart_id":1}`},
+		{"another method", 1, "PUT", "/orders?currency=EUR", `{"cart_id":1}`},
+		{"another path", 1, "POST", "/carts?currency=EUR", `{"cart_id":1}`},
+		{"another query", 1, "POST", "/orders?currency=GBP", `{"cart_id":1}`},
+		{"no query", 1, "POST", "/orders", `{"cart_id":1}`},
+		{"another body", 1, "POST", "/orders?currency=EUR", `{"cart_id":2}`},
+	}
+	for _, tt := range tests {
+		if got := requestHash(tt.userID, httptest.NewRequest(tt.method, tt.target, nil), []byte(tt.body)); got == base {
+			t.Errorf("%s: same hash as the original request", tt.name)
+		}
+	}
+	if got := requestHash(1, httptest.NewRequest("POST", "/orders?currency=EUR", nil), []byte(`{"cart_id":1}`)); got != base {
+		t.Errorf("identical request: hash %s, want %s", got, base)
+	}
+}
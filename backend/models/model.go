@@ -1,31 +1,195 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"shopping-cart/money"
 	"time"
 
 	"gorm.io/gorm"
 )
 
+// Roles a user can have. Every new user is a customer; admins manage the
+// catalog and can see every user's carts and orders.
+const (
+	RoleCustomer = "customer"
+	RoleAdmin    = "admin"
+)
+
 // User model
 type User struct {
 	ID        uint           `gorm:"primaryKey" json:"id"`
 	Username  string         `gorm:"unique;not null" json:"username"`
 	Password  string         `gorm:"not null" json:"-"`
+	Role      string         `gorm:"size:32;not null;default:customer" json:"role"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
-// Item model
+// IsAdmin reports whether the user has the admin role
+func (u User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// DefaultMaxPerOrder caps the quantity of a single item in a cart or order
+// when the item doesn't set its own MaxPerOrder.
+const DefaultMaxPerOrder = 99
+
+// Item model. Version is bumped by every edit and backs the item's ETag.
 type Item struct {
-	ID          uint           `gorm:"primaryKey" json:"id"`
-	Name        string         `gorm:"not null" json:"name"`
-	Price       float64        `gorm:"not null" json:"price"`
-	Description string         `json:"description"`
-	ImageURL    string         `json:"image_url"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID          uint        `gorm:"primaryKey" json:"id"`
+	Name        string      `gorm:"not null" json:"name"`
+	Price       money.Money `gorm:"embedded;embeddedPrefix:price_" json:"price"`
+	Description string      `json:"description"`
+	// The image URLs are those of the primary gallery image, for clients
+	// that show a single picture. They are filled when the item is served.
+	ImageURL       string         `gorm:"-" json:"image_url"`
+	ImageMediumURL string         `gorm:"-" json:"image_medium_url"`
+	ImageThumbURL  string         `gorm:"-" json:"image_thumb_url"`
+	MaxPerOrder    int            `gorm:"not null;default:0" json:"max_per_order"`
+	Stock          int            `gorm:"not null;default:0" json:"stock"`
+	Version        uint           `gorm:"not null;default:1" json:"version"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+	Categories     []Category     `gorm:"many2many:item_categories" json:"categories,omitempty"`
+	Variants       []Variant      `gorm:"foreignKey:ItemID" json:"variants,omitempty"`
+	Images         []ItemImage    `gorm:"foreignKey:ItemID" json:"images"`
+	// DisplayPrice is Price converted to the currency the client asked
+	// for; it is only set when that differs from the base currency.
+	DisplayPrice *money.Money `gorm:"-" json:"display_price,omitempty"`
+}
+
+// QuantityLimit returns the most units of the item one cart may hold
+func (i Item) QuantityLimit() int {
+	if i.MaxPerOrder > 0 {
+		return i.MaxPerOrder
+	}
+	return DefaultMaxPerOrder
+}
+
+// ItemImage is one picture in an item's gallery. Galleries are ordered by
+// Position, and exactly one image of an item is Primary. Uploaded images
+// are kept in blob storage under the *Key fields and served with signed
+// URLs; linked images only have a URL.
+type ItemImage struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ItemID    uint      `gorm:"not null;index" json:"item_id"`
+	Position  int       `gorm:"not null;default:0" json:"position"`
+	Primary   bool      `gorm:"column:is_primary;not null;default:false" json:"primary"`
+	AltText   string    `gorm:"size:255;not null;default:''" json:"alt_text"`
+	URL       string    `gorm:"size:2048;not null;default:''" json:"url"`
+	MediumURL string    `gorm:"-" json:"medium_url"`
+	ThumbURL  string    `gorm:"-" json:"thumb_url"`
+	Key       string    `gorm:"size:255;not null;default:''" json:"-"`
+	MediumKey string    `gorm:"size:255;not null;default:''" json:"-"`
+	ThumbKey  string    `gorm:"size:255;not null;default:''" json:"-"`
+	Width     int       `gorm:"not null;default:0" json:"width,omitempty"`
+	Height    int       `gorm:"not null;default:0" json:"height,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PrimaryImage returns the item's primary gallery image, or nil if it has
+// none.
+func (i Item) PrimaryImage() *ItemImage {
+	for j := range i.Images {
+		if i.Images[j].Primary {
+			return &i.Images[j]
+		}
+	}
+	return nil
+}
+
+// PriceChange records one change to an item's price.
+type PriceChange struct {
+	ID        uint        `gorm:"primaryKey" json:"id"`
+	ItemID    uint        `gorm:"not null;index" json:"item_id"`
+	OldPrice  money.Money `gorm:"embedded;embeddedPrefix:old_price_" json:"old_price"`
+	NewPrice  money.Money `gorm:"embedded;embeddedPrefix:new_price_" json:"new_price"`
+	UserID    *uint       `json:"user_id,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// VariantOptions are the option values that tell an item's variants
+// apart, e.g. {"size": "M", "color": "red"}. They are stored as JSON.
+type VariantOptions map[string]string
+
+// Value implements driver.Valuer.
+func (o VariantOptions) Value() (driver.Value, error) {
+	if o == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(o)
+	return string(b), err
+}
+
+// Scan implements sql.Scanner.
+func (o *VariantOptions) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	case nil:
+		*o = nil
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into VariantOptions", src)
+	}
+	return json.Unmarshal(b, o)
+}
+
+// Equal reports whether o and other hold the same options.
+func (o VariantOptions) Equal(other VariantOptions) bool {
+	if len(o) != len(other) {
+		return false
+	}
+	for k, v := range o {
+		if w, ok := other[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Variant is one purchasable version of an item, such as a shirt in size M
+// and red. An item with variants is sold only through them: each has its
+// own SKU and stock, and may override the item's price.
+type Variant struct {
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	ItemID        uint           `gorm:"not null;index" json:"item_id"`
+	SKU           string         `gorm:"size:64;not null;uniqueIndex" json:"sku"`
+	Options       VariantOptions `gorm:"type:text;not null" json:"options"`
+	PriceOverride *money.Money   `gorm:"embedded;embeddedPrefix:price_override_" json:"price_override,omitempty"`
+	Stock         int            `gorm:"not null;default:0" json:"stock"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// Price returns the variant's price: its override if set, otherwise the
+// price of item.
+func (v Variant) Price(item Item) money.Money {
+	if v.PriceOverride != nil {
+		return *v.PriceOverride
+	}
+	return item.Price
+}
+
+// Category groups items for navigation. Categories nest through ParentID;
+// an item can be in any number of categories.
+type Category struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+	Slug      string    `gorm:"size:120;uniqueIndex;not null" json:"slug"`
+	ParentID  *uint     `gorm:"index" json:"parent_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Children is only filled in when categories are returned as a tree.
+	Children []Category `gorm:"-" json:"children,omitempty"`
 }
 
 // Cart model
@@ -41,25 +205,161 @@ type Cart struct {
 
 // CartItem - junction table for Cart and Item
 type CartItem struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	CartID    uint           `gorm:"not null" json:"cart_id"`
-	ItemID    uint           `gorm:"not null" json:"item_id"`
-	Item      Item           `gorm:"foreignKey:ItemID" json:"item,omitempty"`
-	Quantity  int            `gorm:"default:1" json:"quantity"`
+	ID        uint     `gorm:"primaryKey" json:"id"`
+	CartID    uint     `gorm:"not null" json:"cart_id"`
+	ItemID    uint     `gorm:"not null" json:"item_id"`
+	Item      Item     `gorm:"foreignKey:ItemID" json:"item,omitempty"`
+	VariantID *uint    `gorm:"index" json:"variant_id,omitempty"`
+	Variant   *Variant `gorm:"foreignKey:VariantID" json:"variant,omitempty"`
+	Quantity  int      `gorm:"default:1" json:"quantity"`
+	// Price is the unit price, in the base currency, the shopper saw when
+	// the line was added. Checkout compares it with UnitPrice.
+	Price     money.Money    `gorm:"embedded;embeddedPrefix:price_" json:"price"`
 	CreatedAt time.Time      `json:"created_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
-// Order model
+// Available reports whether the line can still be bought: its item, and
+// its variant if it has one, have not been deleted since it was added.
+// Deleted items and variants are loaded as zero values.
+func (ci CartItem) Available() bool {
+	return ci.Item.ID != 0 && (ci.VariantID == nil || ci.Variant != nil)
+}
+
+// UnitPrice returns the price of one unit of the line: the variant's price
+// if a variant was chosen, otherwise the item's.
+func (ci CartItem) UnitPrice() money.Money {
+	if ci.Variant != nil {
+		return ci.Variant.Price(ci.Item)
+	}
+	return ci.Item.Price
+}
+
+// Order model. Total and the items' prices are in the currency the order
+// was placed in; BaseTotal is the same amount in the base currency and
+// ExchangeRate the base-to-order-currency rate used at checkout. Each of
+// the status timestamps is set when the order enters that status.
 type Order struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	UserID    uint           `gorm:"not null" json:"user_id"`
-	User      User           `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	Items     []OrderItem    `gorm:"foreignKey:OrderID" json:"items,omitempty"`
-	Total     float64        `json:"total"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID            uint                `gorm:"primaryKey" json:"id"`
+	UserID        uint                `gorm:"not null" json:"user_id"`
+	User          User                `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Items         []OrderItem         `gorm:"foreignKey:OrderID" json:"items,omitempty"`
+	Total         money.Money         `gorm:"embedded;embeddedPrefix:total_" json:"total"`
+	BaseTotal     money.Money         `gorm:"embedded;embeddedPrefix:base_total_" json:"base_total"`
+	ExchangeRate  string              `gorm:"size:32;not null;default:'1'" json:"exchange_rate"`
+	Status        string              `gorm:"size:16;not null;default:pending;index" json:"status"`
+	PaidAt        *time.Time          `json:"paid_at,omitempty"`
+	FulfilledAt   *time.Time          `json:"fulfilled_at,omitempty"`
+	ShippedAt     *time.Time          `json:"shipped_at,omitempty"`
+	DeliveredAt   *time.Time          `json:"delivered_at,omitempty"`
+	CancelledAt   *time.Time          `json:"cancelled_at,omitempty"`
+	RefundedAt    *time.Time          `json:"refunded_at,omitempty"`
+	CancelReason  string              `gorm:"size:255;not null;default:''" json:"cancel_reason,omitempty"`
+	StatusHistory []OrderStatusChange `gorm:"foreignKey:OrderID" json:"status_history,omitempty"`
+	Payments      []Payment           `gorm:"foreignKey:OrderID" json:"payments,omitempty"`
+	CreatedAt     time.Time           `json:"created_at"`
+	UpdatedAt     time.Time           `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt      `gorm:"index" json:"-"`
+}
+
+// Order statuses. An order is placed pending and moves along
+// OrderTransitions; cancelled and refunded are final.
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusPaid      = "paid"
+	OrderStatusFulfilled = "fulfilled"
+	OrderStatusShipped   = "shipped"
+	OrderStatusDelivered = "delivered"
+	OrderStatusCancelled = "cancelled"
+	OrderStatusRefunded  = "refunded"
+)
+
+// OrderTransitions lists the statuses an order may move to from each
+// status. Orders can be cancelled until they ship; after that the money
+// goes back through a refund.
+var OrderTransitions = map[string][]string{
+	OrderStatusPending:   {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:      {OrderStatusFulfilled, OrderStatusCancelled},
+	OrderStatusFulfilled: {OrderStatusShipped, OrderStatusCancelled},
+	OrderStatusShipped:   {OrderStatusDelivered, OrderStatusRefunded},
+	OrderStatusDelivered: {OrderStatusRefunded},
+	OrderStatusCancelled: {},
+	OrderStatusRefunded:  {},
+}
+
+// ValidOrderStatus reports whether status is a known order status
+func ValidOrderStatus(status string) bool {
+	_, ok := OrderTransitions[status]
+	return ok
+}
+
+// CanTransition reports whether an order may move from one status to
+// another
+func CanTransition(from, to string) bool {
+	for _, next := range OrderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// SetStatus moves the order to status and stamps the matching timestamp
+// with at. It doesn't check the transition table.
+func (o *Order) SetStatus(status string, at time.Time) {
+	o.Status = status
+	switch status {
+	case OrderStatusPaid:
+		o.PaidAt = &at
+	case OrderStatusFulfilled:
+		o.FulfilledAt = &at
+	case OrderStatusShipped:
+		o.ShippedAt = &at
+	case OrderStatusDelivered:
+		o.DeliveredAt = &at
+	case OrderStatusCancelled:
+		o.CancelledAt = &at
+	case OrderStatusRefunded:
+		o.RefundedAt = &at
+	}
+}
+
+// Payment statuses
+const (
+	PaymentStatusAuthorized = "authorized"
+	PaymentStatusCaptured   = "captured"
+	PaymentStatusVoided     = "voided"
+	PaymentStatusRefunded   = "refunded"
+	PaymentStatusFailed     = "failed"
+)
+
+// Payment is one attempt to pay for an order through a payment gateway,
+// in the order's currency. Reference is the gateway's authorization ID.
+// Refunded counts what has been given back of a captured payment; the
+// payment is refunded once that is all of Amount.
+type Payment struct {
+	ID            uint        `gorm:"primaryKey" json:"id"`
+	OrderID       uint        `gorm:"not null;index" json:"order_id"`
+	Gateway       string      `gorm:"size:32;not null" json:"gateway"`
+	Reference     string      `gorm:"size:64;not null;default:''" json:"reference,omitempty"`
+	Amount        money.Money `gorm:"embedded;embeddedPrefix:amount_" json:"amount"`
+	Refunded      money.Money `gorm:"embedded;embeddedPrefix:refunded_" json:"refunded"`
+	Status        string      `gorm:"size:16;not null" json:"status"`
+	FailureReason string      `gorm:"size:255;not null;default:''" json:"failure_reason,omitempty"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+}
+
+// OrderStatusChange is one entry in an order's status history. From is
+// empty for the entry recorded when the order is placed.
+type OrderStatusChange struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	OrderID   uint      `gorm:"not null;index" json:"order_id"`
+	From      string    `gorm:"column:from_status;size:16;not null;default:''" json:"from,omitempty"`
+	To        string    `gorm:"column:to_status;size:16;not null" json:"to"`
+	UserID    *uint     `json:"user_id,omitempty"`
+	Note      string    `gorm:"size:255" json:"note,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // OrderItem - stores items in an order
@@ -68,19 +368,84 @@ type OrderItem struct {
 	OrderID   uint           `gorm:"not null" json:"order_id"`
 	ItemID    uint           `gorm:"not null" json:"item_id"`
 	Item      Item           `gorm:"foreignKey:ItemID" json:"item,omitempty"`
+	VariantID *uint          `gorm:"index" json:"variant_id,omitempty"`
+	Variant   *Variant       `gorm:"foreignKey:VariantID" json:"variant,omitempty"`
+	SKU       string         `gorm:"size:64" json:"sku,omitempty"`
 	Quantity  int            `gorm:"default:1" json:"quantity"`
-	Price     float64        `gorm:"not null" json:"price"`
+	Price     money.Money    `gorm:"embedded;embeddedPrefix:price_" json:"price"`
 	CreatedAt time.Time      `json:"created_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
+// ExchangeRate is how many units of Currency one unit of the base
+// currency buys. Rate is kept as a decimal string so it round-trips
+// exactly through every database.
+type ExchangeRate struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Currency  string    `gorm:"size:3;uniqueIndex;not null" json:"currency"`
+	Rate      string    `gorm:"size:32;not null" json:"rate"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Reasons recorded on a StockMovement
+const (
+	StockReasonInitial    = "initial"
+	StockReasonAdjustment = "adjustment"
+	StockReasonOrder      = "order"
+	StockReasonCancel     = "cancellation"
+)
+
+// StockMovement is one entry in an item's inventory audit trail. Every
+// change to Item.Stock, or to the Stock of one of its variants (VariantID
+// set), is recorded with the resulting level.
+type StockMovement struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	ItemID     uint      `gorm:"not null;index" json:"item_id"`
+	VariantID  *uint     `gorm:"index" json:"variant_id,omitempty"`
+	Delta      int       `gorm:"not null" json:"delta"`
+	StockAfter int       `gorm:"not null" json:"stock_after"`
+	Reason     string    `gorm:"size:32;not null" json:"reason"`
+	Note       string    `gorm:"size:255" json:"note,omitempty"`
+	OrderID    *uint     `gorm:"index" json:"order_id,omitempty"`
+	UserID     *uint     `json:"user_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// IdempotencyKey remembers the response to the first request a user sent
+// with a given Idempotency-Key header, so that retries get that response
+// back instead of repeating the work. StatusCode is 0 while the first
+// request is still being handled. RequestHash covers the user, method,
+// path, query string and body, so a key can't be reused for a different
+// request.
+type IdempotencyKey struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	UserID       uint      `gorm:"not null;uniqueIndex:idx_idempotency_keys_user_key" json:"user_id"`
+	Key          string    `gorm:"column:idempotency_key;size:255;not null;uniqueIndex:idx_idempotency_keys_user_key" json:"key"`
+	RequestHash  string    `gorm:"size:64;not null" json:"-"`
+	StatusCode   int       `gorm:"not null;default:0" json:"status_code"`
+	ContentType  string    `gorm:"size:128;not null;default:''" json:"-"`
+	ResponseBody string    `gorm:"type:text" json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `gorm:"not null;index" json:"expires_at"`
+}
+
 // Session represents a user's active session / token. We keep it separate
-// so a user can have session metadata managed independently and easily
-// invalidate previous tokens when logging in from a new device.
+// so a user can have one session per device, each listed and revoked
+// independently. Only a keyed hash of the bearer token is stored.
 type Session struct {
-	ID        uint       `gorm:"primaryKey" json:"id"`
-	UserID    uint       `gorm:"not null;index" json:"user_id"`
-	Token     string     `gorm:"unique;not null" json:"token"`
-	CreatedAt time.Time  `json:"created_at"`
-	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	TokenHash  string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	UserAgent  string     `gorm:"size:255" json:"user_agent"`
+	IPAddress  string     `gorm:"size:64" json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	Current    bool       `gorm:"-" json:"current"`
+}
+
+// Expired reports whether the session is past its expiry at t
+func (s Session) Expired(t time.Time) bool {
+	return s.ExpiresAt != nil && s.ExpiresAt.Before(t)
 }
@@ -0,0 +1,173 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is used when an amount is given without a currency.
+const DefaultCurrency = "USD"
+
+// ErrCurrencyMismatch is returned when combining amounts in different
+// currencies.
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+// ErrOverflow is returned when an amount doesn't fit in int64 minor units.
+var ErrOverflow = errors.New("amount out of range")
+
+// minorUnits lists ISO 4217 currencies whose minor unit isn't 2 digits.
+var minorUnits = map[string]int{
+	"BHD": 3, "BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "IQD": 3, "ISK": 0,
+	"JOD": 3, "JPY": 0, "KMF": 0, "KRW": 0, "KWD": 3, "LYD": 3, "OMR": 3,
+	"PYG": 0, "RWF": 0, "TND": 3, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0,
+	"XAF": 0, "XOF": 0, "XPF": 0,
+}
+
+// MinorUnits returns the number of decimal digits of currency's minor unit.
+func MinorUnits(currency string) int {
+	if n, ok := minorUnits[currency]; ok {
+		return n
+	}
+	return 2
+}
+
+// ValidCurrency reports whether code looks like an ISO 4217 code.
+func ValidCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Money is an exact amount: an integer count of the currency's minor unit
+// (e.g. cents) plus its ISO 4217 code. In the database it is stored as two
+// columns, <prefix>amount and <prefix>currency, via gorm's embedded tag.
+type Money struct {
+	Amount   int64  `gorm:"not null" json:"amount"`
+	Currency string `gorm:"size:3;not null" json:"currency"`
+}
+
+// New returns amount minor units of currency.
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Zero returns a zero amount in currency.
+func Zero(currency string) Money {
+	return Money{Currency: currency}
+}
+
+// Parse converts a decimal string such as "12.34" into Money without going
+// through floating point. More fractional digits than the currency allows
+// is an error rather than a silent rounding.
+func Parse(s, currency string) (Money, error) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	whole, frac, _ := strings.Cut(s, ".")
+	digits := MinorUnits(currency)
+	if whole == "" && frac == "" {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(frac) > digits {
+		return Money{}, fmt.Errorf("amount %q has more than %d decimal places for %s", s, digits, currency)
+	}
+	frac += strings.Repeat("0", digits-len(frac))
+
+	if whole == "" {
+		whole = "0"
+	}
+	for _, part := range []string{whole, frac} {
+		for _, r := range part {
+			if r < '0' || r > '9' {
+				return Money{}, fmt.Errorf("invalid amount %q", s)
+			}
+		}
+	}
+
+	amount, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return Money{}, ErrOverflow
+	}
+	if neg {
+		amount = -amount
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// IsZero reports whether the amount is zero.
+func (m Money) IsZero() bool { return m.Amount == 0 }
+
+// IsPositive reports whether the amount is greater than zero.
+func (m Money) IsPositive() bool { return m.Amount > 0 }
+
+// Add returns m + o. Both must be in the same currency.
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	sum := m.Amount + o.Amount
+	if (o.Amount > 0 && sum < m.Amount) || (o.Amount < 0 && sum > m.Amount) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+// Mul returns m multiplied by n, e.g. a unit price times a quantity.
+func (m Money) Mul(n int64) (Money, error) {
+	if n != 0 && (m.Amount > math.MaxInt64/abs(n) || m.Amount < math.MinInt64/abs(n)) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: m.Amount * n, Currency: m.Currency}, nil
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Decimal formats the amount as a plain decimal string, e.g. "12.34".
+func (m Money) Decimal() string {
+	digits := MinorUnits(m.Currency)
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	s := strconv.FormatInt(amount, 10)
+	if digits == 0 {
+		return sign + s
+	}
+	if len(s) <= digits {
+		s = strings.Repeat("0", digits-len(s)+1) + s
+	}
+	return sign + s[:len(s)-digits] + "." + s[len(s)-digits:]
+}
+
+// String formats the amount with its currency, e.g. "12.34 USD".
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// MarshalJSON adds a human readable "formatted" field next to the exact
+// amount and currency.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount    int64  `json:"amount"`
+		Currency  string `json:"currency"`
+		Formatted string `json:"formatted"`
+	}{m.Amount, m.Currency, m.Decimal()})
+}
@@ -0,0 +1,171 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in       string
+		currency string
+		want     int64
+		wantErr  bool
+	}{
+		{"12.34", "USD", 1234, false},
+		{" 12.34 ", "USD", 1234, false},
+		{"12", "USD", 1200, false},
+		{"12.3", "USD", 1230, false},
+		{"12.", "USD", 1200, false},
+		{".5", "USD", 50, false},
+		{"+1.00", "USD", 100, false},
+		{"-0.01", "USD", -1, false},
+		{"0", "USD", 0, false},
+		{"1500", "JPY", 1500, false},
+		{"1.234", "KWD", 1234, false},
+		{"92233720368547758.07", "USD", math.MaxInt64, false},
+		// Too many decimals is refused, not rounded
+		{"12.345", "USD", 0, true},
+		{"1.5", "JPY", 0, true},
+		{"1.2345", "KWD", 0, true},
+		{"", "USD", 0, true},
+		{"-", "USD", 0, true},
+		{".", "USD", 0, true},
+		{"1,50", "USD", 0, true},
+		{"1e3", "USD", 0, true},
+		{"--1", "USD", 0, true},
+		{"1.-5", "USD", 0, true},
+		{"0x10", "USD", 0, true},
+		{"92233720368547758.08", "USD", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in, tt.currency)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q, %s) = %v, want an error", tt.in, tt.currency, got)
+			}
+			continue
+		}
+		if err != nil || got != New(tt.want, tt.currency) {
+			t.Errorf("Parse(%q, %s) = %v, %v; want %d", tt.in, tt.currency, got, err, tt.want)
+		}
+	}
+
+	if _, err := Parse("92233720368547758.08", "USD"); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Parse of an overflowing amount: got %v, want ErrOverflow", err)
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{New(1234, "USD"), "12.34"},
+		{New(5, "USD"), "0.05"},
+		{New(-5, "USD"), "-0.05"},
+		{New(0, "USD"), "0.00"},
+		{New(1500, "JPY"), "1500"},
+		{New(-1500, "JPY"), "-1500"},
+		{New(1, "KWD"), "0.001"},
+		{New(1234, "KWD"), "1.234"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.Decimal(); got != tt.want {
+			t.Errorf("%d %s: Decimal() = %q, want %q", tt.m.Amount, tt.m.Currency, got, tt.want)
+		}
+		// Decimal and Parse round-trip
+		if back, err := Parse(tt.m.Decimal(), tt.m.Currency); err != nil || back != tt.m {
+			t.Errorf("Parse(%q) = %v, %v; want %v", tt.want, back, err, tt.m)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	if _, err := New(1, "USD").Add(New(1, "EUR")); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Add across currencies: got %v, want ErrCurrencyMismatch", err)
+	}
+	if _, err := New(math.MaxInt64, "USD").Add(New(1, "USD")); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Add past MaxInt64: got %v, want ErrOverflow", err)
+	}
+	if _, err := New(math.MinInt64, "USD").Add(New(-1, "USD")); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Add past MinInt64: got %v, want ErrOverflow", err)
+	}
+	if got, err := New(250, "USD").Mul(3); err != nil || got != New(750, "USD") {
+		t.Errorf("Mul = %v, %v; want 7.50 USD", got, err)
+	}
+	if _, err := New(math.MaxInt64/2+1, "USD").Mul(2); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Mul past MaxInt64: got %v, want ErrOverflow", err)
+	}
+	if _, err := New(math.MaxInt64/2+1, "USD").Mul(-2); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Mul past MinInt64: got %v, want ErrOverflow", err)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		rate     string
+		amount   int64
+		want     int64
+	}{
+		{"same minor unit", "USD", "EUR", "0.9215", 1000, 922},
+		{"to fewer decimals", "USD", "JPY", "150.5", 199, 299},
+		{"to more decimals", "USD", "KWD", "0.307", 100, 307},
+		{"from fewer decimals", "JPY", "USD", "0.0067", 1000, 670},
+		{"half rounds up", "USD", "EUR", "0.5", 1, 1},
+		{"half rounds away from zero", "USD", "EUR", "0.5", -1, -1},
+		{"below half rounds down", "USD", "EUR", "0.49", 1, 0},
+		{"negative below half", "USD", "EUR", "0.49", -1, 0},
+		{"identity", "USD", "USD", "1", 1234, 1234},
+	}
+	for _, tt := range tests {
+		rate, err := ParseRate(tt.from, tt.to, tt.rate)
+		if err != nil {
+			t.Fatalf("%s: ParseRate: %v", tt.name, err)
+		}
+		got, err := rate.Convert(New(tt.amount, tt.from))
+		if err != nil || got != New(tt.want, tt.to) {
+			t.Errorf("%s: Convert(%d %s) = %v, %v; want %d %s", tt.name, tt.amount, tt.from, got, err, tt.want, tt.to)
+		}
+	}
+
+	rate, _ := ParseRate("USD", "EUR", "2")
+	if _, err := rate.Convert(New(1, "GBP")); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Convert from the wrong currency: got %v, want ErrCurrencyMismatch", err)
+	}
+	if _, err := rate.Convert(New(math.MaxInt64, "USD")); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Convert past MaxInt64: got %v, want ErrOverflow", err)
+	}
+	if _, err := (Rate{From: "USD", To: "EUR"}).Convert(New(1, "USD")); !errors.Is(err, ErrInvalidRate) {
+		t.Errorf("Convert with a zero Rate: got %v, want ErrInvalidRate", err)
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"0.9215", "0.9215"},
+		{"0.92150", "0.9215"},
+		{" 1 ", "1"},
+		{"1.0", "1"},
+		{"150.5", "150.5"},
+		{".5", "0.5"},
+	}
+	for _, tt := range tests {
+		rate, err := ParseRate("USD", "EUR", tt.in)
+		if err != nil || rate.String() != tt.want {
+			t.Errorf("ParseRate(%q) = %q, %v; want %q", tt.in, rate.String(), err, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", ".", "0", "0.0", "-1", "+1", "1e5", "1/2", "abc", "1.2.3"} {
+		if _, err := ParseRate("USD", "EUR", in); !errors.Is(err, ErrInvalidRate) {
+			t.Errorf("ParseRate(%q): got %v, want ErrInvalidRate", in, err)
+		}
+	}
+}
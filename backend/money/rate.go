@@ -0,0 +1,90 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ErrInvalidRate is returned for exchange rates that aren't positive
+// decimal numbers.
+var ErrInvalidRate = errors.New("exchange rate must be a positive decimal number")
+
+// Rate is an exchange rate: how many units of To one unit of From buys.
+// It is kept as an exact rational so conversions don't pick up float error.
+type Rate struct {
+	From  string
+	To    string
+	value *big.Rat
+}
+
+// ParseRate parses a decimal string such as "0.9215" into a Rate.
+func ParseRate(from, to, s string) (Rate, error) {
+	s = strings.TrimSpace(s)
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return Rate{}, ErrInvalidRate
+	}
+	for _, r := range whole + frac {
+		if r < '0' || r > '9' {
+			return Rate{}, ErrInvalidRate
+		}
+	}
+	v, ok := new(big.Rat).SetString(s)
+	if !ok || v.Sign() <= 0 {
+		return Rate{}, ErrInvalidRate
+	}
+	return Rate{From: from, To: to, value: v}, nil
+}
+
+// Identity returns the 1:1 rate of currency to itself.
+func Identity(currency string) Rate {
+	return Rate{From: currency, To: currency, value: big.NewRat(1, 1)}
+}
+
+// String formats the rate as a decimal with up to 10 fractional digits and
+// no trailing zeros.
+func (r Rate) String() string {
+	if r.value == nil {
+		return ""
+	}
+	s := r.value.FloatString(10)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// Convert returns m in the rate's To currency, rounded half away from zero
+// to the target's minor unit.
+func (r Rate) Convert(m Money) (Money, error) {
+	if m.Currency != r.From {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, r.From)
+	}
+	if r.value == nil {
+		return Money{}, ErrInvalidRate
+	}
+
+	// amount is in From minor units; rescale to To minor units
+	v := new(big.Rat).SetInt64(m.Amount)
+	v.Mul(v, r.value)
+	shift := MinorUnits(r.To) - MinorUnits(r.From)
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(int64(shift)))), nil))
+	if shift >= 0 {
+		v.Mul(v, scale)
+	} else {
+		v.Quo(v, scale)
+	}
+
+	// Round half away from zero: add or subtract 1/2 and truncate
+	half := big.NewRat(1, 2)
+	if v.Sign() < 0 {
+		v.Sub(v, half)
+	} else {
+		v.Add(v, half)
+	}
+	q := new(big.Int).Quo(v.Num(), v.Denom())
+	if !q.IsInt64() {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: q.Int64(), Currency: r.To}, nil
+}
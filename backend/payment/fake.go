@@ -0,0 +1,153 @@
+package payment
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"shopping-cart/money"
+)
+
+// Test payment sources understood by Fake. Any other source is accepted.
+const (
+	// FakeSourceDeclined is refused at authorization.
+	FakeSourceDeclined = "tok_declined"
+	// FakeSourceInsufficientFunds is refused at authorization for lack of
+	// funds.
+	FakeSourceInsufficientFunds = "tok_insufficient_funds"
+	// FakeSourceCaptureFails authorizes but is refused at capture.
+	FakeSourceCaptureFails = "tok_capture_fails"
+)
+
+type fakeStatus int
+
+const (
+	fakeAuthorized fakeStatus = iota
+	fakeCaptured
+	fakeVoided
+)
+
+type fakeAuthorization struct {
+	source   string
+	amount   money.Money
+	status   fakeStatus
+	captured int64
+	refunded int64
+}
+
+// fakeIDPrefix starts every authorization ID Fake hands out.
+const fakeIDPrefix = "fake_auth_"
+
+// Fake is an in-memory sandbox gateway. It moves no money. Authorizations
+// live as long as the process; voids and refunds of ones issued before a
+// restart are accepted, since the caller's stored payment is all that is
+// left of them.
+type Fake struct {
+	mu    sync.Mutex
+	auths map[string]*fakeAuthorization
+}
+
+// NewFake returns an empty sandbox gateway.
+func NewFake() *Fake {
+	return &Fake{auths: map[string]*fakeAuthorization{}}
+}
+
+func (f *Fake) Name() string { return "fake" }
+
+func (f *Fake) Authorize(ctx context.Context, source string, amount money.Money, reference string) (string, error) {
+	switch source {
+	case FakeSourceDeclined:
+		return "", fmt.Errorf("%w: card declined", ErrDeclined)
+	case FakeSourceInsufficientFunds:
+		return "", fmt.Errorf("%w: insufficient funds", ErrDeclined)
+	}
+	if !amount.IsPositive() {
+		return "", fmt.Errorf("%w: amount must be positive", ErrDeclined)
+	}
+	// Random IDs so that IDs from before a restart are never reused
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := fakeIDPrefix + hex.EncodeToString(b)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.auths[id] = &fakeAuthorization{source: source, amount: amount}
+	return id, nil
+}
+
+// forgotten reports whether id looks like an authorization from an
+// earlier process, which this one no longer knows about.
+func (f *Fake) forgotten(id string) bool {
+	_, ok := f.auths[id]
+	return !ok && strings.HasPrefix(id, fakeIDPrefix)
+}
+
+// lookup returns the authorization with id; f.mu must be held.
+func (f *Fake) lookup(id string, amount *money.Money) (*fakeAuthorization, error) {
+	auth, ok := f.auths[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if amount != nil && (amount.Currency != auth.amount.Currency || !amount.IsPositive()) {
+		return nil, fmt.Errorf("%w: amount must be positive and in %s", ErrInvalidState, auth.amount.Currency)
+	}
+	return auth, nil
+}
+
+func (f *Fake) Capture(ctx context.Context, id string, amount money.Money) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	auth, err := f.lookup(id, &amount)
+	if err != nil {
+		return err
+	}
+	if auth.status != fakeAuthorized || amount.Amount > auth.amount.Amount {
+		return ErrInvalidState
+	}
+	if auth.source == FakeSourceCaptureFails {
+		return fmt.Errorf("%w: capture refused by issuer", ErrDeclined)
+	}
+	auth.status, auth.captured = fakeCaptured, amount.Amount
+	return nil
+}
+
+func (f *Fake) Void(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.forgotten(id) {
+		return nil
+	}
+	auth, err := f.lookup(id, nil)
+	if err != nil {
+		return err
+	}
+	if auth.status != fakeAuthorized {
+		return ErrInvalidState
+	}
+	auth.status = fakeVoided
+	return nil
+}
+
+func (f *Fake) Refund(ctx context.Context, id string, amount money.Money) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.forgotten(id) {
+		if !amount.IsPositive() {
+			return fmt.Errorf("%w: amount must be positive", ErrInvalidState)
+		}
+		return nil
+	}
+	auth, err := f.lookup(id, &amount)
+	if err != nil {
+		return err
+	}
+	if auth.status != fakeCaptured || auth.refunded+amount.Amount > auth.captured {
+		return ErrInvalidState
+	}
+	auth.refunded += amount.Amount
+	return nil
+}
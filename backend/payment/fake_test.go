@@ -0,0 +1,164 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"shopping-cart/money"
+)
+
+func usd(amount int64) money.Money { return money.New(amount, "USD") }
+
+func TestFakeAuthorize(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		amount money.Money
+		want   error
+	}{
+		{"accepted", "tok_visa", usd(1000), nil},
+		{"declined", FakeSourceDeclined, usd(1000), ErrDeclined},
+		{"insufficient funds", FakeSourceInsufficientFunds, usd(1000), ErrDeclined},
+		{"zero amount", "tok_visa", usd(0), ErrDeclined},
+		{"negative amount", "tok_visa", usd(-1), ErrDeclined},
+	}
+	f := NewFake()
+	seen := map[string]bool{}
+	for _, tt := range tests {
+		id, err := f.Authorize(context.Background(), tt.source, tt.amount, "order-1")
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !strings.HasPrefix(id, fakeIDPrefix) || seen[id] {
+			t.Errorf("%s: authorization ID %q", tt.name, id)
+		}
+		seen[id] = true
+	}
+}
+
+// fakeStep is one gateway call made on an authorization.
+type fakeStep struct {
+	op     string // capture, void or refund
+	amount int64
+	want   error
+}
+
+func TestFakeLifecycle(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		steps  []fakeStep
+	}{
+		{"capture in full", "tok_visa", []fakeStep{
+			{"capture", 1000, nil},
+			{"capture", 1000, ErrInvalidState},
+			{"void", 0, ErrInvalidState},
+		}},
+		{"partial capture", "tok_visa", []fakeStep{
+			{"capture", 400, nil},
+			{"refund", 500, ErrInvalidState},
+			{"refund", 400, nil},
+		}},
+		{"capture more than authorized", "tok_visa", []fakeStep{
+			{"capture", 1001, ErrInvalidState},
+			{"capture", 1000, nil},
+		}},
+		{"capture nothing", "tok_visa", []fakeStep{
+			{"capture", 0, ErrInvalidState},
+		}},
+		{"void", "tok_visa", []fakeStep{
+			{"void", 0, nil},
+			{"void", 0, ErrInvalidState},
+			{"capture", 1000, ErrInvalidState},
+			{"refund", 1000, ErrInvalidState},
+		}},
+		{"refund before capture", "tok_visa", []fakeStep{
+			{"refund", 1000, ErrInvalidState},
+		}},
+		{"refunds add up to the capture", "tok_visa", []fakeStep{
+			{"capture", 1000, nil},
+			{"refund", 600, nil},
+			{"refund", 500, ErrInvalidState},
+			{"refund", 400, nil},
+			{"refund", 1, ErrInvalidState},
+		}},
+		{"refund nothing", "tok_visa", []fakeStep{
+			{"capture", 1000, nil},
+			{"refund", 0, ErrInvalidState},
+		}},
+		// The failed capture leaves the authorization open to be voided
+		{"capture fails", FakeSourceCaptureFails, []fakeStep{
+			{"capture", 1000, ErrDeclined},
+			{"void", 0, nil},
+		}},
+	}
+	for _, tt := range tests {
+		f := NewFake()
+		ctx := context.Background()
+		id, err := f.Authorize(ctx, tt.source, usd(1000), "order-1")
+		if err != nil {
+			t.Fatalf("%s: Authorize: %v", tt.name, err)
+		}
+		for i, step := range tt.steps {
+			var err error
+			switch step.op {
+			case "capture":
+				err = f.Capture(ctx, id, usd(step.amount))
+			case "void":
+				err = f.Void(ctx, id)
+			case "refund":
+				err = f.Refund(ctx, id, usd(step.amount))
+			}
+			if !errors.Is(err, step.want) {
+				t.Errorf("%s: step %d (%s %d): got %v, want %v", tt.name, i+1, step.op, step.amount, err, step.want)
+			}
+		}
+	}
+}
+
+func TestFakeWrongCurrency(t *testing.T) {
+	f := NewFake()
+	ctx := context.Background()
+	id, _ := f.Authorize(ctx, "tok_visa", usd(1000), "order-1")
+	if err := f.Capture(ctx, id, money.New(1000, "EUR")); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("Capture in EUR: got %v, want ErrInvalidState", err)
+	}
+	f.Capture(ctx, id, usd(1000))
+	if err := f.Refund(ctx, id, money.New(1000, "EUR")); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("Refund in EUR: got %v, want ErrInvalidState", err)
+	}
+}
+
+func TestFakeUnknownIDs(t *testing.T) {
+	ctx := context.Background()
+	earlier := NewFake()
+	id, _ := earlier.Authorize(ctx, "tok_visa", usd(1000), "order-1")
+	earlier.Capture(ctx, id, usd(1000))
+
+	// A new process has forgotten id but still accepts its voids and
+	// refunds, so stored payments can be reversed after a restart
+	f := NewFake()
+	tests := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{"void forgotten", func() error { return f.Void(ctx, id) }, nil},
+		{"refund forgotten", func() error { return f.Refund(ctx, id, usd(1000)) }, nil},
+		{"refund forgotten nothing", func() error { return f.Refund(ctx, id, usd(0)) }, ErrInvalidState},
+		{"capture forgotten", func() error { return f.Capture(ctx, id, usd(1000)) }, ErrNotFound},
+		{"void foreign", func() error { return f.Void(ctx, "ch_123") }, ErrNotFound},
+		{"refund foreign", func() error { return f.Refund(ctx, "ch_123", usd(1000)) }, ErrNotFound},
+	}
+	for _, tt := range tests {
+		if err := tt.call(); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
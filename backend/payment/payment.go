@@ -0,0 +1,42 @@
+// Package payment takes payments for orders through a payment gateway.
+// Gateways authorize an amount on a payment source, then capture, void or
+// refund it. Fake is a local sandbox gateway for development and tests.
+package payment
+
+import (
+	"context"
+	"errors"
+
+	"shopping-cart/money"
+)
+
+var (
+	// ErrDeclined is returned, wrapped with the provider's reason, when a
+	// payment source is refused.
+	ErrDeclined = errors.New("payment declined")
+	// ErrNotFound is returned for unknown authorization IDs.
+	ErrNotFound = errors.New("authorization not found")
+	// ErrInvalidState is returned when an operation doesn't apply to the
+	// authorization as it stands, such as capturing a voided one or
+	// refunding more than was captured.
+	ErrInvalidState = errors.New("operation not allowed in the authorization's state")
+)
+
+// Gateway is a payment provider. Amounts are in the currency they were
+// authorized in.
+type Gateway interface {
+	// Name identifies the gateway in stored payments.
+	Name() string
+	// Authorize reserves amount on source, a token produced by the
+	// provider's client-side SDK, and returns the authorization ID.
+	// reference identifies the order to the provider.
+	Authorize(ctx context.Context, source string, amount money.Money, reference string) (string, error)
+	// Capture collects amount, at most the authorized amount, of an
+	// authorization.
+	Capture(ctx context.Context, id string, amount money.Money) error
+	// Void releases an authorization that hasn't been captured.
+	Void(ctx context.Context, id string) error
+	// Refund returns amount of what was captured to the source. It may be
+	// called more than once as long as the total stays within the capture.
+	Refund(ctx context.Context, id string, amount money.Money) error
+}
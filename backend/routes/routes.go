@@ -1,44 +1,98 @@
 package routes
 
 import (
+	"shopping-cart/auth"
+	"shopping-cart/blob"
+	"shopping-cart/config"
 	"shopping-cart/controllers"
 	"shopping-cart/middleware"
+	"shopping-cart/models"
+	"shopping-cart/payment"
+	"shopping-cart/search"
+	"shopping-cart/store"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(r *gin.Engine) {
+func SetupRoutes(r *gin.Engine, s store.Stores, sessionCfg config.SessionConfig, catalogCfg config.CatalogConfig, imageCfg config.ImageConfig, blobs blob.Store, gateway payment.Gateway, idx search.Index, idempotencyCfg config.IdempotencyConfig) {
+	ctl := controllers.NewController(s, sessionCfg, catalogCfg, imageCfg, blobs, gateway, idx)
+
 	// User routes
-	r.POST("/users", controllers.CreateUser)
-	r.GET("/users", controllers.GetUsers)
-	r.POST("/users/login", controllers.LoginUser)
+	r.POST("/users", ctl.CreateUser)
+	r.POST("/users/login", ctl.LoginUser)
+	if sessionCfg.Mode == config.AuthModeJWT {
+		// Public: the access token is usually expired when this is called
+		r.POST("/users/token/refresh", ctl.RefreshToken)
+	}
 
 	// Item routes
-	r.POST("/items", controllers.CreateItem)
-	r.GET("/items", controllers.GetItems)
+	r.GET("/items", ctl.GetItems)
+	r.GET("/items/search", ctl.SearchItems)
+	r.GET("/items/:id", ctl.GetItem)
+	r.GET("/items/:id/variants", ctl.GetItemVariants)
+	r.GET("/items/:id/images", ctl.GetItemImages)
+	r.GET("/exchange-rates", ctl.GetExchangeRates)
+	r.GET("/categories", ctl.GetCategories)
+	r.GET("/categories/:id/items", ctl.GetCategoryItems)
 
 	// Protected routes (require authentication)
 	authorized := r.Group("/")
-	authorized.Use(middleware.AuthMiddleware())
+	if sessionCfg.Mode == config.AuthModeJWT {
+		authorized.Use(middleware.JWTAuthMiddleware(sessionCfg.JWTKeys, sessionCfg.JWTIssuer))
+	} else {
+		authorized.Use(middleware.AuthMiddleware(s.Sessions, s.Users, auth.NewTokenHasher(sessionCfg.TokenSecret)))
+	}
+	// Retries of these carrying the same Idempotency-Key replay the first
+	// response instead of adding to the cart or ordering twice
+	idempotent := middleware.Idempotency(s.Idempotency, idempotencyCfg.TTL, idempotencyCfg.InFlight)
 	{
 		// User logout
-		authorized.POST("/users/logout", controllers.LogoutUser)
+		authorized.POST("/users/logout", ctl.LogoutUser)
+		// Session (device) management
+		authorized.GET("/users/sessions", ctl.ListSessions)
+		authorized.POST("/users/sessions/refresh", ctl.RefreshSession)
+		authorized.DELETE("/users/sessions/:id", ctl.RevokeSession)
 		// Cart routes
-		authorized.POST("/carts", controllers.AddToCart)
-		authorized.DELETE("/carts/items/:item_id", controllers.RemoveFromCart)
-		// Item delete (protected)
-		authorized.DELETE("/items/:id", controllers.DeleteItem)
-		authorized.GET("/carts/:id", controllers.GetCartByID)
-		authorized.GET("/carts", controllers.GetCarts)
-		authorized.GET("/carts/user", controllers.GetUserCart)
+		authorized.POST("/carts", idempotent, ctl.AddToCart)
+		authorized.PUT("/carts/items/:item_id", ctl.UpdateCartItem)
+		authorized.DELETE("/carts/items/:item_id", ctl.RemoveFromCart)
+		authorized.GET("/carts/:id", ctl.GetCartByID)
+		authorized.GET("/carts/user", ctl.GetUserCart)
 
 		// Order routes
-		authorized.POST("/orders", controllers.CreateOrder)
-		// Delete single order
-		authorized.DELETE("/orders/:id", controllers.DeleteOrder)
-		// Clear all user orders
-		authorized.DELETE("/orders/user", controllers.ClearUserOrders)
-		authorized.GET("/orders", controllers.GetOrders)
-		authorized.GET("/orders/user", controllers.GetUserOrders)
+		authorized.POST("/orders", idempotent, ctl.CreateOrder)
+		authorized.GET("/orders/user", ctl.GetUserOrders)
+		authorized.GET("/orders/:id", ctl.GetOrderByID)
+		authorized.POST("/orders/:id/cancel", idempotent, ctl.CancelOrder)
+	}
+
+	// Admin routes (catalog management and global listings)
+	admin := authorized.Group("/")
+	admin.Use(middleware.RequireRole(models.RoleAdmin))
+	{
+		admin.GET("/users", ctl.GetUsers)
+		admin.PUT("/users/:id/role", ctl.UpdateUserRole)
+		admin.POST("/items", ctl.CreateItem)
+		admin.PATCH("/items/:id", ctl.UpdateItem)
+		admin.DELETE("/items/:id", ctl.DeleteItem)
+		admin.PUT("/items/:id/image", ctl.UploadItemImage)
+		admin.POST("/items/:id/images", ctl.AddItemImage)
+		admin.PUT("/items/:id/images/order", ctl.ReorderItemImages)
+		admin.PATCH("/items/:id/images/:image_id", ctl.UpdateItemImage)
+		admin.DELETE("/items/:id/images/:image_id", ctl.DeleteItemImage)
+		admin.GET("/items/:id/price-history", ctl.GetPriceHistory)
+		admin.PUT("/items/:id/categories", ctl.SetItemCategories)
+		admin.POST("/items/:id/variants", ctl.CreateVariant)
+		admin.DELETE("/items/:id/variants/:variant_id", ctl.DeleteVariant)
+		admin.POST("/items/:id/stock", ctl.AdjustItemStock)
+		admin.GET("/items/:id/stock/movements", ctl.GetStockMovements)
+		admin.POST("/categories", ctl.CreateCategory)
+		admin.PUT("/categories/:id", ctl.UpdateCategory)
+		admin.DELETE("/categories/:id", ctl.DeleteCategory)
+		admin.POST("/exchange-rates", ctl.ImportExchangeRates)
+		admin.DELETE("/exchange-rates/:currency", ctl.DeleteExchangeRate)
+		admin.GET("/carts", ctl.GetCarts)
+		admin.GET("/orders", ctl.GetOrders)
+		admin.POST("/orders/:id/status", ctl.UpdateOrderStatus)
 	}
 }
@@ -0,0 +1,278 @@
+package search
+
+import (
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// BM25 parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Weights of inexact matches relative to an exact term match.
+const (
+	prefixWeight = 0.8
+	typoWeight   = 0.6 // per edit: 0.6 for one typo, 0.36 for two
+)
+
+// snippetLength is roughly how many bytes of a long field a highlight
+// shows around its first match.
+const snippetLength = 160
+
+// MemoryIndex is an in-process inverted index scored with BM25. Query terms
+// also match indexed terms within a small edit distance (typos) and, for
+// the last term, terms they prefix, so results show up while typing.
+type MemoryIndex struct {
+	mu       sync.RWMutex
+	docs     map[uint]*memDoc
+	postings map[string]map[uint]map[string]int // term -> doc -> field -> tf
+	fieldLen map[string]int                     // total tokens per field name
+}
+
+type memDoc struct {
+	fields []Field
+	tokens [][]token // per field
+}
+
+// NewMemoryIndex returns an empty MemoryIndex.
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{
+		docs:     map[uint]*memDoc{},
+		postings: map[string]map[uint]map[string]int{},
+		fieldLen: map[string]int{},
+	}
+}
+
+func (x *MemoryIndex) Index(doc Document) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.removeLocked(doc.ID)
+
+	d := &memDoc{fields: doc.Fields}
+	for _, f := range doc.Fields {
+		tokens := tokenize(f.Text)
+		d.tokens = append(d.tokens, tokens)
+		x.fieldLen[f.Name] += len(tokens)
+		for _, t := range tokens {
+			docs := x.postings[t.term]
+			if docs == nil {
+				docs = map[uint]map[string]int{}
+				x.postings[t.term] = docs
+			}
+			if docs[doc.ID] == nil {
+				docs[doc.ID] = map[string]int{}
+			}
+			docs[doc.ID][f.Name]++
+		}
+	}
+	x.docs[doc.ID] = d
+	return nil
+}
+
+func (x *MemoryIndex) Remove(id uint) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.removeLocked(id)
+	return nil
+}
+
+func (x *MemoryIndex) removeLocked(id uint) {
+	d, ok := x.docs[id]
+	if !ok {
+		return
+	}
+	for i, f := range d.fields {
+		x.fieldLen[f.Name] -= len(d.tokens[i])
+		for _, t := range d.tokens[i] {
+			if docs := x.postings[t.term]; docs != nil {
+				delete(docs, id)
+				if len(docs) == 0 {
+					delete(x.postings, t.term)
+				}
+			}
+		}
+	}
+	delete(x.docs, id)
+}
+
+// expand returns the indexed terms a query term matches, with their weight.
+func (x *MemoryIndex) expand(q string, prefix bool) map[string]float64 {
+	out := map[string]float64{}
+	if _, ok := x.postings[q]; ok {
+		out[q] = 1
+	}
+	limit := maxEdits(q)
+	for term := range x.postings {
+		if term == q {
+			continue
+		}
+		w := 0.0
+		if prefix && len(q) >= 2 && strings.HasPrefix(term, q) {
+			w = prefixWeight
+		}
+		if limit > 0 {
+			if d := editDistance(q, term, limit); d <= limit {
+				w = max(w, math.Pow(typoWeight, float64(d)))
+			}
+		}
+		if w > 0 {
+			out[term] = w
+		}
+	}
+	return out
+}
+
+func (x *MemoryIndex) Search(query string, limit, offset int) (Results, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	var terms []string
+	seen := map[string]bool{}
+	for _, t := range tokenize(query) {
+		if !seen[t.term] {
+			seen[t.term] = true
+			terms = append(terms, t.term)
+		}
+	}
+	if len(terms) == 0 || len(x.docs) == 0 {
+		return Results{Hits: []Hit{}}, nil
+	}
+
+	n := float64(len(x.docs))
+	scores := map[uint]float64{}
+	matched := map[uint]int{}           // query terms matched per doc
+	marks := map[uint]map[string]bool{} // indexed terms to highlight per doc
+	for i, q := range terms {
+		// Only the last term is treated as a prefix: it's the one still
+		// being typed
+		best := map[uint]float64{}
+		for term, weight := range x.expand(q, i == len(terms)-1) {
+			docs := x.postings[term]
+			idf := math.Log(1 + (n-float64(len(docs))+0.5)/(float64(len(docs))+0.5))
+			for id, fields := range docs {
+				s := 0.0
+				for _, f := range x.docs[id].fields {
+					tf := float64(fields[f.Name])
+					if tf == 0 {
+						continue
+					}
+					avg := float64(x.fieldLen[f.Name]) / n
+					length := float64(x.docs[id].fieldTokens(f.Name))
+					s += f.Boost * idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*length/avg))
+				}
+				best[id] = max(best[id], weight*s)
+				if marks[id] == nil {
+					marks[id] = map[string]bool{}
+				}
+				marks[id][term] = true
+			}
+		}
+		for id, s := range best {
+			scores[id] += s
+			matched[id]++
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, s := range scores {
+		// Favour documents that match more of the query
+		s *= float64(matched[id]) / float64(len(terms))
+		hits = append(hits, Hit{ID: id, Score: math.Round(s*1000) / 1000})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+
+	total := len(hits)
+	if offset > len(hits) {
+		offset = len(hits)
+	}
+	hits = hits[offset:]
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	for i := range hits {
+		hits[i].Highlights = x.docs[hits[i].ID].highlight(marks[hits[i].ID])
+	}
+	return Results{Hits: hits, Total: total}, nil
+}
+
+func (d *memDoc) fieldTokens(name string) int {
+	for i, f := range d.fields {
+		if f.Name == name {
+			return len(d.tokens[i])
+		}
+	}
+	return 0
+}
+
+// highlight returns a snippet per field containing one of terms.
+func (d *memDoc) highlight(terms map[string]bool) map[string]string {
+	out := map[string]string{}
+	for i, f := range d.fields {
+		var hits []token
+		for _, t := range d.tokens[i] {
+			if terms[t.term] {
+				hits = append(hits, t)
+			}
+		}
+		if len(hits) == 0 {
+			continue
+		}
+
+		// Cut long fields down to a window around the first match
+		from, to := 0, len(f.Text)
+		if to > snippetLength {
+			// Start and end on word boundaries so no word is cut in half
+			lo := max(0, hits[0].start-snippetLength/3)
+			hi := min(len(f.Text), lo+snippetLength)
+			from, to = hits[0].start, hits[0].end
+			for _, t := range d.tokens[i] {
+				if t.start >= lo && t.start < from {
+					from = t.start
+				}
+				if t.end <= hi && t.end > to {
+					to = t.end
+				}
+			}
+			// Keep leading or trailing punctuation when no words were cut
+			all := d.tokens[i]
+			if all[0].start >= from {
+				from = 0
+			}
+			if all[len(all)-1].end <= to {
+				to = len(f.Text)
+			}
+		}
+
+		var b strings.Builder
+		if from > 0 {
+			b.WriteString("…")
+		}
+		pos := from
+		for _, t := range hits {
+			if t.start < from || t.end > to {
+				continue
+			}
+			b.WriteString(html.EscapeString(f.Text[pos:t.start]))
+			b.WriteString("<mark>")
+			b.WriteString(html.EscapeString(f.Text[t.start:t.end]))
+			b.WriteString("</mark>")
+			pos = t.end
+		}
+		b.WriteString(html.EscapeString(f.Text[pos:to]))
+		if to < len(f.Text) {
+			b.WriteString("…")
+		}
+		out[f.Name] = b.String()
+	}
+	return out
+}
@@ -0,0 +1,81 @@
+// Package search indexes catalog items for full-text search. Backends
+// implement Index; MemoryIndex, an in-process inverted index, is the
+// default.
+package search
+
+import (
+	"shopping-cart/models"
+	"shopping-cart/store"
+)
+
+// Field is one searchable piece of a document. Matches in fields with a
+// higher Boost rank higher.
+type Field struct {
+	Name  string
+	Text  string
+	Boost float64
+}
+
+// Document is what gets indexed for one item.
+type Document struct {
+	ID     uint
+	Fields []Field
+}
+
+// Hit is one search result. Highlights holds, per matching field, an
+// HTML-escaped snippet with the matched words wrapped in <mark> tags.
+type Hit struct {
+	ID         uint              `json:"id"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// Results is one page of hits, best first. Total counts every matching
+// document.
+type Results struct {
+	Hits  []Hit
+	Total int
+}
+
+// Index is a full-text index over items. Implementations must be safe for
+// concurrent use.
+type Index interface {
+	// Index adds the document, replacing any earlier version with its ID.
+	Index(doc Document) error
+	Remove(id uint) error
+	// Search returns up to limit hits for query, skipping the first offset.
+	Search(query string, limit, offset int) (Results, error)
+}
+
+// ItemDocument builds the document indexed for item.
+func ItemDocument(item models.Item) Document {
+	return Document{
+		ID: item.ID,
+		Fields: []Field{
+			{Name: "name", Text: item.Name, Boost: 3},
+			{Name: "description", Text: item.Description, Boost: 1},
+		},
+	}
+}
+
+// Reindex loads every item from items into idx, e.g. on startup.
+func Reindex(idx Index, items store.ItemStore) (int, error) {
+	opts := store.ListOptions{Limit: store.MaxPageSize}
+	count := 0
+	for {
+		page, err := items.List(opts)
+		if err != nil {
+			return count, err
+		}
+		for _, item := range page.Items {
+			if err := idx.Index(ItemDocument(item)); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if page.NextCursor == "" {
+			return count, nil
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
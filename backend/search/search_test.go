@@ -0,0 +1,241 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStem(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"shirts", "shirt"},
+		{"berries", "berry"},
+		{"dresses", "dress"},
+		{"boxes", "box"},
+		{"watches", "watch"},
+		{"shoes", "shoe"},
+		{"glass", "glass"},
+		{"status", "status"},
+		{"analysis", "analysis"},
+		{"running", "run"},
+		{"jumped", "jump"},
+		{"falling", "fall"},
+		{"quickly", "quick"},
+		{"only", "only"},
+		// Too short, or nothing left but consonants, to strip
+		{"bus", "bus"},
+		{"red", "red"},
+		{"seed", "seed"},
+		{"string", "string"},
+		{"sing", "sing"},
+	}
+	for _, tt := range tests {
+		if got := stem(tt.in); got != tt.want {
+			t.Errorf("stem(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	text := "The Red-Shirts, 2 pack für Kinder!"
+	want := []token{
+		{term: "red", start: 4, end: 7},
+		{term: "shirt", start: 8, end: 14},
+		{term: "2", start: 16, end: 17},
+		{term: "pack", start: 18, end: 22},
+		{term: "für", start: 23, end: 27},
+		{term: "kinder", start: 28, end: 34},
+	}
+	if got := tokenize(text); !reflect.DeepEqual(got, want) {
+		t.Errorf("tokenize(%q) =\n %+v\nwant\n %+v", text, got, want)
+	}
+	if got := tokenize("the and of ..."); len(got) != 0 {
+		t.Errorf("stop words and punctuation gave %+v", got)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"", "", 2, 0},
+		{"shirt", "shirt", 1, 0},
+		{"shirt", "shirts", 1, 1},
+		{"shirt", "short", 1, 1},
+		{"shirt", "shrit", 1, 1}, // a transposition is one edit
+		{"kitten", "sitting", 3, 3},
+		{"café", "cafe", 1, 1}, // runes, not bytes
+		{"", "abc", 3, 3},
+		// Past the limit the answer is just limit+1
+		{"kitten", "sitting", 2, 3},
+		{"abc", "", 1, 2},
+		{"abcdef", "uvwxyz", 2, 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b, tt.limit); got != tt.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d, want %d", tt.a, tt.b, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestMaxEdits(t *testing.T) {
+	tests := []struct {
+		term string
+		want int
+	}{
+		{"hat", 0},
+		{"shoe", 1},
+		{"ñandú", 1},
+		{"sneaker", 1},
+		{"sneakers", 2},
+	}
+	for _, tt := range tests {
+		if got := maxEdits(tt.term); got != tt.want {
+			t.Errorf("maxEdits(%q) = %d, want %d", tt.term, got, tt.want)
+		}
+	}
+}
+
+func newTestIndex(t *testing.T, docs map[uint][2]string) *MemoryIndex {
+	t.Helper()
+	x := NewMemoryIndex()
+	for id, d := range docs {
+		err := x.Index(Document{ID: id, Fields: []Field{
+			{Name: "name", Text: d[0], Boost: 3},
+			{Name: "description", Text: d[1], Boost: 1},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return x
+}
+
+func hitIDs(t *testing.T, x *MemoryIndex, query string) []uint {
+	t.Helper()
+	res, err := x.Search(query, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []uint{}
+	for _, h := range res.Hits {
+		ids = append(ids, h.ID)
+	}
+	return ids
+}
+
+func TestSearchRanking(t *testing.T) {
+	x := newTestIndex(t, map[uint][2]string{
+		1: {"Red shirt", "Cotton"},
+		2: {"Blue top", "Goes with a red shirt"},
+		3: {"Red hat", "Wool"},
+		4: {"Running shoes", "Light sneakers for running"},
+		5: {"Shirt", "A shirt, in a long, long, long, long description about fabric and fit"},
+		6: {"Hat", "Red"},
+	})
+
+	tests := []struct {
+		name  string
+		query string
+		want  []uint
+	}{
+		// A match in the boosted name field outranks one in the description
+		{"field boost", "cotton shirt", []uint{1, 5, 2}},
+		// Matching both terms, even in the description, beats matching one
+		// in the name; a strong match on one term can still beat both
+		{"more terms matched", "red shirt", []uint{1, 5, 2, 3, 6}},
+		{"stemmed", "shirts", []uint{5, 1, 2}},
+		{"stemmed query and text", "run", []uint{4}},
+		{"typo", "sneakrs", []uint{4}},
+		{"transposed letters", "shrit", []uint{5, 1, 2}},
+		// Only the last term, the one being typed, matches as a prefix
+		{"prefix", "light snea", []uint{4}},
+		{"prefix not last", "snea cotton", []uint{1}},
+		// Terms this short tolerate no typos
+		{"short term", "cat", []uint{}},
+		{"stop words only", "the and of", []uint{}},
+	}
+	for _, tt := range tests {
+		if got := hitIDs(t, x, tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Search(%q) = %v, want %v", tt.name, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSearchScores(t *testing.T) {
+	x := newTestIndex(t, map[uint][2]string{
+		1: {"Shirt", ""},
+		2: {"Shirt shirt", ""},
+		3: {"Striped cotton summer shirt", ""},
+		4: {"Hat", ""},
+	})
+	res, err := x.Search("shirt", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scores := map[uint]float64{}
+	for _, h := range res.Hits {
+		scores[h.ID] = h.Score
+	}
+	// Term frequency helps, with diminishing returns; a longer field
+	// dilutes the match
+	if !(scores[2] > scores[1] && scores[2] < 2*scores[1]) {
+		t.Errorf("tf saturation: scores %v", scores)
+	}
+	if !(scores[1] > scores[3]) {
+		t.Errorf("length normalization: scores %v", scores)
+	}
+
+	// A term in fewer documents is worth more
+	hat, _ := x.Search("hat", 0, 0)
+	if len(hat.Hits) != 1 || hat.Hits[0].Score <= scores[1] {
+		t.Errorf("idf: hat %+v, shirt %v", hat.Hits, scores)
+	}
+}
+
+func TestSearchPagingAndUpdates(t *testing.T) {
+	x := newTestIndex(t, map[uint][2]string{
+		1: {"Shirt", ""},
+		2: {"Shirt", ""},
+		3: {"Shirt", ""},
+	})
+	res, _ := x.Search("shirt", 2, 1)
+	if res.Total != 3 || len(res.Hits) != 2 || res.Hits[0].ID != 2 || res.Hits[1].ID != 3 {
+		t.Errorf("page: total %d, hits %+v", res.Total, res.Hits)
+	}
+	if res, _ := x.Search("shirt", 2, 10); res.Total != 3 || len(res.Hits) != 0 {
+		t.Errorf("past the end: total %d, hits %+v", res.Total, res.Hits)
+	}
+
+	x.Remove(2)
+	x.Index(Document{ID: 3, Fields: []Field{{Name: "name", Text: "Hat", Boost: 3}}})
+	if got := hitIDs(t, x, "shirt"); !reflect.DeepEqual(got, []uint{1}) {
+		t.Errorf("after removing and replacing: %v", got)
+	}
+	if got := hitIDs(t, x, "hat"); !reflect.DeepEqual(got, []uint{3}) {
+		t.Errorf("replaced document: %v", got)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	long := "Our classic fit is cut from soft cotton jersey and finished with ribbed cuffs and hem, " +
+		"so it keeps its shape wash after wash. Pair the striped shirt with chinos or jeans; " +
+		"it layers well under a jacket when the weather turns cold."
+	x := newTestIndex(t, map[uint][2]string{
+		1: {"Tom & Jerry shirts", long},
+	})
+	res, _ := x.Search("shirt", 0, 0)
+	if len(res.Hits) != 1 {
+		t.Fatalf("hits: %+v", res.Hits)
+	}
+	h := res.Hits[0].Highlights
+	if want := "Tom &amp; Jerry <mark>shirts</mark>"; h["name"] != want {
+		t.Errorf("name highlight %q, want %q", h["name"], want)
+	}
+	want := "…keeps its shape wash after wash. Pair the striped <mark>shirt</mark> with chinos or jeans; " +
+		"it layers well under a jacket when the weather turns cold."
+	if h["description"] != want {
+		t.Errorf("description highlight\n %q\nwant\n %q", h["description"], want)
+	}
+}
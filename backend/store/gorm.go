@@ -0,0 +1,1059 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"shopping-cart/models"
+	"shopping-cart/money"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NewGormStores returns stores backed by db.
+func NewGormStores(db *gorm.DB) Stores {
+	return Stores{
+		Users:       &gormUserStore{db: db},
+		Items:       &gormItemStore{db: db},
+		Carts:       &gormCartStore{db: db},
+		Orders:      &gormOrderStore{db: db},
+		Sessions:    &gormSessionStore{db: db},
+		Rates:       &gormRateStore{db: db},
+		Categories:  &gormCategoryStore{db: db},
+		Variants:    &gormVariantStore{db: db},
+		ItemImages:  &gormItemImageStore{db: db},
+		Payments:    &gormPaymentStore{db: db},
+		Idempotency: &gormIdempotencyStore{db: db},
+	}
+}
+
+// translate maps gorm errors onto the store's sentinel errors
+func translate(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return ErrDuplicate
+	}
+	return err
+}
+
+// byID orders preloaded rows oldest first.
+func byID(db *gorm.DB) *gorm.DB {
+	return db.Order("id")
+}
+
+// forUpdate returns a session on tx that locks the rows it reads. Being a
+// new session, each query on it starts without the previous one's
+// conditions.
+func forUpdate(tx *gorm.DB) *gorm.DB {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Session(&gorm.Session{})
+}
+
+// Users
+
+type gormUserStore struct {
+	db *gorm.DB
+}
+
+func (s *gormUserStore) Create(user *models.User) error {
+	return s.db.Create(user).Error
+}
+
+func (s *gormUserStore) List(opts ListOptions) (Page[models.User], error) {
+	plan, err := planList(opts, userSortKeys)
+	if err != nil {
+		return Page[models.User]{}, err
+	}
+	var users []models.User
+	q := applyFilter(s.db, opts.Filter, "")
+	if err := plan.apply(q).Find(&users).Error; err != nil {
+		return Page[models.User]{}, err
+	}
+	return plan.page(users, func(u models.User) uint { return u.ID }), nil
+}
+
+func (s *gormUserStore) Get(id uint) (*models.User, error) {
+	var user models.User
+	if err := s.db.First(&user, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &user, nil
+}
+
+func (s *gormUserStore) GetByUsername(username string) (*models.User, error) {
+	var user models.User
+	if err := s.db.Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &user, nil
+}
+
+func (s *gormUserStore) SetRole(id uint, role string) error {
+	// Look the user up first: MySQL reports 0 affected rows for a no-op update
+	var user models.User
+	if err := s.db.First(&user, id).Error; err != nil {
+		return translate(err)
+	}
+	return s.db.Model(&user).Update("role", role).Error
+}
+
+// Items
+
+type gormItemStore struct {
+	db *gorm.DB
+}
+
+func (s *gormItemStore) Create(item *models.Item) error {
+	return s.db.Create(item).Error
+}
+
+func (s *gormItemStore) List(opts ListOptions) (Page[models.Item], error) {
+	plan, err := planList(opts, itemSortKeys)
+	if err != nil {
+		return Page[models.Item]{}, err
+	}
+	var items []models.Item
+	q := applyFilter(s.db.Preload("Categories").Preload("Variants").Preload("Images", galleryOrder), opts.Filter, "price_amount")
+	if len(opts.Filter.CategoryIDs) > 0 {
+		q = q.Where("id IN (?)", s.db.Table("item_categories").Select("item_id").
+			Where("category_id IN ?", opts.Filter.CategoryIDs))
+	}
+	if err := plan.apply(q).Find(&items).Error; err != nil {
+		return Page[models.Item]{}, err
+	}
+	return plan.page(items, func(i models.Item) uint { return i.ID }), nil
+}
+
+func (s *gormItemStore) Get(id uint) (*models.Item, error) {
+	var item models.Item
+	if err := s.db.Preload("Categories").Preload("Variants").Preload("Images", galleryOrder).First(&item, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &item, nil
+}
+
+func (s *gormItemStore) Update(item *models.Item, version uint, userID *uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var current models.Item
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&current, item.ID).Error; err != nil {
+			return translate(err)
+		}
+		if current.Version != version {
+			return ErrVersionConflict
+		}
+		// Updates writes the new values back into current
+		oldPrice := current.Price
+		err := tx.Model(&current).Updates(map[string]interface{}{
+			"name":           item.Name,
+			"price_amount":   item.Price.Amount,
+			"price_currency": item.Price.Currency,
+			"description":    item.Description,
+			"max_per_order":  item.MaxPerOrder,
+			"version":        version + 1,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if oldPrice != item.Price {
+			change := models.PriceChange{ItemID: item.ID, OldPrice: oldPrice, NewPrice: item.Price, UserID: userID}
+			if err := tx.Create(&change).Error; err != nil {
+				return err
+			}
+		}
+		item.Version = version + 1
+		return nil
+	})
+}
+
+func (s *gormItemStore) ListPriceHistory(itemID uint) ([]models.PriceChange, error) {
+	var changes []models.PriceChange
+	err := s.db.Where("item_id = ?", itemID).Order("id DESC").Find(&changes).Error
+	return changes, err
+}
+
+func (s *gormItemStore) Delete(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("item_id = ?", id).Delete(&models.ItemImage{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Item{}, id).Error
+	})
+}
+
+func (s *gormItemStore) AdjustStock(itemID uint, delta int, movement *models.StockMovement) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		locked := forUpdate(tx)
+		var stock int
+		var target interface{}
+		if movement.VariantID != nil {
+			var variant models.Variant
+			if err := locked.Where("item_id = ?", itemID).First(&variant, *movement.VariantID).Error; err != nil {
+				return translate(err)
+			}
+			stock, target = variant.Stock, &variant
+		} else {
+			var item models.Item
+			if err := locked.First(&item, itemID).Error; err != nil {
+				return translate(err)
+			}
+			stock, target = item.Stock, &item
+		}
+		if stock+delta < 0 {
+			return ErrInsufficientStock
+		}
+		if err := tx.Model(target).Update("stock", gorm.Expr("stock + ?", delta)).Error; err != nil {
+			return err
+		}
+		movement.ItemID = itemID
+		movement.Delta = delta
+		movement.StockAfter = stock + delta
+		return tx.Create(movement).Error
+	})
+}
+
+func (s *gormItemStore) ListStockMovements(itemID uint) ([]models.StockMovement, error) {
+	var movements []models.StockMovement
+	err := s.db.Where("item_id = ?", itemID).Order("id DESC").Find(&movements).Error
+	return movements, err
+}
+
+// Variants
+
+type gormVariantStore struct {
+	db *gorm.DB
+}
+
+func (s *gormVariantStore) Create(variant *models.Variant) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var item models.Item
+		if err := tx.First(&item, variant.ItemID).Error; err != nil {
+			return translate(err)
+		}
+		// The unique index on sku, which covers deleted variants too, makes
+		// concurrent creates with the same SKU fail here
+		return translate(tx.Create(variant).Error)
+	})
+}
+
+func (s *gormVariantStore) ListByItem(itemID uint) ([]models.Variant, error) {
+	var variants []models.Variant
+	err := s.db.Where("item_id = ?", itemID).Order("id").Find(&variants).Error
+	return variants, err
+}
+
+func (s *gormVariantStore) Get(id uint) (*models.Variant, error) {
+	var variant models.Variant
+	if err := s.db.First(&variant, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &variant, nil
+}
+
+func (s *gormVariantStore) Delete(id uint) error {
+	return s.db.Delete(&models.Variant{}, id).Error
+}
+
+// Item images
+
+// galleryOrder orders preloaded images by their gallery position.
+func galleryOrder(db *gorm.DB) *gorm.DB {
+	return db.Order("position, id")
+}
+
+type gormItemImageStore struct {
+	db *gorm.DB
+}
+
+func (s *gormItemImageStore) Add(image *models.ItemImage) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var item models.Item
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&item, image.ItemID).Error; err != nil {
+			return translate(err)
+		}
+		var gallery []models.ItemImage
+		if err := tx.Where("item_id = ?", image.ItemID).Order("position").Find(&gallery).Error; err != nil {
+			return err
+		}
+		image.Position = 0
+		if n := len(gallery); n > 0 {
+			image.Position = gallery[n-1].Position + 1
+		}
+		if len(gallery) == 0 {
+			image.Primary = true
+		} else if image.Primary {
+			if err := clearPrimary(tx, image.ItemID); err != nil {
+				return err
+			}
+		}
+		return tx.Create(image).Error
+	})
+}
+
+// clearPrimary unsets the primary flag on all of the item's images.
+func clearPrimary(tx *gorm.DB, itemID uint) error {
+	return tx.Model(&models.ItemImage{}).Where("item_id = ? AND is_primary = ?", itemID, true).
+		Update("is_primary", false).Error
+}
+
+func (s *gormItemImageStore) ListByItem(itemID uint) ([]models.ItemImage, error) {
+	var gallery []models.ItemImage
+	err := galleryOrder(s.db.Where("item_id = ?", itemID)).Find(&gallery).Error
+	return gallery, err
+}
+
+func (s *gormItemImageStore) Get(id uint) (*models.ItemImage, error) {
+	var image models.ItemImage
+	if err := s.db.First(&image, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &image, nil
+}
+
+func (s *gormItemImageStore) Update(image *models.ItemImage) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var current models.ItemImage
+		if err := tx.First(&current, image.ID).Error; err != nil {
+			return translate(err)
+		}
+		updates := map[string]interface{}{"alt_text": image.AltText}
+		if image.Primary && !current.Primary {
+			if err := clearPrimary(tx, current.ItemID); err != nil {
+				return err
+			}
+			updates["is_primary"] = true
+		}
+		if err := tx.Model(&current).Updates(updates).Error; err != nil {
+			return err
+		}
+		*image = current
+		return nil
+	})
+}
+
+func (s *gormItemImageStore) Reorder(itemID uint, imageIDs []uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var item models.Item
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&item, itemID).Error; err != nil {
+			return translate(err)
+		}
+		var ids []uint
+		if err := tx.Model(&models.ItemImage{}).Where("item_id = ?", itemID).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if !sameIDs(ids, imageIDs) {
+			return ErrImageOrder
+		}
+		for position, id := range imageIDs {
+			if err := tx.Model(&models.ItemImage{}).Where("id = ?", id).Update("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *gormItemImageStore) Delete(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var image models.ItemImage
+		if err := tx.First(&image, id).Error; err != nil {
+			return translate(err)
+		}
+		if err := tx.Delete(&image).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&models.ItemImage{}).Where("item_id = ? AND position > ?", image.ItemID, image.Position).
+			Update("position", gorm.Expr("position - 1")).Error
+		if err != nil || !image.Primary {
+			return err
+		}
+		var next models.ItemImage
+		err = galleryOrder(tx.Where("item_id = ?", image.ItemID)).First(&next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Model(&next).Update("is_primary", true).Error
+	})
+}
+
+// Categories
+
+type gormCategoryStore struct {
+	db *gorm.DB
+}
+
+// slugTaken reports whether another category (not id) uses slug
+func slugTaken(tx *gorm.DB, slug string, id uint) (bool, error) {
+	var count int64
+	err := tx.Model(&models.Category{}).Where("slug = ? AND id <> ?", slug, id).Count(&count).Error
+	return count > 0, err
+}
+
+// categoryParents locks every category and maps its ID to its parent, so
+// that concurrent moves can't combine into a cycle
+func categoryParents(tx *gorm.DB) (map[uint]*uint, error) {
+	var categories []models.Category
+	if err := forUpdate(tx).Select("id", "parent_id").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	parents := map[uint]*uint{}
+	for _, c := range categories {
+		parents[c.ID] = c.ParentID
+	}
+	return parents, nil
+}
+
+func (s *gormCategoryStore) Create(category *models.Category) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if taken, err := slugTaken(tx, category.Slug, 0); err != nil || taken {
+			if taken {
+				return ErrDuplicate
+			}
+			return err
+		}
+		parents, err := categoryParents(tx)
+		if err != nil {
+			return err
+		}
+		if err := checkParent(parents, 0, category.ParentID); err != nil {
+			return err
+		}
+		return translate(tx.Create(category).Error)
+	})
+}
+
+func (s *gormCategoryStore) List() ([]models.Category, error) {
+	var categories []models.Category
+	err := s.db.Order("name, id").Find(&categories).Error
+	return categories, err
+}
+
+func (s *gormCategoryStore) Get(id uint) (*models.Category, error) {
+	var category models.Category
+	if err := s.db.First(&category, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &category, nil
+}
+
+func (s *gormCategoryStore) Update(category *models.Category) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if taken, err := slugTaken(tx, category.Slug, category.ID); err != nil || taken {
+			if taken {
+				return ErrDuplicate
+			}
+			return err
+		}
+		parents, err := categoryParents(tx)
+		if err != nil {
+			return err
+		}
+		if _, ok := parents[category.ID]; !ok {
+			return ErrNotFound
+		}
+		if err := checkParent(parents, category.ID, category.ParentID); err != nil {
+			return err
+		}
+		res := tx.Model(category).Select("name", "slug", "parent_id").Updates(category)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (s *gormCategoryStore) Delete(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var children int64
+		if err := tx.Model(&models.Category{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+			return err
+		}
+		if children > 0 {
+			return ErrHasChildren
+		}
+		if err := tx.Table("item_categories").Where("category_id = ?", id).Delete(nil).Error; err != nil {
+			return err
+		}
+		res := tx.Delete(&models.Category{}, id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (s *gormCategoryStore) SetItemCategories(itemID uint, categoryIDs []uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var item models.Item
+		if err := tx.First(&item, itemID).Error; err != nil {
+			return translate(err)
+		}
+		categories := []models.Category{}
+		if len(categoryIDs) > 0 {
+			if err := tx.Where("id IN ?", categoryIDs).Find(&categories).Error; err != nil {
+				return err
+			}
+			if len(categories) != len(uniqueIDs(categoryIDs)) {
+				return ErrNotFound
+			}
+		}
+		return tx.Model(&item).Association("Categories").Replace(categories)
+	})
+}
+
+// uniqueIDs returns ids without duplicates
+func uniqueIDs(ids []uint) []uint {
+	seen := map[uint]bool{}
+	out := []uint{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// Carts
+
+type gormCartStore struct {
+	db *gorm.DB
+}
+
+func (s *gormCartStore) List(opts ListOptions) (Page[models.Cart], error) {
+	plan, err := planList(opts, cartSortKeys)
+	if err != nil {
+		return Page[models.Cart]{}, err
+	}
+	var carts []models.Cart
+	q := applyFilter(s.db.Preload("Items.Item").Preload("Items.Item.Images", galleryOrder).Preload("Items.Variant").Preload("User"), opts.Filter, "")
+	if opts.Filter.UserID != 0 {
+		q = q.Where("user_id = ?", opts.Filter.UserID)
+	}
+	if err := plan.apply(q).Find(&carts).Error; err != nil {
+		return Page[models.Cart]{}, err
+	}
+	return plan.page(carts, func(c models.Cart) uint { return c.ID }), nil
+}
+
+func (s *gormCartStore) Get(id uint) (*models.Cart, error) {
+	var cart models.Cart
+	if err := s.db.Preload("Items.Item").Preload("Items.Item.Images", galleryOrder).Preload("Items.Variant").Preload("User").First(&cart, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &cart, nil
+}
+
+func (s *gormCartStore) GetByUser(userID uint) (*models.Cart, error) {
+	var cart models.Cart
+	if err := s.db.Preload("Items.Item").Preload("Items.Item.Images", galleryOrder).Preload("Items.Variant").Where("user_id = ?", userID).First(&cart).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &cart, nil
+}
+
+// cartForUser returns the user's cart, creating it if needed
+func cartForUser(tx *gorm.DB, userID uint) (*models.Cart, error) {
+	var cart models.Cart
+	if err := tx.Where("user_id = ?", userID).First(&cart).Error; err != nil {
+		// not found -> create
+		cart = models.Cart{UserID: userID}
+		if err := tx.Create(&cart).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &cart, nil
+}
+
+// cartLine scopes a query to the cart line for itemID and variantID
+func cartLine(tx *gorm.DB, cartID, itemID uint, variantID *uint) *gorm.DB {
+	tx = tx.Where("cart_id = ? AND item_id = ?", cartID, itemID)
+	if variantID == nil {
+		return tx.Where("variant_id IS NULL")
+	}
+	return tx.Where("variant_id = ?", *variantID)
+}
+
+func (s *gormCartStore) AddItem(userID, itemID uint, variantID *uint, quantity, limit int, price money.Money) (*models.CartItem, bool, error) {
+	var cartItem models.CartItem
+	created := false
+
+	// Get or create cart for user in a transaction to avoid races
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		cart, err := cartForUser(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		// Check if item already in cart
+		if err := cartLine(tx, cart.ID, itemID, variantID).First(&cartItem).Error; err == nil {
+			if cartItem.Quantity+quantity > limit {
+				return ErrQuantityLimit
+			}
+			cartItem.Quantity += quantity
+			return tx.Save(&cartItem).Error
+		}
+
+		if quantity > limit {
+			return ErrQuantityLimit
+		}
+		cartItem = models.CartItem{
+			CartID:    cart.ID,
+			ItemID:    itemID,
+			VariantID: variantID,
+			Quantity:  quantity,
+			Price:     price,
+		}
+		created = true
+		return tx.Create(&cartItem).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &cartItem, created, nil
+}
+
+func (s *gormCartStore) SetItemQuantity(userID, itemID uint, variantID *uint, quantity int, price money.Money) (*models.CartItem, error) {
+	var cartItem models.CartItem
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		cart, err := cartForUser(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		if quantity == 0 {
+			return cartLine(tx, cart.ID, itemID, variantID).Delete(&models.CartItem{}).Error
+		}
+
+		if err := cartLine(tx, cart.ID, itemID, variantID).First(&cartItem).Error; err == nil {
+			cartItem.Quantity = quantity
+			return tx.Save(&cartItem).Error
+		}
+		cartItem = models.CartItem{
+			CartID:    cart.ID,
+			ItemID:    itemID,
+			VariantID: variantID,
+			Quantity:  quantity,
+			Price:     price,
+		}
+		return tx.Create(&cartItem).Error
+	})
+	if err != nil || quantity == 0 {
+		return nil, err
+	}
+	return &cartItem, nil
+}
+
+func (s *gormCartStore) RemoveItem(userID, itemID uint, variantID *uint) error {
+	var cart models.Cart
+	if err := s.db.Where("user_id = ?", userID).First(&cart).Error; err != nil {
+		return translate(err)
+	}
+	return cartLine(s.db, cart.ID, itemID, variantID).Delete(&models.CartItem{}).Error
+}
+
+func (s *gormCartStore) SyncLines(cartID uint, prices map[uint]money.Money, removed []uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for id, price := range prices {
+			if err := tx.Model(&models.CartItem{}).Where("id = ? AND cart_id = ?", id, cartID).Updates(map[string]interface{}{
+				"price_amount":   price.Amount,
+				"price_currency": price.Currency,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		if len(removed) == 0 {
+			return nil
+		}
+		return tx.Where("cart_id = ? AND id IN ?", cartID, removed).Delete(&models.CartItem{}).Error
+	})
+}
+
+// Orders
+
+type gormOrderStore struct {
+	db *gorm.DB
+}
+
+func (s *gormOrderStore) Place(order *models.Order) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		requested, keys := requestedStock(order.Items)
+
+		// Lock the ordered items' and variants' rows so concurrent
+		// checkouts can't both take the last units
+		var itemIDs, variantIDs []uint
+		for _, k := range keys {
+			if k.variantID != 0 {
+				variantIDs = append(variantIDs, k.variantID)
+			} else {
+				itemIDs = append(itemIDs, k.itemID)
+			}
+		}
+		stock := map[stockKey]int{}
+		locked := forUpdate(tx)
+		if len(itemIDs) > 0 {
+			var items []models.Item
+			if err := locked.Where("id IN ?", itemIDs).Order("id").Find(&items).Error; err != nil {
+				return err
+			}
+			for _, item := range items {
+				stock[stockKey{itemID: item.ID}] = item.Stock
+			}
+		}
+		if len(variantIDs) > 0 {
+			var variants []models.Variant
+			if err := locked.Where("id IN ?", variantIDs).Order("id").Find(&variants).Error; err != nil {
+				return err
+			}
+			for _, v := range variants {
+				stock[stockKey{itemID: v.ItemID, variantID: v.ID}] = v.Stock
+			}
+		}
+
+		if short := shortages(keys, requested, stock); len(short) > 0 {
+			return &OutOfStockError{Lines: short}
+		}
+
+		// Items are created explicitly below rather than via association
+		order.SetStatus(models.OrderStatusPending, time.Now())
+		if err := tx.Omit("Items", "User", "StatusHistory", "Payments").Create(order).Error; err != nil {
+			return err
+		}
+		placed := models.OrderStatusChange{OrderID: order.ID, To: order.Status, UserID: &order.UserID}
+		if err := tx.Create(&placed).Error; err != nil {
+			return err
+		}
+		for i := range order.Items {
+			order.Items[i].OrderID = order.ID
+			if err := tx.Omit("Item", "Variant").Create(&order.Items[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, k := range keys {
+			var target *gorm.DB
+			if k.variantID != 0 {
+				target = tx.Model(&models.Variant{}).Where("id = ?", k.variantID)
+			} else {
+				target = tx.Model(&models.Item{}).Where("id = ?", k.itemID)
+			}
+			if err := target.Update("stock", gorm.Expr("stock - ?", requested[k])).Error; err != nil {
+				return err
+			}
+			movement := orderMovement(order, k, -requested[k], stock[k], models.StockReasonOrder, &order.UserID)
+			if err := tx.Create(&movement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *gormOrderStore) List(opts ListOptions) (Page[models.Order], error) {
+	plan, err := planList(opts, orderSortKeys)
+	if err != nil {
+		return Page[models.Order]{}, err
+	}
+	var orders []models.Order
+	q := applyFilter(s.db.Preload("Items.Item").Preload("Items.Item.Images", galleryOrder).Preload("Items.Variant").Preload("User"), opts.Filter, "base_total_amount")
+	if opts.Filter.UserID != 0 {
+		q = q.Where("user_id = ?", opts.Filter.UserID)
+	}
+	if opts.Filter.Status != "" {
+		q = q.Where("status = ?", opts.Filter.Status)
+	}
+	if err := plan.apply(q).Find(&orders).Error; err != nil {
+		return Page[models.Order]{}, err
+	}
+	return plan.page(orders, func(o models.Order) uint { return o.ID }), nil
+}
+
+func (s *gormOrderStore) Get(id uint) (*models.Order, error) {
+	var order models.Order
+	err := s.db.Preload("Items.Item").Preload("Items.Item.Images", galleryOrder).Preload("Items.Variant").
+		Preload("StatusHistory", byID).Preload("Payments", byID).
+		First(&order, id).Error
+	if err != nil {
+		return nil, translate(err)
+	}
+	return &order, nil
+}
+
+// orderStatusColumns maps statuses to the timestamp column set on entering
+// them.
+var orderStatusColumns = map[string]string{
+	models.OrderStatusPaid:      "paid_at",
+	models.OrderStatusFulfilled: "fulfilled_at",
+	models.OrderStatusShipped:   "shipped_at",
+	models.OrderStatusDelivered: "delivered_at",
+	models.OrderStatusCancelled: "cancelled_at",
+	models.OrderStatusRefunded:  "refunded_at",
+}
+
+func (s *gormOrderStore) Transition(id uint, from, to string, userID *uint, note string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, id).Error; err != nil {
+			return translate(err)
+		}
+		if order.Status != from || to == models.OrderStatusCancelled || !models.CanTransition(from, to) {
+			return ErrInvalidTransition
+		}
+		now := time.Now()
+		updates := map[string]interface{}{"status": to}
+		if column, ok := orderStatusColumns[to]; ok {
+			updates[column] = now
+		}
+		if err := tx.Model(&order).Updates(updates).Error; err != nil {
+			return err
+		}
+		change := models.OrderStatusChange{OrderID: id, From: from, To: to, UserID: userID, Note: note, CreatedAt: now}
+		return tx.Create(&change).Error
+	})
+}
+
+func (s *gormOrderStore) Cancel(id uint, from, reason string, userID *uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		locked := forUpdate(tx)
+		var order models.Order
+		if err := locked.Preload("Items").First(&order, id).Error; err != nil {
+			return translate(err)
+		}
+		if order.Status != from || !models.CanTransition(from, models.OrderStatusCancelled) {
+			return ErrInvalidTransition
+		}
+		now := time.Now()
+		err := tx.Model(&order).Updates(map[string]interface{}{
+			"status":        models.OrderStatusCancelled,
+			"cancelled_at":  now,
+			"cancel_reason": reason,
+		}).Error
+		if err != nil {
+			return err
+		}
+		change := models.OrderStatusChange{OrderID: id, From: from, To: models.OrderStatusCancelled, UserID: userID, Note: reason, CreatedAt: now}
+		if err := tx.Create(&change).Error; err != nil {
+			return err
+		}
+
+		returned, keys := requestedStock(order.Items)
+		for _, k := range keys {
+			var stock int
+			var target interface{}
+			if k.variantID != 0 {
+				var v models.Variant
+				err = locked.Where("item_id = ?", k.itemID).First(&v, k.variantID).Error
+				stock, target = v.Stock, &v
+			} else {
+				var item models.Item
+				err = locked.First(&item, k.itemID).Error
+				stock, target = item.Stock, &item
+			}
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(target).Update("stock", gorm.Expr("stock + ?", returned[k])).Error; err != nil {
+				return err
+			}
+			movement := orderMovement(&order, k, returned[k], stock, models.StockReasonCancel, userID)
+			if err := tx.Create(&movement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Payments
+
+type gormPaymentStore struct {
+	db *gorm.DB
+}
+
+func (s *gormPaymentStore) Create(payment *models.Payment) error {
+	return s.db.Create(payment).Error
+}
+
+func (s *gormPaymentStore) Update(payment *models.Payment) error {
+	result := s.db.Model(payment).Updates(map[string]interface{}{
+		"reference":         payment.Reference,
+		"status":            payment.Status,
+		"refunded_amount":   payment.Refunded.Amount,
+		"refunded_currency": payment.Refunded.Currency,
+		"failure_reason":    payment.FailureReason,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *gormPaymentStore) ListByOrder(orderID uint) ([]models.Payment, error) {
+	var payments []models.Payment
+	err := s.db.Where("order_id = ?", orderID).Order("id").Find(&payments).Error
+	return payments, err
+}
+
+// Idempotency keys
+
+type gormIdempotencyStore struct {
+	db *gorm.DB
+}
+
+func (s *gormIdempotencyStore) Claim(record *models.IdempotencyKey, now time.Time) (*models.IdempotencyKey, error) {
+	var existing *models.IdempotencyKey
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var current models.IdempotencyKey
+		err := forUpdate(tx).Where("user_id = ? AND idempotency_key = ?", record.UserID, record.Key).First(&current).Error
+		switch {
+		case err == nil && current.ExpiresAt.After(now):
+			existing = &current
+			return nil
+		case err == nil:
+			if err := tx.Delete(&current).Error; err != nil {
+				return err
+			}
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+		return tx.Create(record).Error
+	})
+	if err != nil && existing == nil {
+		// A concurrent request may have claimed the key first, in which
+		// case the unique index rejected this insert
+		var current models.IdempotencyKey
+		if s.db.Where("user_id = ? AND idempotency_key = ?", record.UserID, record.Key).First(&current).Error == nil {
+			return &current, nil
+		}
+		return nil, err
+	}
+	return existing, nil
+}
+
+func (s *gormIdempotencyStore) Complete(id uint, statusCode int, contentType, body string, expiresAt time.Time) error {
+	return s.db.Model(&models.IdempotencyKey{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status_code":   statusCode,
+		"content_type":  contentType,
+		"response_body": body,
+		"expires_at":    expiresAt,
+	}).Error
+}
+
+func (s *gormIdempotencyStore) Release(id uint) error {
+	return s.db.Delete(&models.IdempotencyKey{}, id).Error
+}
+
+func (s *gormIdempotencyStore) DeleteExpired(now time.Time) (int, error) {
+	result := s.db.Where("expires_at <= ?", now).Delete(&models.IdempotencyKey{})
+	return int(result.RowsAffected), result.Error
+}
+
+// Sessions
+
+type gormSessionStore struct {
+	db *gorm.DB
+}
+
+func (s *gormSessionStore) Create(session *models.Session) error {
+	return s.db.Create(session).Error
+}
+
+func (s *gormSessionStore) GetByTokenHash(hash string) (*models.Session, error) {
+	var session models.Session
+	if err := s.db.Where("token_hash = ?", hash).First(&session).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &session, nil
+}
+
+func (s *gormSessionStore) Get(id uint) (*models.Session, error) {
+	var session models.Session
+	if err := s.db.First(&session, id).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &session, nil
+}
+
+func (s *gormSessionStore) ListByUser(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := s.db.Where("user_id = ?", userID).Order("created_at, id").Find(&sessions).Error
+	return sessions, err
+}
+
+func (s *gormSessionStore) Touch(id uint, at time.Time) error {
+	return s.db.Model(&models.Session{}).Where("id = ?", id).Update("last_used_at", at).Error
+}
+
+func (s *gormSessionStore) SetExpiry(id uint, expiresAt time.Time) error {
+	return s.db.Model(&models.Session{}).Where("id = ?", id).Update("expires_at", expiresAt).Error
+}
+
+func (s *gormSessionStore) RotateToken(id uint, tokenHash string, expiresAt time.Time) error {
+	return s.db.Model(&models.Session{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"token_hash": tokenHash, "expires_at": expiresAt}).Error
+}
+
+func (s *gormSessionStore) Delete(id uint) error {
+	return s.db.Delete(&models.Session{}, id).Error
+}
+
+func (s *gormSessionStore) DeleteByUser(userID uint) error {
+	return s.db.Where("user_id = ?", userID).Delete(&models.Session{}).Error
+}
+
+// Exchange rates
+
+type gormRateStore struct {
+	db *gorm.DB
+}
+
+func (s *gormRateStore) List() ([]models.ExchangeRate, error) {
+	var rates []models.ExchangeRate
+	err := s.db.Order("currency").Find(&rates).Error
+	return rates, err
+}
+
+func (s *gormRateStore) Get(currency string) (*models.ExchangeRate, error) {
+	var rate models.ExchangeRate
+	if err := s.db.Where("currency = ?", currency).First(&rate).Error; err != nil {
+		return nil, translate(err)
+	}
+	return &rate, nil
+}
+
+func (s *gormRateStore) Upsert(rates []models.ExchangeRate) error {
+	if len(rates) == 0 {
+		return nil
+	}
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "updated_at"}),
+	}).Create(&rates).Error
+}
+
+func (s *gormRateStore) Delete(currency string) error {
+	res := s.db.Where("currency = ?", currency).Delete(&models.ExchangeRate{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,326 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"shopping-cart/models"
+
+	"gorm.io/gorm"
+)
+
+// Limits applied to ListOptions.Limit
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// ErrInvalidSort is returned for a sort key the listing doesn't support.
+var ErrInvalidSort = errors.New("invalid sort key")
+
+// ErrInvalidCursor is returned for a cursor that is malformed or was issued
+// for a different sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListOptions selects one page of a listing. Pages are keyset based: the
+// cursor records the sort value and ID of the last row returned, so rows
+// inserted or deleted between requests don't shift later pages.
+type ListOptions struct {
+	// Limit is the page size; 0 means DefaultPageSize and values above
+	// MaxPageSize are capped.
+	Limit int
+	// Sort is a sort key, optionally prefixed with "-" for descending
+	// order. Ties are broken by ID. Empty means "id".
+	Sort string
+	// Cursor is the NextCursor of the previous page, or empty for the
+	// first page.
+	Cursor string
+	Filter Filter
+}
+
+// Filter narrows a listing. Zero values don't filter; each store applies
+// only the fields that make sense for it.
+type Filter struct {
+	// UserID restricts carts and orders to one user.
+	UserID uint
+	// Status restricts orders to one status.
+	Status string
+	// CategoryIDs restricts items to those in any of the categories.
+	CategoryIDs []uint
+	// MinAmount and MaxAmount bound an item's price or an order's base
+	// total, in minor units of the base currency (inclusive).
+	MinAmount *int64
+	MaxAmount *int64
+	// CreatedAfter and CreatedBefore bound CreatedAt (inclusive).
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
+
+// Page is one page of a listing. NextCursor is empty on the last page.
+type Page[T any] struct {
+	Items      []T
+	NextCursor string
+}
+
+func (o ListOptions) limit() int {
+	switch {
+	case o.Limit <= 0:
+		return DefaultPageSize
+	case o.Limit > MaxPageSize:
+		return MaxPageSize
+	}
+	return o.Limit
+}
+
+// Kinds of sort values; they decide how cursor values are parsed and
+// compared.
+const (
+	kindInt = iota
+	kindTime
+	kindString
+)
+
+// sortKey describes one column a listing can be ordered by.
+type sortKey[T any] struct {
+	column string
+	kind   int
+	value  func(T) any // int64, time.Time or string matching kind
+}
+
+// Sort keys accepted by each listing
+var (
+	itemSortKeys = map[string]sortKey[models.Item]{
+		"id":         {"id", kindInt, func(i models.Item) any { return int64(i.ID) }},
+		"name":       {"name", kindString, func(i models.Item) any { return i.Name }},
+		"price":      {"price_amount", kindInt, func(i models.Item) any { return i.Price.Amount }},
+		"created_at": {"created_at", kindTime, func(i models.Item) any { return i.CreatedAt }},
+	}
+	userSortKeys = map[string]sortKey[models.User]{
+		"id":         {"id", kindInt, func(u models.User) any { return int64(u.ID) }},
+		"username":   {"username", kindString, func(u models.User) any { return u.Username }},
+		"created_at": {"created_at", kindTime, func(u models.User) any { return u.CreatedAt }},
+	}
+	cartSortKeys = map[string]sortKey[models.Cart]{
+		"id":         {"id", kindInt, func(c models.Cart) any { return int64(c.ID) }},
+		"created_at": {"created_at", kindTime, func(c models.Cart) any { return c.CreatedAt }},
+		"updated_at": {"updated_at", kindTime, func(c models.Cart) any { return c.UpdatedAt }},
+	}
+	orderSortKeys = map[string]sortKey[models.Order]{
+		"id":         {"id", kindInt, func(o models.Order) any { return int64(o.ID) }},
+		"total":      {"base_total_amount", kindInt, func(o models.Order) any { return o.BaseTotal.Amount }},
+		"created_at": {"created_at", kindTime, func(o models.Order) any { return o.CreatedAt }},
+	}
+)
+
+// cursor is the decoded form of ListOptions.Cursor.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+// listPlan is a validated ListOptions for one model.
+type listPlan[T any] struct {
+	key   sortKey[T]
+	sort  string
+	desc  bool
+	limit int
+	after *cursor
+	// afterValue is after.Value parsed according to key.kind
+	afterValue any
+}
+
+func planList[T any](opts ListOptions, keys map[string]sortKey[T]) (*listPlan[T], error) {
+	p := &listPlan[T]{sort: opts.Sort, limit: opts.limit()}
+	if p.sort == "" {
+		p.sort = "id"
+	}
+	name := strings.TrimPrefix(p.sort, "-")
+	p.desc = name != p.sort
+	key, ok := keys[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrInvalidSort, name)
+	}
+	p.key = key
+
+	if opts.Cursor == "" {
+		return p, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cur cursor
+	if err := json.Unmarshal(raw, &cur); err != nil || cur.Sort != p.sort {
+		return nil, ErrInvalidCursor
+	}
+	if p.afterValue, err = parseSortValue(key.kind, cur.Value); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	p.after = &cur
+	return p, nil
+}
+
+func parseSortValue(kind int, s string) (any, error) {
+	switch kind {
+	case kindInt:
+		return strconv.ParseInt(s, 10, 64)
+	case kindTime:
+		return time.Parse(time.RFC3339Nano, s)
+	}
+	return s, nil
+}
+
+func formatSortValue(v any) string {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
+
+// page trims rows (fetched with one extra row) to the limit and builds the
+// cursor for the next page.
+func (p *listPlan[T]) page(rows []T, id func(T) uint) Page[T] {
+	if len(rows) <= p.limit {
+		return Page[T]{Items: rows}
+	}
+	rows = rows[:p.limit]
+	last := rows[len(rows)-1]
+	raw, _ := json.Marshal(cursor{Sort: p.sort, Value: formatSortValue(p.key.value(last)), ID: id(last)})
+	return Page[T]{Items: rows, NextCursor: base64.RawURLEncoding.EncodeToString(raw)}
+}
+
+// apply adds the keyset condition, ordering and limit to a gorm query.
+func (p *listPlan[T]) apply(q *gorm.DB) *gorm.DB {
+	dir, cmp := "ASC", ">"
+	if p.desc {
+		dir, cmp = "DESC", "<"
+	}
+	col := p.key.column
+	if p.after != nil {
+		if col == "id" {
+			q = q.Where("id "+cmp+" ?", p.after.ID)
+		} else {
+			q = q.Where(col+" "+cmp+" ? OR ("+col+" = ? AND id "+cmp+" ?)",
+				p.afterValue, p.afterValue, p.after.ID)
+		}
+	}
+	if col != "id" {
+		q = q.Order(col + " " + dir)
+	}
+	return q.Order("id " + dir).Limit(p.limit + 1)
+}
+
+// applyFilter adds the created-at and amount bounds of f to a gorm query;
+// amountColumn is empty when the model has no amount to filter on.
+func applyFilter(q *gorm.DB, f Filter, amountColumn string) *gorm.DB {
+	if f.CreatedAfter != nil {
+		q = q.Where("created_at >= ?", *f.CreatedAfter)
+	}
+	if f.CreatedBefore != nil {
+		q = q.Where("created_at <= ?", *f.CreatedBefore)
+	}
+	if amountColumn != "" {
+		if f.MinAmount != nil {
+			q = q.Where(amountColumn+" >= ?", *f.MinAmount)
+		}
+		if f.MaxAmount != nil {
+			q = q.Where(amountColumn+" <= ?", *f.MaxAmount)
+		}
+	}
+	return q
+}
+
+// memPage sorts, filters by cursor and pages rows held in memory the same
+// way apply does in SQL.
+func (p *listPlan[T]) memPage(rows []T, id func(T) uint) Page[T] {
+	less := func(a, b T) bool {
+		if c := compareSortValues(p.key.value(a), p.key.value(b)); c != 0 {
+			return c < 0
+		}
+		return id(a) < id(b)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if p.desc {
+			return less(rows[j], rows[i])
+		}
+		return less(rows[i], rows[j])
+	})
+
+	if p.after != nil {
+		start := len(rows)
+		for i, row := range rows {
+			c := compareSortValues(p.key.value(row), p.afterValue)
+			if c == 0 {
+				c = compareIDs(id(row), p.after.ID)
+			}
+			if (!p.desc && c > 0) || (p.desc && c < 0) {
+				start = i
+				break
+			}
+		}
+		rows = rows[start:]
+	}
+	if len(rows) > p.limit+1 {
+		rows = rows[:p.limit+1]
+	}
+	return p.page(rows, id)
+}
+
+func compareIDs(a, b uint) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareSortValues(a, b any) int {
+	switch a := a.(type) {
+	case int64:
+		b := b.(int64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	case string:
+		return strings.Compare(a, b.(string))
+	}
+	return 0
+}
+
+// memMatches reports whether a row with the given creation time and
+// amount passes f; amount is nil for models without one.
+func memMatches(f Filter, createdAt time.Time, amount *int64) bool {
+	if f.CreatedAfter != nil && createdAt.Before(*f.CreatedAfter) {
+		return false
+	}
+	if f.CreatedBefore != nil && createdAt.After(*f.CreatedBefore) {
+		return false
+	}
+	if amount != nil {
+		if f.MinAmount != nil && *amount < *f.MinAmount {
+			return false
+		}
+		if f.MaxAmount != nil && *amount > *f.MaxAmount {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,1302 @@
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"shopping-cart/models"
+	"shopping-cart/money"
+)
+
+// memDB holds every table for the in-memory stores behind one lock so that
+// multi-table operations are atomic, just like a transaction.
+type memDB struct {
+	mu sync.RWMutex
+
+	users      map[uint]models.User
+	items      map[uint]models.Item
+	carts      map[uint]models.Cart
+	cartItems  map[uint]models.CartItem
+	orders     map[uint]models.Order
+	orderItems map[uint]models.OrderItem
+	statuses   map[uint]models.OrderStatusChange
+	payments   map[uint]models.Payment
+	idemKeys   map[uint]models.IdempotencyKey
+	sessions   map[uint]models.Session
+	movements  map[uint]models.StockMovement
+	prices     map[uint]models.PriceChange
+	rates      map[string]models.ExchangeRate
+	categories map[uint]models.Category
+	variants   map[uint]models.Variant
+	images     map[uint]models.ItemImage
+	// itemCategories maps item IDs to their category IDs
+	itemCategories map[uint][]uint
+	// skus holds every SKU ever given a variant, deleted ones included
+	skus map[string]bool
+
+	lastID map[string]uint
+}
+
+// NewMemoryStores returns stores that keep everything in process memory.
+// They are meant for tests and local experiments; nothing is persisted.
+func NewMemoryStores() Stores {
+	db := &memDB{
+		users:          map[uint]models.User{},
+		items:          map[uint]models.Item{},
+		carts:          map[uint]models.Cart{},
+		cartItems:      map[uint]models.CartItem{},
+		orders:         map[uint]models.Order{},
+		orderItems:     map[uint]models.OrderItem{},
+		statuses:       map[uint]models.OrderStatusChange{},
+		payments:       map[uint]models.Payment{},
+		idemKeys:       map[uint]models.IdempotencyKey{},
+		sessions:       map[uint]models.Session{},
+		movements:      map[uint]models.StockMovement{},
+		prices:         map[uint]models.PriceChange{},
+		rates:          map[string]models.ExchangeRate{},
+		categories:     map[uint]models.Category{},
+		variants:       map[uint]models.Variant{},
+		skus:           map[string]bool{},
+		images:         map[uint]models.ItemImage{},
+		itemCategories: map[uint][]uint{},
+		lastID:         map[string]uint{},
+	}
+	return Stores{
+		Users:       &memUserStore{db},
+		Items:       &memItemStore{db},
+		Carts:       &memCartStore{db},
+		Orders:      &memOrderStore{db},
+		Sessions:    &memSessionStore{db},
+		Rates:       &memRateStore{db},
+		Categories:  &memCategoryStore{db},
+		Variants:    &memVariantStore{db},
+		ItemImages:  &memItemImageStore{db},
+		Payments:    &memPaymentStore{db},
+		Idempotency: &memIdempotencyStore{db},
+	}
+}
+
+func (db *memDB) nextID(table string) uint {
+	db.lastID[table]++
+	return db.lastID[table]
+}
+
+// sortedIDs returns the keys of m in ascending order so listings are stable
+func sortedIDs[T any](m map[uint]T) []uint {
+	ids := make([]uint, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// variant returns the live variant with id, or nil
+func (db *memDB) variant(id *uint) *models.Variant {
+	if id == nil {
+		return nil
+	}
+	if v, ok := db.variants[*id]; ok {
+		return &v
+	}
+	return nil
+}
+
+// loadCart returns cart with its items (and their Item and Variant) attached
+func (db *memDB) loadCart(cart models.Cart, withUser bool) models.Cart {
+	cart.Items = []models.CartItem{}
+	for _, id := range sortedIDs(db.cartItems) {
+		ci := db.cartItems[id]
+		if ci.CartID != cart.ID {
+			continue
+		}
+		ci.Item = db.items[ci.ItemID]
+		ci.Item.Images = db.gallery(ci.ItemID)
+		ci.Variant = db.variant(ci.VariantID)
+		cart.Items = append(cart.Items, ci)
+	}
+	if withUser {
+		cart.User = db.users[cart.UserID]
+	}
+	return cart
+}
+
+// loadOrder returns order with its items (and their Item and Variant) attached
+func (db *memDB) loadOrder(order models.Order, withUser bool) models.Order {
+	order.Items = []models.OrderItem{}
+	for _, id := range sortedIDs(db.orderItems) {
+		oi := db.orderItems[id]
+		if oi.OrderID != order.ID {
+			continue
+		}
+		oi.Item = db.items[oi.ItemID]
+		oi.Item.Images = db.gallery(oi.ItemID)
+		oi.Variant = db.variant(oi.VariantID)
+		order.Items = append(order.Items, oi)
+	}
+	if withUser {
+		order.User = db.users[order.UserID]
+	}
+	return order
+}
+
+// Users
+
+type memUserStore struct{ db *memDB }
+
+func (s *memUserStore) Create(user *models.User) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for _, u := range s.db.users {
+		if u.Username == user.Username {
+			return ErrDuplicate
+		}
+	}
+	if user.Role == "" {
+		user.Role = models.RoleCustomer
+	}
+	now := time.Now()
+	user.ID = s.db.nextID("users")
+	user.CreatedAt, user.UpdatedAt = now, now
+	s.db.users[user.ID] = *user
+	return nil
+}
+
+func (s *memUserStore) List(opts ListOptions) (Page[models.User], error) {
+	plan, err := planList(opts, userSortKeys)
+	if err != nil {
+		return Page[models.User]{}, err
+	}
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	users := []models.User{}
+	for _, u := range s.db.users {
+		if memMatches(opts.Filter, u.CreatedAt, nil) {
+			users = append(users, u)
+		}
+	}
+	return plan.memPage(users, func(u models.User) uint { return u.ID }), nil
+}
+
+func (s *memUserStore) Get(id uint) (*models.User, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	u, ok := s.db.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &u, nil
+}
+
+func (s *memUserStore) GetByUsername(username string) (*models.User, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	for _, u := range s.db.users {
+		if u.Username == username {
+			return &u, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memUserStore) SetRole(id uint, role string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	u, ok := s.db.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	u.Role = role
+	u.UpdatedAt = time.Now()
+	s.db.users[id] = u
+	return nil
+}
+
+// Items
+
+type memItemStore struct{ db *memDB }
+
+func (s *memItemStore) Create(item *models.Item) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	now := time.Now()
+	item.ID = s.db.nextID("items")
+	item.Version = 1
+	item.CreatedAt, item.UpdatedAt = now, now
+	s.db.items[item.ID] = *item
+	return nil
+}
+
+func (s *memItemStore) List(opts ListOptions) (Page[models.Item], error) {
+	plan, err := planList(opts, itemSortKeys)
+	if err != nil {
+		return Page[models.Item]{}, err
+	}
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	items := []models.Item{}
+	for _, item := range s.db.items {
+		if len(opts.Filter.CategoryIDs) > 0 && !s.db.inAnyCategory(item.ID, opts.Filter.CategoryIDs) {
+			continue
+		}
+		if memMatches(opts.Filter, item.CreatedAt, &item.Price.Amount) {
+			items = append(items, item)
+		}
+	}
+	page := plan.memPage(items, func(i models.Item) uint { return i.ID })
+	for i := range page.Items {
+		page.Items[i] = s.db.loadItem(page.Items[i])
+	}
+	return page, nil
+}
+
+// loadItem fills in the item's Categories, ordered by name, and Variants
+func (db *memDB) loadItem(item models.Item) models.Item {
+	item.Variants = nil
+	for _, id := range sortedIDs(db.variants) {
+		if v := db.variants[id]; v.ItemID == item.ID {
+			item.Variants = append(item.Variants, v)
+		}
+	}
+	item.Images = db.gallery(item.ID)
+	item.Categories = nil
+	for _, id := range db.itemCategories[item.ID] {
+		if category, ok := db.categories[id]; ok {
+			item.Categories = append(item.Categories, category)
+		}
+	}
+	sort.Slice(item.Categories, func(i, j int) bool { return item.Categories[i].Name < item.Categories[j].Name })
+	return item
+}
+
+func (db *memDB) inAnyCategory(itemID uint, categoryIDs []uint) bool {
+	for _, have := range db.itemCategories[itemID] {
+		for _, want := range categoryIDs {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *memItemStore) Get(id uint) (*models.Item, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	item, ok := s.db.items[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	item = s.db.loadItem(item)
+	return &item, nil
+}
+
+func (s *memItemStore) Update(item *models.Item, version uint, userID *uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	current, ok := s.db.items[item.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if current.Version != version {
+		return ErrVersionConflict
+	}
+	now := time.Now()
+	if current.Price != item.Price {
+		id := s.db.nextID("price_changes")
+		s.db.prices[id] = models.PriceChange{
+			ID:        id,
+			ItemID:    item.ID,
+			OldPrice:  current.Price,
+			NewPrice:  item.Price,
+			UserID:    userID,
+			CreatedAt: now,
+		}
+	}
+	current.Name = item.Name
+	current.Price = item.Price
+	current.Description = item.Description
+	current.MaxPerOrder = item.MaxPerOrder
+	current.Version++
+	current.UpdatedAt = now
+	s.db.items[item.ID] = current
+	item.Version, item.UpdatedAt = current.Version, now
+	return nil
+}
+
+func (s *memItemStore) ListPriceHistory(itemID uint) ([]models.PriceChange, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	changes := []models.PriceChange{}
+	ids := sortedIDs(s.db.prices)
+	for i := len(ids) - 1; i >= 0; i-- {
+		if change := s.db.prices[ids[i]]; change.ItemID == itemID {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+func (s *memItemStore) Delete(id uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	delete(s.db.items, id)
+	for imageID, image := range s.db.images {
+		if image.ItemID == id {
+			delete(s.db.images, imageID)
+		}
+	}
+	return nil
+}
+
+// recordMovement applies delta to the stock of the item, or of
+// movement.VariantID if set, and appends the movement
+func (db *memDB) recordMovement(itemID uint, delta int, movement models.StockMovement) models.StockMovement {
+	var after int
+	if movement.VariantID != nil {
+		v := db.variants[*movement.VariantID]
+		v.Stock += delta
+		db.variants[v.ID] = v
+		after = v.Stock
+	} else {
+		item := db.items[itemID]
+		item.Stock += delta
+		db.items[itemID] = item
+		after = item.Stock
+	}
+
+	movement.ID = db.nextID("stock_movements")
+	movement.ItemID = itemID
+	movement.Delta = delta
+	movement.StockAfter = after
+	movement.CreatedAt = time.Now()
+	db.movements[movement.ID] = movement
+	return movement
+}
+
+func (s *memItemStore) AdjustStock(itemID uint, delta int, movement *models.StockMovement) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	item, ok := s.db.items[itemID]
+	if !ok {
+		return ErrNotFound
+	}
+	stock := item.Stock
+	if movement.VariantID != nil {
+		v, ok := s.db.variants[*movement.VariantID]
+		if !ok || v.ItemID != itemID {
+			return ErrNotFound
+		}
+		stock = v.Stock
+	}
+	if stock+delta < 0 {
+		return ErrInsufficientStock
+	}
+	*movement = s.db.recordMovement(itemID, delta, *movement)
+	return nil
+}
+
+func (s *memItemStore) ListStockMovements(itemID uint) ([]models.StockMovement, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	movements := []models.StockMovement{}
+	ids := sortedIDs(s.db.movements)
+	for i := len(ids) - 1; i >= 0; i-- {
+		if m := s.db.movements[ids[i]]; m.ItemID == itemID {
+			movements = append(movements, m)
+		}
+	}
+	return movements, nil
+}
+
+// Carts
+
+type memCartStore struct{ db *memDB }
+
+func (s *memCartStore) List(opts ListOptions) (Page[models.Cart], error) {
+	plan, err := planList(opts, cartSortKeys)
+	if err != nil {
+		return Page[models.Cart]{}, err
+	}
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	carts := []models.Cart{}
+	for _, cart := range s.db.carts {
+		if opts.Filter.UserID != 0 && cart.UserID != opts.Filter.UserID {
+			continue
+		}
+		if memMatches(opts.Filter, cart.CreatedAt, nil) {
+			carts = append(carts, cart)
+		}
+	}
+	page := plan.memPage(carts, func(c models.Cart) uint { return c.ID })
+	for i := range page.Items {
+		page.Items[i] = s.db.loadCart(page.Items[i], true)
+	}
+	return page, nil
+}
+
+func (s *memCartStore) Get(id uint) (*models.Cart, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	cart, ok := s.db.carts[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cart = s.db.loadCart(cart, true)
+	return &cart, nil
+}
+
+func (s *memCartStore) cartIDForUser(userID uint) (uint, bool) {
+	for id, cart := range s.db.carts {
+		if cart.UserID == userID {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+func (s *memCartStore) GetByUser(userID uint) (*models.Cart, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	id, ok := s.cartIDForUser(userID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cart := s.db.loadCart(s.db.carts[id], false)
+	return &cart, nil
+}
+
+// ensureCart returns the id of the user's cart, creating it if needed
+func (s *memCartStore) ensureCart(userID uint) uint {
+	cartID, ok := s.cartIDForUser(userID)
+	if !ok {
+		now := time.Now()
+		cartID = s.db.nextID("carts")
+		s.db.carts[cartID] = models.Cart{ID: cartID, UserID: userID, CreatedAt: now, UpdatedAt: now}
+	}
+	return cartID
+}
+
+// cartLine returns the id of the cart line for itemID and variantID, if
+// present
+func (s *memCartStore) cartLine(cartID, itemID uint, variantID *uint) (uint, bool) {
+	for id, ci := range s.db.cartItems {
+		if ci.CartID != cartID || ci.ItemID != itemID {
+			continue
+		}
+		if (ci.VariantID == nil) != (variantID == nil) {
+			continue
+		}
+		if variantID == nil || *ci.VariantID == *variantID {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+func (s *memCartStore) AddItem(userID, itemID uint, variantID *uint, quantity, limit int, price money.Money) (*models.CartItem, bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	cartID := s.ensureCart(userID)
+
+	if id, ok := s.cartLine(cartID, itemID, variantID); ok {
+		ci := s.db.cartItems[id]
+		if ci.Quantity+quantity > limit {
+			return nil, false, ErrQuantityLimit
+		}
+		ci.Quantity += quantity
+		s.db.cartItems[id] = ci
+		return &ci, false, nil
+	}
+
+	if quantity > limit {
+		return nil, false, ErrQuantityLimit
+	}
+	ci := models.CartItem{
+		ID:        s.db.nextID("cart_items"),
+		CartID:    cartID,
+		ItemID:    itemID,
+		VariantID: variantID,
+		Quantity:  quantity,
+		Price:     price,
+		CreatedAt: time.Now(),
+	}
+	s.db.cartItems[ci.ID] = ci
+	return &ci, true, nil
+}
+
+func (s *memCartStore) SetItemQuantity(userID, itemID uint, variantID *uint, quantity int, price money.Money) (*models.CartItem, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	cartID := s.ensureCart(userID)
+
+	id, ok := s.cartLine(cartID, itemID, variantID)
+	if quantity == 0 {
+		if ok {
+			delete(s.db.cartItems, id)
+		}
+		return nil, nil
+	}
+
+	if ok {
+		ci := s.db.cartItems[id]
+		ci.Quantity = quantity
+		s.db.cartItems[id] = ci
+		return &ci, nil
+	}
+	ci := models.CartItem{
+		ID:        s.db.nextID("cart_items"),
+		CartID:    cartID,
+		ItemID:    itemID,
+		VariantID: variantID,
+		Quantity:  quantity,
+		Price:     price,
+		CreatedAt: time.Now(),
+	}
+	s.db.cartItems[ci.ID] = ci
+	return &ci, nil
+}
+
+func (s *memCartStore) RemoveItem(userID, itemID uint, variantID *uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	cartID, ok := s.cartIDForUser(userID)
+	if !ok {
+		return ErrNotFound
+	}
+	if id, ok := s.cartLine(cartID, itemID, variantID); ok {
+		delete(s.db.cartItems, id)
+	}
+	return nil
+}
+
+func (s *memCartStore) SyncLines(cartID uint, prices map[uint]money.Money, removed []uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for id, price := range prices {
+		if ci, ok := s.db.cartItems[id]; ok && ci.CartID == cartID {
+			ci.Price = price
+			s.db.cartItems[id] = ci
+		}
+	}
+	for _, id := range removed {
+		if ci, ok := s.db.cartItems[id]; ok && ci.CartID == cartID {
+			delete(s.db.cartItems, id)
+		}
+	}
+	return nil
+}
+
+// Orders
+
+type memOrderStore struct{ db *memDB }
+
+func (s *memOrderStore) Place(order *models.Order) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	now := time.Now()
+
+	requested, keys := requestedStock(order.Items)
+	stock := map[stockKey]int{}
+	for _, k := range keys {
+		if k.variantID != 0 {
+			if v, ok := s.db.variants[k.variantID]; ok && v.ItemID == k.itemID {
+				stock[k] = v.Stock
+			}
+		} else if item, ok := s.db.items[k.itemID]; ok {
+			stock[k] = item.Stock
+		}
+	}
+	if short := shortages(keys, requested, stock); len(short) > 0 {
+		return &OutOfStockError{Lines: short}
+	}
+
+	order.ID = s.db.nextID("orders")
+	order.CreatedAt, order.UpdatedAt = now, now
+	order.SetStatus(models.OrderStatusPending, now)
+	s.db.recordStatus(models.OrderStatusChange{OrderID: order.ID, To: order.Status, UserID: &order.UserID, CreatedAt: now})
+	for i := range order.Items {
+		oi := &order.Items[i]
+		oi.ID = s.db.nextID("order_items")
+		oi.OrderID = order.ID
+		oi.CreatedAt = now
+		stored := *oi
+		stored.Item = models.Item{}
+		stored.Variant = nil
+		s.db.orderItems[oi.ID] = stored
+	}
+	stored := *order
+	stored.Items = nil
+	stored.User = models.User{}
+	stored.StatusHistory = nil
+	stored.Payments = nil
+	s.db.orders[order.ID] = stored
+
+	for _, k := range keys {
+		movement := orderMovement(order, k, -requested[k], stock[k], models.StockReasonOrder, &order.UserID)
+		s.db.recordMovement(k.itemID, movement.Delta, movement)
+	}
+	return nil
+}
+
+func (s *memOrderStore) List(opts ListOptions) (Page[models.Order], error) {
+	plan, err := planList(opts, orderSortKeys)
+	if err != nil {
+		return Page[models.Order]{}, err
+	}
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	orders := []models.Order{}
+	for _, o := range s.db.orders {
+		if opts.Filter.UserID != 0 && o.UserID != opts.Filter.UserID {
+			continue
+		}
+		if opts.Filter.Status != "" && o.Status != opts.Filter.Status {
+			continue
+		}
+		if memMatches(opts.Filter, o.CreatedAt, &o.BaseTotal.Amount) {
+			orders = append(orders, o)
+		}
+	}
+	page := plan.memPage(orders, func(o models.Order) uint { return o.ID })
+	for i := range page.Items {
+		page.Items[i] = s.db.loadOrder(page.Items[i], true)
+	}
+	return page, nil
+}
+
+func (s *memOrderStore) Get(id uint) (*models.Order, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	order, ok := s.db.orders[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	order = s.db.loadOrder(order, false)
+	order.StatusHistory = []models.OrderStatusChange{}
+	for _, sid := range sortedIDs(s.db.statuses) {
+		if change := s.db.statuses[sid]; change.OrderID == id {
+			order.StatusHistory = append(order.StatusHistory, change)
+		}
+	}
+	order.Payments = s.db.orderPayments(id)
+	return &order, nil
+}
+
+func (db *memDB) recordStatus(change models.OrderStatusChange) {
+	change.ID = db.nextID("order_status_changes")
+	db.statuses[change.ID] = change
+}
+
+func (s *memOrderStore) Transition(id uint, from, to string, userID *uint, note string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	order, ok := s.db.orders[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if order.Status != from || to == models.OrderStatusCancelled || !models.CanTransition(from, to) {
+		return ErrInvalidTransition
+	}
+	now := time.Now()
+	order.SetStatus(to, now)
+	order.UpdatedAt = now
+	s.db.orders[id] = order
+	s.db.recordStatus(models.OrderStatusChange{OrderID: id, From: from, To: to, UserID: userID, Note: note, CreatedAt: now})
+	return nil
+}
+
+func (s *memOrderStore) Cancel(id uint, from, reason string, userID *uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	order, ok := s.db.orders[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if order.Status != from || !models.CanTransition(from, models.OrderStatusCancelled) {
+		return ErrInvalidTransition
+	}
+	now := time.Now()
+	order.SetStatus(models.OrderStatusCancelled, now)
+	order.CancelReason = reason
+	order.UpdatedAt = now
+	s.db.orders[id] = order
+	s.db.recordStatus(models.OrderStatusChange{OrderID: id, From: from, To: models.OrderStatusCancelled, UserID: userID, Note: reason, CreatedAt: now})
+
+	returned, keys := requestedStock(s.db.loadOrder(order, false).Items)
+	for _, k := range keys {
+		var stock int
+		if k.variantID != 0 {
+			v, ok := s.db.variants[k.variantID]
+			if !ok || v.ItemID != k.itemID {
+				continue
+			}
+			stock = v.Stock
+		} else {
+			item, ok := s.db.items[k.itemID]
+			if !ok {
+				continue
+			}
+			stock = item.Stock
+		}
+		movement := orderMovement(&order, k, returned[k], stock, models.StockReasonCancel, userID)
+		s.db.recordMovement(k.itemID, movement.Delta, movement)
+	}
+	return nil
+}
+
+// Payments
+
+type memPaymentStore struct{ db *memDB }
+
+// orderPayments returns the order's payments oldest first
+func (db *memDB) orderPayments(orderID uint) []models.Payment {
+	payments := []models.Payment{}
+	for _, id := range sortedIDs(db.payments) {
+		if p := db.payments[id]; p.OrderID == orderID {
+			payments = append(payments, p)
+		}
+	}
+	return payments
+}
+
+func (s *memPaymentStore) Create(payment *models.Payment) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	now := time.Now()
+	payment.ID = s.db.nextID("payments")
+	payment.CreatedAt, payment.UpdatedAt = now, now
+	s.db.payments[payment.ID] = *payment
+	return nil
+}
+
+func (s *memPaymentStore) Update(payment *models.Payment) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	current, ok := s.db.payments[payment.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	current.Reference = payment.Reference
+	current.Status = payment.Status
+	current.Refunded = payment.Refunded
+	current.FailureReason = payment.FailureReason
+	current.UpdatedAt = time.Now()
+	s.db.payments[payment.ID] = current
+	*payment = current
+	return nil
+}
+
+func (s *memPaymentStore) ListByOrder(orderID uint) ([]models.Payment, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	return s.db.orderPayments(orderID), nil
+}
+
+// Idempotency keys
+
+type memIdempotencyStore struct{ db *memDB }
+
+func (s *memIdempotencyStore) Claim(record *models.IdempotencyKey, now time.Time) (*models.IdempotencyKey, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for id, current := range s.db.idemKeys {
+		if current.UserID != record.UserID || current.Key != record.Key {
+			continue
+		}
+		if current.ExpiresAt.After(now) {
+			return &current, nil
+		}
+		delete(s.db.idemKeys, id)
+	}
+	record.ID = s.db.nextID("idempotency_keys")
+	record.CreatedAt = now
+	s.db.idemKeys[record.ID] = *record
+	return nil, nil
+}
+
+func (s *memIdempotencyStore) Complete(id uint, statusCode int, contentType, body string, expiresAt time.Time) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	record, ok := s.db.idemKeys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	record.StatusCode, record.ContentType, record.ResponseBody = statusCode, contentType, body
+	record.ExpiresAt = expiresAt
+	s.db.idemKeys[id] = record
+	return nil
+}
+
+func (s *memIdempotencyStore) Release(id uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	delete(s.db.idemKeys, id)
+	return nil
+}
+
+func (s *memIdempotencyStore) DeleteExpired(now time.Time) (int, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	n := 0
+	for id, record := range s.db.idemKeys {
+		if !record.ExpiresAt.After(now) {
+			delete(s.db.idemKeys, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Sessions
+
+type memSessionStore struct{ db *memDB }
+
+func (s *memSessionStore) Create(session *models.Session) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for _, existing := range s.db.sessions {
+		if existing.TokenHash == session.TokenHash {
+			return ErrDuplicate
+		}
+	}
+	session.ID = s.db.nextID("sessions")
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+	s.db.sessions[session.ID] = *session
+	return nil
+}
+
+func (s *memSessionStore) GetByTokenHash(hash string) (*models.Session, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	for _, session := range s.db.sessions {
+		if session.TokenHash == hash {
+			return &session, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memSessionStore) Get(id uint) (*models.Session, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	session, ok := s.db.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &session, nil
+}
+
+func (s *memSessionStore) ListByUser(userID uint) ([]models.Session, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	sessions := []models.Session{}
+	for _, id := range sortedIDs(s.db.sessions) {
+		if session := s.db.sessions[id]; session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (s *memSessionStore) Touch(id uint, at time.Time) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if session, ok := s.db.sessions[id]; ok {
+		session.LastUsedAt = &at
+		s.db.sessions[id] = session
+	}
+	return nil
+}
+
+func (s *memSessionStore) SetExpiry(id uint, expiresAt time.Time) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if session, ok := s.db.sessions[id]; ok {
+		session.ExpiresAt = &expiresAt
+		s.db.sessions[id] = session
+	}
+	return nil
+}
+
+func (s *memSessionStore) RotateToken(id uint, tokenHash string, expiresAt time.Time) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for otherID, other := range s.db.sessions {
+		if otherID != id && other.TokenHash == tokenHash {
+			return ErrDuplicate
+		}
+	}
+	if session, ok := s.db.sessions[id]; ok {
+		session.TokenHash = tokenHash
+		session.ExpiresAt = &expiresAt
+		s.db.sessions[id] = session
+	}
+	return nil
+}
+
+func (s *memSessionStore) Delete(id uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	delete(s.db.sessions, id)
+	return nil
+}
+
+func (s *memSessionStore) DeleteByUser(userID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for id, session := range s.db.sessions {
+		if session.UserID == userID {
+			delete(s.db.sessions, id)
+		}
+	}
+	return nil
+}
+
+// Exchange rates
+
+type memRateStore struct{ db *memDB }
+
+func (s *memRateStore) List() ([]models.ExchangeRate, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	rates := make([]models.ExchangeRate, 0, len(s.db.rates))
+	for _, rate := range s.db.rates {
+		rates = append(rates, rate)
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i].Currency < rates[j].Currency })
+	return rates, nil
+}
+
+func (s *memRateStore) Get(currency string) (*models.ExchangeRate, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	rate, ok := s.db.rates[currency]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &rate, nil
+}
+
+func (s *memRateStore) Upsert(rates []models.ExchangeRate) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	now := time.Now()
+	for i := range rates {
+		existing, ok := s.db.rates[rates[i].Currency]
+		if ok {
+			rates[i].ID = existing.ID
+			rates[i].CreatedAt = existing.CreatedAt
+		} else {
+			rates[i].ID = s.db.nextID("exchange_rates")
+			rates[i].CreatedAt = now
+		}
+		rates[i].UpdatedAt = now
+		s.db.rates[rates[i].Currency] = rates[i]
+	}
+	return nil
+}
+
+func (s *memRateStore) Delete(currency string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if _, ok := s.db.rates[currency]; !ok {
+		return ErrNotFound
+	}
+	delete(s.db.rates, currency)
+	return nil
+}
+
+// Variants
+
+type memVariantStore struct{ db *memDB }
+
+func (s *memVariantStore) Create(variant *models.Variant) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if _, ok := s.db.items[variant.ItemID]; !ok {
+		return ErrNotFound
+	}
+	if s.db.skus[variant.SKU] {
+		return ErrDuplicate
+	}
+	s.db.skus[variant.SKU] = true
+	now := time.Now()
+	variant.ID = s.db.nextID("variants")
+	variant.CreatedAt, variant.UpdatedAt = now, now
+	s.db.variants[variant.ID] = *variant
+	return nil
+}
+
+func (s *memVariantStore) ListByItem(itemID uint) ([]models.Variant, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	variants := []models.Variant{}
+	for _, id := range sortedIDs(s.db.variants) {
+		if v := s.db.variants[id]; v.ItemID == itemID {
+			variants = append(variants, v)
+		}
+	}
+	return variants, nil
+}
+
+func (s *memVariantStore) Get(id uint) (*models.Variant, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	v, ok := s.db.variants[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &v, nil
+}
+
+func (s *memVariantStore) Delete(id uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	delete(s.db.variants, id)
+	return nil
+}
+
+// Item images
+
+// gallery returns the item's images in gallery order
+func (db *memDB) gallery(itemID uint) []models.ItemImage {
+	images := []models.ItemImage{}
+	for _, id := range sortedIDs(db.images) {
+		if image := db.images[id]; image.ItemID == itemID {
+			images = append(images, image)
+		}
+	}
+	sort.SliceStable(images, func(i, j int) bool { return images[i].Position < images[j].Position })
+	return images
+}
+
+// setPrimary makes the image with id the only primary one of the item
+func (db *memDB) setPrimary(itemID, id uint) {
+	for imageID, image := range db.images {
+		if image.ItemID == itemID {
+			image.Primary = imageID == id
+			db.images[imageID] = image
+		}
+	}
+}
+
+type memItemImageStore struct{ db *memDB }
+
+func (s *memItemImageStore) Add(image *models.ItemImage) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if _, ok := s.db.items[image.ItemID]; !ok {
+		return ErrNotFound
+	}
+	gallery := s.db.gallery(image.ItemID)
+	image.Position = 0
+	if n := len(gallery); n > 0 {
+		image.Position = gallery[n-1].Position + 1
+	}
+	if len(gallery) == 0 {
+		image.Primary = true
+	}
+	image.ID = s.db.nextID("item_images")
+	image.CreatedAt = time.Now()
+	s.db.images[image.ID] = *image
+	if image.Primary {
+		s.db.setPrimary(image.ItemID, image.ID)
+	}
+	return nil
+}
+
+func (s *memItemImageStore) ListByItem(itemID uint) ([]models.ItemImage, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	return s.db.gallery(itemID), nil
+}
+
+func (s *memItemImageStore) Get(id uint) (*models.ItemImage, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	image, ok := s.db.images[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &image, nil
+}
+
+func (s *memItemImageStore) Update(image *models.ItemImage) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	current, ok := s.db.images[image.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	current.AltText = image.AltText
+	s.db.images[image.ID] = current
+	if image.Primary {
+		s.db.setPrimary(current.ItemID, current.ID)
+	}
+	*image = s.db.images[image.ID]
+	return nil
+}
+
+func (s *memItemImageStore) Reorder(itemID uint, imageIDs []uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if _, ok := s.db.items[itemID]; !ok {
+		return ErrNotFound
+	}
+	var ids []uint
+	for _, image := range s.db.gallery(itemID) {
+		ids = append(ids, image.ID)
+	}
+	if !sameIDs(ids, imageIDs) {
+		return ErrImageOrder
+	}
+	for position, id := range imageIDs {
+		image := s.db.images[id]
+		image.Position = position
+		s.db.images[id] = image
+	}
+	return nil
+}
+
+func (s *memItemImageStore) Delete(id uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	image, ok := s.db.images[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(s.db.images, id)
+	rest := s.db.gallery(image.ItemID)
+	for i, other := range rest {
+		other.Position = i
+		s.db.images[other.ID] = other
+	}
+	if image.Primary && len(rest) > 0 {
+		s.db.setPrimary(image.ItemID, rest[0].ID)
+	}
+	return nil
+}
+
+// Categories
+
+type memCategoryStore struct{ db *memDB }
+
+func (s *memCategoryStore) slugTakenLocked(slug string, id uint) bool {
+	for _, c := range s.db.categories {
+		if c.Slug == slug && c.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+// parentsLocked maps each category ID to its parent; s.db.mu must be held
+func (s *memCategoryStore) parentsLocked() map[uint]*uint {
+	parents := map[uint]*uint{}
+	for id, c := range s.db.categories {
+		parents[id] = c.ParentID
+	}
+	return parents
+}
+
+func (s *memCategoryStore) Create(category *models.Category) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if s.slugTakenLocked(category.Slug, 0) {
+		return ErrDuplicate
+	}
+	if err := checkParent(s.parentsLocked(), 0, category.ParentID); err != nil {
+		return err
+	}
+	now := time.Now()
+	category.ID = s.db.nextID("categories")
+	category.CreatedAt, category.UpdatedAt = now, now
+	s.db.categories[category.ID] = *category
+	return nil
+}
+
+func (s *memCategoryStore) List() ([]models.Category, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	categories := []models.Category{}
+	for _, id := range sortedIDs(s.db.categories) {
+		categories = append(categories, s.db.categories[id])
+	}
+	sort.SliceStable(categories, func(i, j int) bool { return categories[i].Name < categories[j].Name })
+	return categories, nil
+}
+
+func (s *memCategoryStore) Get(id uint) (*models.Category, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+	category, ok := s.db.categories[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &category, nil
+}
+
+func (s *memCategoryStore) Update(category *models.Category) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	existing, ok := s.db.categories[category.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if s.slugTakenLocked(category.Slug, category.ID) {
+		return ErrDuplicate
+	}
+	if err := checkParent(s.parentsLocked(), category.ID, category.ParentID); err != nil {
+		return err
+	}
+	existing.Name, existing.Slug, existing.ParentID = category.Name, category.Slug, category.ParentID
+	existing.UpdatedAt = time.Now()
+	s.db.categories[category.ID] = existing
+	*category = existing
+	return nil
+}
+
+func (s *memCategoryStore) Delete(id uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if _, ok := s.db.categories[id]; !ok {
+		return ErrNotFound
+	}
+	for _, c := range s.db.categories {
+		if c.ParentID != nil && *c.ParentID == id {
+			return ErrHasChildren
+		}
+	}
+	for itemID, ids := range s.db.itemCategories {
+		kept := ids[:0]
+		for _, cid := range ids {
+			if cid != id {
+				kept = append(kept, cid)
+			}
+		}
+		s.db.itemCategories[itemID] = kept
+	}
+	delete(s.db.categories, id)
+	return nil
+}
+
+func (s *memCategoryStore) SetItemCategories(itemID uint, categoryIDs []uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if _, ok := s.db.items[itemID]; !ok {
+		return ErrNotFound
+	}
+	ids := uniqueIDs(categoryIDs)
+	for _, id := range ids {
+		if _, ok := s.db.categories[id]; !ok {
+			return ErrNotFound
+		}
+	}
+	s.db.itemCategories[itemID] = ids
+	return nil
+}
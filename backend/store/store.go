@@ -0,0 +1,382 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"shopping-cart/models"
+	"shopping-cart/money"
+)
+
+// ErrNotFound is returned when the requested record does not exist.
+var ErrNotFound = errors.New("record not found")
+
+// ErrDuplicate is returned when a unique constraint would be violated. The
+// in-memory stores return it for every such constraint; the GORM stores
+// check for it where callers need to tell it apart and otherwise surface
+// the driver's error.
+var ErrDuplicate = errors.New("duplicate record")
+
+// ErrInsufficientStock is returned when a stock adjustment would take an
+// item's stock below zero.
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// StockShortage describes one order line that can't be fulfilled.
+type StockShortage struct {
+	ItemID    uint  `json:"item_id"`
+	VariantID *uint `json:"variant_id,omitempty"`
+	Requested int   `json:"requested"`
+	Available int   `json:"available"`
+}
+
+// OutOfStockError is returned by OrderStore.Place when one or more lines
+// request more units than are in stock. Nothing is written in that case.
+type OutOfStockError struct {
+	Lines []StockShortage
+}
+
+func (e *OutOfStockError) Error() string {
+	return fmt.Sprintf("%d order line(s) out of stock", len(e.Lines))
+}
+
+// ErrVersionConflict is returned when an update was based on a version of
+// the record that is no longer current.
+var ErrVersionConflict = errors.New("version conflict")
+
+// ErrHasChildren is returned when deleting a category that still has
+// subcategories.
+var ErrHasChildren = errors.New("category has subcategories")
+
+// ErrParentNotFound is returned when a category's parent doesn't exist.
+var ErrParentNotFound = errors.New("parent category not found")
+
+// ErrCategoryCycle is returned when a category would be nested under
+// itself or one of its subcategories.
+var ErrCategoryCycle = errors.New("category nested under itself")
+
+// checkParent verifies that parentID exists among parents, which maps
+// each category ID to its parent, and that nesting category id under it
+// makes no cycle. id is 0 for a new category.
+func checkParent(parents map[uint]*uint, id uint, parentID *uint) error {
+	if parentID == nil {
+		return nil
+	}
+	if _, ok := parents[*parentID]; !ok {
+		return ErrParentNotFound
+	}
+	// A cycle already in the tree stops the walk too, rather than looping
+	seen := map[uint]bool{}
+	for p := parentID; p != nil; p = parents[*p] {
+		if *p == id || seen[*p] {
+			return ErrCategoryCycle
+		}
+		seen[*p] = true
+	}
+	return nil
+}
+
+// stockKey identifies a stock level: an item's own, or one of its
+// variants' when variantID is non-zero.
+type stockKey struct {
+	itemID, variantID uint
+}
+
+// requestedStock totals the quantities order lines take from each stock
+// level, keeping the levels in first-seen order.
+func requestedStock(lines []models.OrderItem) (map[stockKey]int, []stockKey) {
+	requested := map[stockKey]int{}
+	var keys []stockKey
+	for _, line := range lines {
+		k := stockKey{itemID: line.ItemID}
+		if line.VariantID != nil {
+			k.variantID = *line.VariantID
+		}
+		if _, seen := requested[k]; !seen {
+			keys = append(keys, k)
+		}
+		requested[k] += line.Quantity
+	}
+	return requested, keys
+}
+
+// shortages lists the stock levels that can't cover what was requested.
+// Levels missing from stock (deleted items or variants) have none.
+func shortages(keys []stockKey, requested, stock map[stockKey]int) []StockShortage {
+	var short []StockShortage
+	for _, k := range keys {
+		if requested[k] > stock[k] {
+			line := StockShortage{ItemID: k.itemID, Requested: requested[k], Available: stock[k]}
+			if k.variantID != 0 {
+				variantID := k.variantID
+				line.VariantID = &variantID
+			}
+			short = append(short, line)
+		}
+	}
+	return short
+}
+
+// orderMovement is the audit entry for changing k's stock, which stood at
+// before, by delta on account of order.
+func orderMovement(order *models.Order, k stockKey, delta, before int, reason string, userID *uint) models.StockMovement {
+	orderID := order.ID
+	movement := models.StockMovement{
+		ItemID:     k.itemID,
+		Delta:      delta,
+		StockAfter: before + delta,
+		Reason:     reason,
+		OrderID:    &orderID,
+		UserID:     userID,
+	}
+	if k.variantID != 0 {
+		variantID := k.variantID
+		movement.VariantID = &variantID
+	}
+	return movement
+}
+
+// ErrQuantityLimit is returned when a cart line would exceed the limit
+// passed by the caller.
+var ErrQuantityLimit = errors.New("quantity exceeds the per-order limit")
+
+// UserStore persists users.
+type UserStore interface {
+	Create(user *models.User) error
+	// List supports the sort keys id, username and created_at and the
+	// created-at filters.
+	List(opts ListOptions) (Page[models.User], error)
+	Get(id uint) (*models.User, error)
+	GetByUsername(username string) (*models.User, error)
+	SetRole(id uint, role string) error
+}
+
+// ItemStore persists catalog items. Returned items have Categories,
+// Variants and Images (in gallery order) loaded.
+type ItemStore interface {
+	Create(item *models.Item) error
+	// List supports the sort keys id, name, price and created_at and the
+	// price, category and created-at filters.
+	List(opts ListOptions) (Page[models.Item], error)
+	Get(id uint) (*models.Item, error)
+	// Update saves the item's name, price, description and per-order
+	// limit and bumps its Version, provided the stored Version still
+	// equals version; otherwise it returns ErrVersionConflict. A changed
+	// price is recorded as a PriceChange attributed to userID.
+	Update(item *models.Item, version uint, userID *uint) error
+	// ListPriceHistory returns the item's price changes, newest first.
+	ListPriceHistory(itemID uint) ([]models.PriceChange, error)
+	// Delete removes the item and its gallery.
+	Delete(id uint) error
+	// AdjustStock changes the item's stock by delta and records movement
+	// (whose ItemID, Delta and StockAfter are filled in). If
+	// movement.VariantID is set, that variant's stock is changed instead;
+	// ErrNotFound is returned if it isn't a variant of the item. It returns
+	// ErrInsufficientStock if the stock would drop below zero.
+	AdjustStock(itemID uint, delta int, movement *models.StockMovement) error
+	// ListStockMovements returns the item's audit trail, newest first.
+	ListStockMovements(itemID uint) ([]models.StockMovement, error)
+}
+
+// CartStore persists carts. Returned carts have Items (with their Item and
+// Variant) loaded; Get and List also load User. A cart holds one line per
+// item and variant; variantID is nil for items without variants.
+type CartStore interface {
+	// List supports the sort keys id, created_at and updated_at and the
+	// user and created-at filters.
+	List(opts ListOptions) (Page[models.Cart], error)
+	Get(id uint) (*models.Cart, error)
+	GetByUser(userID uint) (*models.Cart, error)
+	// AddItem adds quantity units of itemID to the user's cart, creating the
+	// cart and line, priced at price, if needed. An existing line keeps the
+	// price it was added at. created reports whether a new cart line was
+	// inserted. It returns ErrQuantityLimit if the line would hold more
+	// than limit.
+	AddItem(userID, itemID uint, variantID *uint, quantity, limit int, price money.Money) (cartItem *models.CartItem, created bool, err error)
+	// SetItemQuantity sets the cart line for itemID to exactly quantity,
+	// creating the cart and line, priced at price, if needed. A quantity of
+	// 0 removes the line and returns a nil cart item.
+	SetItemQuantity(userID, itemID uint, variantID *uint, quantity int, price money.Money) (*models.CartItem, error)
+	// RemoveItem deletes the cart line for itemID. It returns ErrNotFound
+	// if the user has no cart.
+	RemoveItem(userID, itemID uint, variantID *uint) error
+	// SyncLines brings the lines of the cart with cartID up to date in a
+	// single transaction: the lines in prices (by cart line ID) take the
+	// new unit price and the lines in removed are deleted.
+	SyncLines(cartID uint, prices map[uint]money.Money, removed []uint) error
+}
+
+// ErrInvalidTransition is returned when an order can't move to the
+// requested status from the one it is in.
+var ErrInvalidTransition = errors.New("invalid order status transition")
+
+// OrderStore persists orders. Returned orders have Items (with their Item
+// and Variant) loaded; List also loads User, and Get the StatusHistory
+// and Payments.
+type OrderStore interface {
+	// Place saves order and its Items and takes the ordered quantities out
+	// of stock (the variant's, for lines with a VariantID) in a single
+	// transaction. It returns an *OutOfStockError if any line can't be
+	// fulfilled. The order is placed pending, which starts its status
+	// history. The cart is left alone until the order is paid for.
+	Place(order *models.Order) error
+	// List supports the sort keys id, total and created_at and the user,
+	// status, base-total and created-at filters.
+	List(opts ListOptions) (Page[models.Order], error)
+	Get(id uint) (*models.Order, error)
+	// Transition moves the order from status from to status to and records
+	// the change, attributed to userID, in its history. It returns
+	// ErrInvalidTransition if the order is no longer in status from or
+	// OrderTransitions doesn't allow the move. Cancellations go through
+	// Cancel instead.
+	Transition(id uint, from, to string, userID *uint, note string) error
+	// Cancel moves the order from status from to cancelled with reason and
+	// puts its quantities back into stock, recording both against userID,
+	// in a single transaction. Items and variants deleted since get
+	// nothing back. It returns ErrInvalidTransition like Transition.
+	Cancel(id uint, from, reason string, userID *uint) error
+}
+
+// SessionStore persists login sessions.
+type SessionStore interface {
+	Create(session *models.Session) error
+	Get(id uint) (*models.Session, error)
+	GetByTokenHash(hash string) (*models.Session, error)
+	// ListByUser returns the user's sessions, oldest first.
+	ListByUser(userID uint) ([]models.Session, error)
+	// Touch records that the session was used at the given time.
+	Touch(id uint, at time.Time) error
+	SetExpiry(id uint, expiresAt time.Time) error
+	// RotateToken replaces the session's token hash and expiry.
+	RotateToken(id uint, tokenHash string, expiresAt time.Time) error
+	Delete(id uint) error
+	DeleteByUser(userID uint) error
+}
+
+// VariantStore persists item variants.
+type VariantStore interface {
+	// Create returns ErrNotFound if the item doesn't exist and ErrDuplicate
+	// if any variant, even a deleted one, has the same SKU: order lines
+	// record SKUs, so one is never reused.
+	Create(variant *models.Variant) error
+	ListByItem(itemID uint) ([]models.Variant, error)
+	Get(id uint) (*models.Variant, error)
+	Delete(id uint) error
+}
+
+// ErrImageOrder is returned by ItemImageStore.Reorder when the IDs given
+// aren't exactly the item's images.
+var ErrImageOrder = errors.New("image IDs don't match the item's gallery")
+
+// sameIDs reports whether ids lists exactly the IDs in want, each once.
+func sameIDs(want, ids []uint) bool {
+	if len(ids) != len(want) {
+		return false
+	}
+	seen := make(map[uint]bool, len(want))
+	for _, id := range want {
+		seen[id] = true
+	}
+	for _, id := range ids {
+		if !seen[id] {
+			return false
+		}
+		delete(seen, id)
+	}
+	return true
+}
+
+// ItemImageStore persists item galleries.
+type ItemImageStore interface {
+	// Add appends image to its item's gallery. The first image of a gallery
+	// is always primary, and an image added with Primary set takes over
+	// from the current one. It returns ErrNotFound if the item doesn't
+	// exist.
+	Add(image *models.ItemImage) error
+	// ListByItem returns the item's gallery in order.
+	ListByItem(itemID uint) ([]models.ItemImage, error)
+	Get(id uint) (*models.ItemImage, error)
+	// Update saves the image's alt text and, if Primary is set, makes it
+	// its item's primary image.
+	Update(image *models.ItemImage) error
+	// Reorder puts the item's gallery in the order of imageIDs, which must
+	// list each of its images once; otherwise it returns ErrImageOrder.
+	Reorder(itemID uint, imageIDs []uint) error
+	// Delete removes the image and closes the gap it leaves. If it was the
+	// primary image, the first remaining one becomes primary.
+	Delete(id uint) error
+}
+
+// PaymentStore persists order payments.
+type PaymentStore interface {
+	Create(payment *models.Payment) error
+	// Update saves the payment's reference, status, refunded amount and
+	// failure reason.
+	Update(payment *models.Payment) error
+	// ListByOrder returns the order's payments, oldest first.
+	ListByOrder(orderID uint) ([]models.Payment, error)
+}
+
+// IdempotencyStore persists the responses remembered for Idempotency-Key
+// headers.
+type IdempotencyStore interface {
+	// Claim saves record as the in-progress request for its user and key,
+	// unless an unexpired record for them exists already, in which case
+	// that one is returned and record is left unsaved. Expired records are
+	// replaced; a claim's ExpiresAt is how long it may stay in progress.
+	Claim(record *models.IdempotencyKey, now time.Time) (existing *models.IdempotencyKey, err error)
+	// Complete stores the response to the claimed request, which is then
+	// kept until expiresAt.
+	Complete(id uint, statusCode int, contentType, body string, expiresAt time.Time) error
+	// Release deletes a claim so the request can be retried afresh.
+	Release(id uint) error
+	// DeleteExpired removes records that expired before now and returns
+	// how many there were.
+	DeleteExpired(now time.Time) (int, error)
+}
+
+// CategoryStore persists the category tree and item assignments.
+type CategoryStore interface {
+	// Create returns ErrDuplicate if the slug is taken and
+	// ErrParentNotFound if the parent doesn't exist.
+	Create(category *models.Category) error
+	// List returns every category, flat, ordered by name.
+	List() ([]models.Category, error)
+	Get(id uint) (*models.Category, error)
+	// Update saves the category's name, slug and parent. It returns
+	// ErrDuplicate if the slug is taken, ErrParentNotFound if the parent
+	// doesn't exist and ErrCategoryCycle if the category would end up
+	// under itself. The parent is checked atomically with the update.
+	Update(category *models.Category) error
+	// Delete removes the category and its item assignments. It returns
+	// ErrHasChildren if other categories are nested under it.
+	Delete(id uint) error
+	// SetItemCategories replaces the item's categories. It returns
+	// ErrNotFound if the item or any of the categories doesn't exist.
+	SetItemCategories(itemID uint, categoryIDs []uint) error
+}
+
+// RateStore persists the exchange-rate table.
+type RateStore interface {
+	// List returns every rate ordered by currency.
+	List() ([]models.ExchangeRate, error)
+	Get(currency string) (*models.ExchangeRate, error)
+	// Upsert inserts or updates rates by currency in a single transaction.
+	Upsert(rates []models.ExchangeRate) error
+	Delete(currency string) error
+}
+
+// Stores bundles every store the application needs.
+type Stores struct {
+	Users       UserStore
+	Items       ItemStore
+	Carts       CartStore
+	Orders      OrderStore
+	Sessions    SessionStore
+	Rates       RateStore
+	Categories  CategoryStore
+	Variants    VariantStore
+	ItemImages  ItemImageStore
+	Payments    PaymentStore
+	Idempotency IdempotencyStore
+}
@@ -0,0 +1,518 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"shopping-cart/config"
+	"shopping-cart/database"
+	"shopping-cart/models"
+	"shopping-cart/money"
+)
+
+// eachStore runs test against the in-memory stores and against the GORM
+// stores on a freshly migrated SQLite database, so both implementations
+// are held to the same contract.
+func eachStore(t *testing.T, test func(t *testing.T, s Stores)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemoryStores())
+	})
+	t.Run("gorm", func(t *testing.T) {
+		db, err := config.Open(config.DriverSQLite, filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		if _, err := database.NewRunner(db).Up(); err != nil {
+			t.Fatalf("migrate: %v", err)
+		}
+		test(t, NewGormStores(db))
+	})
+}
+
+func usd(amount int64) money.Money { return money.New(amount, "USD") }
+
+func newUser(t *testing.T, s Stores, name string) *models.User {
+	t.Helper()
+	user := &models.User{Username: name, Password: "x", Role: models.RoleCustomer}
+	if err := s.Users.Create(user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func newItem(t *testing.T, s Stores, price int64, stock int) *models.Item {
+	t.Helper()
+	item := &models.Item{Name: "Widget", Price: usd(price), Stock: stock}
+	if err := s.Items.Create(item); err != nil {
+		t.Fatalf("create item: %v", err)
+	}
+	return item
+}
+
+func placeOrder(t *testing.T, s Stores, user *models.User, item *models.Item, quantity int) *models.Order {
+	t.Helper()
+	total, _ := item.Price.Mul(int64(quantity))
+	order := &models.Order{
+		UserID:    user.ID,
+		Total:     total,
+		BaseTotal: total,
+		Items:     []models.OrderItem{{ItemID: item.ID, Quantity: quantity, Price: item.Price}},
+	}
+	if err := s.Orders.Place(order); err != nil {
+		t.Fatalf("place: %v", err)
+	}
+	return order
+}
+
+func stockOf(t *testing.T, s Stores, id uint) int {
+	t.Helper()
+	item, err := s.Items.Get(id)
+	if err != nil {
+		t.Fatalf("get item: %v", err)
+	}
+	return item.Stock
+}
+
+func TestUsers(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Stores) {
+		user := newUser(t, s, "shopper")
+		if user.ID == 0 {
+			t.Fatal("Create didn't assign an ID")
+		}
+
+		got, err := s.Users.GetByUsername("shopper")
+		if err != nil || got.ID != user.ID {
+			t.Fatalf("GetByUsername: %+v, %v", got, err)
+		}
+		if _, err := s.Users.GetByUsername("nobody"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetByUsername of a missing user: got %v, want ErrNotFound", err)
+		}
+		if _, err := s.Users.Get(user.ID + 100); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get of a missing user: got %v, want ErrNotFound", err)
+		}
+		if err := s.Users.Create(&models.User{Username: "shopper", Password: "x"}); err == nil {
+			t.Error("Create with a taken username succeeded")
+		}
+
+		if err := s.Users.SetRole(user.ID, models.RoleAdmin); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := s.Users.Get(user.ID); got.Role != models.RoleAdmin {
+			t.Errorf("role after SetRole: %q", got.Role)
+		}
+		if err := s.Users.SetRole(user.ID+100, models.RoleAdmin); !errors.Is(err, ErrNotFound) {
+			t.Errorf("SetRole of a missing user: got %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestAdjustStock(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Stores) {
+		item := newItem(t, s, 500, 2)
+
+		if err := s.Items.AdjustStock(item.ID, 3, &models.StockMovement{Reason: "restock"}); err != nil {
+			t.Fatalf("restock: %v", err)
+		}
+		if err := s.Items.AdjustStock(item.ID, -6, &models.StockMovement{Reason: "shrinkage"}); !errors.Is(err, ErrInsufficientStock) {
+			t.Errorf("adjust below zero: got %v, want ErrInsufficientStock", err)
+		}
+		if err := s.Items.AdjustStock(item.ID+100, 1, &models.StockMovement{Reason: "restock"}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("adjust a missing item: got %v, want ErrNotFound", err)
+		}
+		if got := stockOf(t, s, item.ID); got != 5 {
+			t.Errorf("stock: %d, want 5", got)
+		}
+
+		movements, err := s.Items.ListStockMovements(item.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(movements) != 1 || movements[0].Delta != 3 || movements[0].StockAfter != 5 || movements[0].Reason != "restock" {
+			t.Errorf("movements: %+v", movements)
+		}
+	})
+}
+
+func TestCartKeepsLinePrice(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Stores) {
+		user := newUser(t, s, "shopper")
+		item := newItem(t, s, 500, 10)
+
+		line, created, err := s.Carts.AddItem(user.ID, item.ID, nil, 1, 5, usd(500))
+		if err != nil || !created {
+			t.Fatalf("first add: created %v, err %v", created, err)
+		}
+		line, created, err = s.Carts.AddItem(user.ID, item.ID, nil, 2, 5, usd(700))
+		if err != nil || created {
+			t.Fatalf("second add: created %v, err %v", created, err)
+		}
+		if line.Quantity != 3 || line.Price != usd(500) {
+			t.Errorf("line after second add: quantity %d, price %v; want 3 at 5.00", line.Quantity, line.Price)
+		}
+		if _, _, err := s.Carts.AddItem(user.ID, item.ID, nil, 3, 5, usd(500)); !errors.Is(err, ErrQuantityLimit) {
+			t.Errorf("add over the limit: got %v, want ErrQuantityLimit", err)
+		}
+
+		cart, err := s.Carts.GetByUser(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Carts.SyncLines(cart.ID, map[uint]money.Money{line.ID: usd(700)}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if cart, _ = s.Carts.GetByUser(user.ID); len(cart.Items) != 1 || cart.Items[0].Price != usd(700) {
+			t.Errorf("after repricing: %+v", cart.Items)
+		}
+		if err := s.Carts.SyncLines(cart.ID, nil, []uint{line.ID}); err != nil {
+			t.Fatal(err)
+		}
+		if cart, _ = s.Carts.GetByUser(user.ID); len(cart.Items) != 0 {
+			t.Errorf("after removing: %d lines left", len(cart.Items))
+		}
+	})
+}
+
+func TestOrderStock(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Stores) {
+		user := newUser(t, s, "shopper")
+		item := newItem(t, s, 500, 3)
+		other := newItem(t, s, 500, 10)
+
+		// One short line fails the whole order
+		over := &models.Order{UserID: user.ID, Items: []models.OrderItem{
+			{ItemID: other.ID, Quantity: 1, Price: other.Price},
+			{ItemID: item.ID, Quantity: 4, Price: item.Price},
+		}}
+		var short *OutOfStockError
+		if err := s.Orders.Place(over); !errors.As(err, &short) {
+			t.Fatalf("place over stock: got %v, want *OutOfStockError", err)
+		}
+		if len(short.Lines) != 1 || short.Lines[0].ItemID != item.ID || short.Lines[0].Requested != 4 || short.Lines[0].Available != 3 {
+			t.Errorf("shortage: %+v", short.Lines)
+		}
+		if got := stockOf(t, s, other.ID); got != 10 {
+			t.Errorf("stock of the line that fit after a failed order: %d, want 10", got)
+		}
+
+		order := placeOrder(t, s, user, item, 2)
+		if got := stockOf(t, s, item.ID); got != 1 {
+			t.Errorf("stock after placing: %d, want 1", got)
+		}
+		movements, err := s.Items.ListStockMovements(item.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(movements) != 1 || movements[0].Delta != -2 || movements[0].OrderID == nil || *movements[0].OrderID != order.ID {
+			t.Errorf("movements after placing: %+v", movements)
+		}
+	})
+}
+
+func TestListPaging(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Stores) {
+		var ids []uint
+		for _, cents := range []int64{300, 100, 300, 200, 500} {
+			ids = append(ids, newItem(t, s, cents, 1).ID)
+		}
+		min := int64(150)
+
+		tests := []struct {
+			sort string
+			want []uint
+		}{
+			{"", ids},
+			{"-id", []uint{ids[4], ids[3], ids[2], ids[1], ids[0]}},
+			{"price", []uint{ids[1], ids[3], ids[0], ids[2], ids[4]}},
+			{"-price", []uint{ids[4], ids[2], ids[0], ids[3], ids[1]}},
+		}
+		for _, tt := range tests {
+			for _, filtered := range []bool{false, true} {
+				opts := ListOptions{Limit: 2, Sort: tt.sort}
+				want := tt.want
+				if filtered {
+					opts.Filter.MinAmount = &min
+					want = nil
+					for _, id := range tt.want {
+						if id != ids[1] {
+							want = append(want, id)
+						}
+					}
+				}
+				var got []uint
+				for pages := 0; pages < 5; pages++ {
+					page, err := s.Items.List(opts)
+					if err != nil {
+						t.Fatalf("sort %q: %v", tt.sort, err)
+					}
+					for _, item := range page.Items {
+						got = append(got, item.ID)
+					}
+					if page.NextCursor == "" {
+						break
+					}
+					opts.Cursor = page.NextCursor
+				}
+				if fmt.Sprint(got) != fmt.Sprint(want) {
+					t.Errorf("sort %q, filtered %v: %v, want %v", tt.sort, filtered, got, want)
+				}
+			}
+		}
+
+		if _, err := s.Items.List(ListOptions{Sort: "colour"}); !errors.Is(err, ErrInvalidSort) {
+			t.Errorf("unknown sort: got %v, want ErrInvalidSort", err)
+		}
+		page, _ := s.Items.List(ListOptions{Limit: 1, Sort: "price"})
+		if _, err := s.Items.List(ListOptions{Sort: "-price", Cursor: page.NextCursor}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("cursor from another sort: got %v, want ErrInvalidCursor", err)
+		}
+	})
+}
+
+func TestCategoryParents(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Stores) {
+		a := &models.Category{Name: "A", Slug: "a"}
+		if err := s.Categories.Create(a); err != nil {
+			t.Fatal(err)
+		}
+		b := &models.Category{Name: "B", Slug: "b", ParentID: &a.ID}
+		if err := s.Categories.Create(b); err != nil {
+			t.Fatal(err)
+		}
+		missing := uint(999)
+
+		tests := []struct {
+			name     string
+			category models.Category
+			want     error
+		}{
+			{"under its child", models.Category{ID: a.ID, Name: "A", Slug: "a", ParentID: &b.ID}, ErrCategoryCycle},
+			{"under itself", models.Category{ID: a.ID, Name: "A", Slug: "a", ParentID: &a.ID}, ErrCategoryCycle},
+			{"missing parent", models.Category{ID: b.ID, Name: "B", Slug: "b", ParentID: &missing}, ErrParentNotFound},
+			{"missing category", models.Category{ID: missing, Name: "C", Slug: "c"}, ErrNotFound},
+			{"taken slug", models.Category{ID: b.ID, Name: "B", Slug: "a", ParentID: &a.ID}, ErrDuplicate},
+			{"to the root", models.Category{ID: b.ID, Name: "B", Slug: "b"}, nil},
+		}
+		for _, tt := range tests {
+			category := tt.category
+			if err := s.Categories.Update(&category); !errors.Is(err, tt.want) {
+				t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+			}
+		}
+
+		if err := s.Categories.Create(&models.Category{Name: "C", Slug: "c", ParentID: &missing}); !errors.Is(err, ErrParentNotFound) {
+			t.Errorf("create under a missing parent: got %v", err)
+		}
+	})
+}
+
+func TestVariantSKUs(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Stores) {
+		item := newItem(t, s, 500, 0)
+		newVariant := func(itemID uint, sku string) error {
+			return s.Variants.Create(&models.Variant{ItemID: itemID, SKU: sku, Options: models.VariantOptions{"size": "M"}})
+		}
+
+		if err := newVariant(item.ID, "W-M"); err != nil {
+			t.Fatal(err)
+		}
+		if err := newVariant(item.ID, "W-M"); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("taken SKU: got %v, want ErrDuplicate", err)
+		}
+		if err := newVariant(item.ID+100, "W-L"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("missing item: got %v, want ErrNotFound", err)
+		}
+
+		variants, _ := s.Variants.ListByItem(item.ID)
+		if len(variants) != 1 {
+			t.Fatalf("variants: %+v", variants)
+		}
+		if err := s.Variants.Delete(variants[0].ID); err != nil {
+			t.Fatal(err)
+		}
+		// Old orders still show the deleted variant's SKU
+		if err := newVariant(item.ID, "W-M"); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("SKU of a deleted variant: got %v, want ErrDuplicate", err)
+		}
+	})
+}
+
+func TestItemVersionConflict(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Stores) {
+		item := newItem(t, s, 500, 0)
+		version := item.Version
+
+		item.Price = usd(600)
+		if err := s.Items.Update(item, version, nil); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		item.Price = usd(700)
+		if err := s.Items.Update(item, version, nil); !errors.Is(err, ErrVersionConflict) {
+			t.Errorf("update from a stale version: got %v, want ErrVersionConflict", err)
+		}
+		history, err := s.Items.ListPriceHistory(item.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 1 {
+			t.Errorf("price history has %d entries, want 1", len(history))
+		}
+	})
+}
+
+func TestOrderTransitions(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Stores) {
+		user := newUser(t, s, "shopper")
+		item := newItem(t, s, 500, 10)
+		order := placeOrder(t, s, user, item, 1)
+		if order.Status != models.OrderStatusPending {
+			t.Errorf("placed order status %q", order.Status)
+		}
+
+		steps := []struct {
+			from, to string
+			want     error
+		}{
+			{models.OrderStatusPending, models.OrderStatusShipped, ErrInvalidTransition},
+			{models.OrderStatusPending, models.OrderStatusPaid, nil},
+			// A stale from status loses, as a concurrent request would
+			{models.OrderStatusPending, models.OrderStatusPaid, ErrInvalidTransition},
+			{models.OrderStatusPaid, models.OrderStatusFulfilled, nil},
+			{models.OrderStatusFulfilled, models.OrderStatusShipped, nil},
+			{models.OrderStatusShipped, models.OrderStatusDelivered, nil},
+			{models.OrderStatusDelivered, models.OrderStatusPending, ErrInvalidTransition},
+			{models.OrderStatusDelivered, models.OrderStatusRefunded, nil},
+			{models.OrderStatusRefunded, models.OrderStatusPaid, ErrInvalidTransition},
+		}
+		for _, step := range steps {
+			if err := s.Orders.Transition(order.ID, step.from, step.to, &user.ID, "note"); !errors.Is(err, step.want) {
+				t.Errorf("%s to %s: got %v, want %v", step.from, step.to, err, step.want)
+			}
+		}
+		if err := s.Orders.Transition(order.ID+100, models.OrderStatusPending, models.OrderStatusPaid, nil, ""); err == nil {
+			t.Error("transition of a missing order succeeded")
+		}
+
+		got, err := s.Orders.Get(order.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != models.OrderStatusRefunded {
+			t.Errorf("status %q, want refunded", got.Status)
+		}
+		var history []string
+		for _, change := range got.StatusHistory {
+			history = append(history, change.From+">"+change.To)
+		}
+		want := "[>pending pending>paid paid>fulfilled fulfilled>shipped shipped>delivered delivered>refunded]"
+		if fmt.Sprint(history) != want {
+			t.Errorf("history %v, want %s", history, want)
+		}
+		if last := got.StatusHistory[len(got.StatusHistory)-1]; last.UserID == nil || *last.UserID != user.ID || last.Note != "note" {
+			t.Errorf("last change: %+v", last)
+		}
+	})
+}
+
+func TestOrderCancel(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Stores) {
+		user := newUser(t, s, "shopper")
+		item := newItem(t, s, 500, 3)
+		order := placeOrder(t, s, user, item, 2)
+		if err := s.Orders.Transition(order.ID, models.OrderStatusPending, models.OrderStatusPaid, nil, ""); err != nil {
+			t.Fatal(err)
+		}
+
+		// A stale from status loses, as a concurrent request would
+		if err := s.Orders.Cancel(order.ID, models.OrderStatusPending, "changed my mind", &user.ID); !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("cancel from a stale status: got %v, want ErrInvalidTransition", err)
+		}
+		if err := s.Orders.Cancel(order.ID, models.OrderStatusPaid, "changed my mind", &user.ID); err != nil {
+			t.Fatalf("cancel: %v", err)
+		}
+		if err := s.Orders.Cancel(order.ID, models.OrderStatusPaid, "changed my mind", &user.ID); !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("second cancel: got %v, want ErrInvalidTransition", err)
+		}
+		if got := stockOf(t, s, item.ID); got != 3 {
+			t.Errorf("stock after cancelling: %d, want 3", got)
+		}
+		movements, _ := s.Items.ListStockMovements(item.ID)
+		if len(movements) != 2 || movements[0].Delta != 2 || movements[0].UserID == nil || *movements[0].UserID != user.ID {
+			t.Errorf("movements: %+v", movements)
+		}
+
+		got, err := s.Orders.Get(order.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != models.OrderStatusCancelled || got.CancelReason != "changed my mind" || got.CancelledAt == nil {
+			t.Errorf("cancelled order: status %q, reason %q, cancelled at %v", got.Status, got.CancelReason, got.CancelledAt)
+		}
+		if len(got.StatusHistory) != 3 {
+			t.Errorf("status history has %d entries, want 3", len(got.StatusHistory))
+		}
+
+		// An item deleted since gets nothing back, and doesn't stop the cancel
+		gone := newItem(t, s, 500, 1)
+		other := placeOrder(t, s, user, gone, 1)
+		if err := s.Items.Delete(gone.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Orders.Cancel(other.ID, models.OrderStatusPending, "out of business", nil); err != nil {
+			t.Errorf("cancel with a deleted item: %v", err)
+		}
+	})
+}
+
+func TestIdempotencyClaims(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Stores) {
+		user := newUser(t, s, "shopper")
+		now := time.Now()
+		claim := func(key string, expiresAt time.Time) (*models.IdempotencyKey, *models.IdempotencyKey) {
+			t.Helper()
+			record := &models.IdempotencyKey{UserID: user.ID, Key: key, RequestHash: "h", ExpiresAt: expiresAt}
+			existing, err := s.Idempotency.Claim(record, now)
+			if err != nil {
+				t.Fatalf("claim %s: %v", key, err)
+			}
+			return record, existing
+		}
+
+		first, existing := claim("k1", now.Add(time.Minute))
+		if existing != nil {
+			t.Fatalf("first claim found %+v", existing)
+		}
+		if _, existing = claim("k1", now.Add(time.Minute)); existing == nil || existing.ID != first.ID || existing.StatusCode != 0 {
+			t.Fatalf("second claim: got %+v, want the in-progress claim", existing)
+		}
+
+		if err := s.Idempotency.Complete(first.ID, 201, "application/json", `{"ok":true}`, now.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if _, existing = claim("k1", now.Add(time.Minute)); existing == nil || existing.StatusCode != 201 || existing.ResponseBody != `{"ok":true}` {
+			t.Fatalf("claim after completing: got %+v", existing)
+		}
+
+		released, _ := claim("k2", now.Add(time.Minute))
+		if err := s.Idempotency.Release(released.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, existing = claim("k2", now.Add(time.Minute)); existing != nil {
+			t.Errorf("claim after releasing found %+v", existing)
+		}
+
+		// An abandoned claim expires and is replaced
+		claim("k3", now.Add(-time.Second))
+		if _, existing = claim("k3", now.Add(time.Minute)); existing != nil {
+			t.Errorf("claim over an expired one found %+v", existing)
+		}
+
+		claim("k4", now.Add(-time.Second))
+		n, err := s.Idempotency.DeleteExpired(now)
+		if err != nil || n != 1 {
+			t.Errorf("DeleteExpired: %d, %v; want 1", n, err)
+		}
+	})
+}